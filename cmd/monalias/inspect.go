@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+// Signature check outcomes reported by resolve and verify.
+const (
+	sigValid      = "valid"
+	sigInvalid    = "invalid"
+	sigMissing    = "missing"
+	sigUnknownKey = "unknown_key"
+)
+
+// responseReport is what resolve and verify print about one resolve
+// response.
+type responseReport struct {
+	Acct         string  `json:"acct"`
+	Network      string  `json:"network"`
+	Homeserver   string  `json:"homeserver,omitempty"`
+	Status       int     `json:"status,omitempty"`
+	Address      string  `json:"address,omitempty"`
+	URI          string  `json:"uri,omitempty"`
+	DisplayName  *string `json:"display_name,omitempty"`
+	Alias        *string `json:"alias,omitempty"`
+	ResolvedKind string  `json:"resolved_kind,omitempty"`
+	ExpiresAt    string  `json:"expires_at,omitempty"`
+	Expired      bool    `json:"expired,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	Reason       string  `json:"reason,omitempty"`
+	KeyID        string  `json:"key_id,omitempty"`
+	Signature    string  `json:"signature"`
+}
+
+type rawResponse struct {
+	Address string `json:"address"`
+	Network string `json:"network"`
+	URI     string `json:"uri"`
+	Meta    struct {
+		DisplayName  *string `json:"display_name"`
+		Alias        *string `json:"alias"`
+		ResolvedKind string  `json:"resolved_kind"`
+	} `json:"meta"`
+	ExpiresAt *string `json:"expires_at"`
+	Error     string  `json:"error"`
+	Reason    string  `json:"reason"`
+}
+
+// inspectResponse decodes a resolve response body and checks its signature
+// with the key keyFor returns for the kid in header. network may be empty
+// for success bodies, which echo it.
+func inspectResponse(body []byte, header http.Header, acct, network string, keyFor func(kid string) (ed25519.PublicKey, bool)) (responseReport, error) {
+	var raw rawResponse
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return responseReport{}, fmt.Errorf("decode body: %w", err)
+	}
+	if network == "" {
+		network = raw.Network
+	}
+	if network == "" {
+		return responseReport{}, fmt.Errorf("network is required to verify an error response")
+	}
+
+	rep := responseReport{
+		Acct:         acct,
+		Network:      network,
+		Address:      raw.Address,
+		URI:          raw.URI,
+		DisplayName:  raw.Meta.DisplayName,
+		Alias:        raw.Meta.Alias,
+		ResolvedKind: raw.Meta.ResolvedKind,
+		Error:        raw.Error,
+		Reason:       raw.Reason,
+		KeyID:        header.Get(protocol.HeaderKeyID),
+	}
+	if raw.ExpiresAt != nil {
+		rep.ExpiresAt = *raw.ExpiresAt
+		if t, err := time.Parse(time.RFC3339, rep.ExpiresAt); err == nil {
+			rep.Expired = !time.Now().Before(t)
+		}
+	}
+
+	var canonical string
+	if raw.Error != "" {
+		canonical = protocol.ErrorCanonical(acct, network, raw.Error, rep.KeyID)
+	} else {
+		canonical = protocol.SuccessCanonical(acct, raw.Address, network, rep.ExpiresAt, rep.KeyID, raw.URI)
+	}
+
+	sig := header.Get(protocol.HeaderSignature)
+	switch pub, ok := keyFor(rep.KeyID); {
+	case sig == "" || rep.KeyID == "":
+		rep.Signature = sigMissing
+	case !ok:
+		rep.Signature = sigUnknownKey
+	case protocol.Verify(pub, canonical, sig):
+		rep.Signature = sigValid
+	default:
+		rep.Signature = sigInvalid
+	}
+	return rep, nil
+}
+
+func printReport(w io.Writer, rep responseReport, asJSON bool) {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(rep)
+		return
+	}
+
+	line := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%-14s %s\n", name+":", value)
+		}
+	}
+	line("acct", rep.Acct)
+	line("network", rep.Network)
+	line("homeserver", rep.Homeserver)
+	if rep.Status != 0 {
+		line("status", fmt.Sprintf("%d %s", rep.Status, http.StatusText(rep.Status)))
+	}
+	line("error", rep.Error)
+	line("reason", rep.Reason)
+	line("address", rep.Address)
+	line("uri", rep.URI)
+	if rep.DisplayName != nil {
+		line("display_name", *rep.DisplayName)
+	}
+	if rep.Alias != nil {
+		line("alias", *rep.Alias)
+	}
+	line("resolved_kind", rep.ResolvedKind)
+	if rep.Expired {
+		line("expires_at", rep.ExpiresAt+" (expired)")
+	} else {
+		line("expires_at", rep.ExpiresAt)
+	}
+	line("key_id", rep.KeyID)
+	line("signature", rep.Signature)
+}
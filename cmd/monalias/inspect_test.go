@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"testing"
+
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+func TestInspectResponse(t *testing.T) {
+	const (
+		acct    = "bob$example.com"
+		addr    = "888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H"
+		expires = "2030-01-01T00:00:00Z"
+		uri     = "monero:" + addr + "?tx_amount=1.5"
+	)
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFor := func(kid string) (ed25519.PublicKey, bool) { return pub, kid == "k1" }
+	header := func(kid, canonical string) http.Header {
+		h := http.Header{}
+		h.Set(protocol.HeaderKeyID, kid)
+		h.Set(protocol.HeaderSignature, protocol.Sign(priv, canonical))
+		return h
+	}
+
+	plainBody := `{"address":"` + addr + `","network":"mainnet","expires_at":"` + expires + `"}`
+	uriBody := `{"address":"` + addr + `","network":"mainnet","expires_at":"` + expires + `","uri":"` + uri + `"}`
+	plainSig := header("k1", protocol.ResolveCanonical(acct, addr, "mainnet", expires, "k1"))
+	uriSig := header("k1", protocol.ResolveURICanonical(acct, addr, "mainnet", expires, "k1", uri))
+
+	tests := []struct {
+		name   string
+		body   string
+		header http.Header
+		want   string
+	}{
+		{"plain", plainBody, plainSig, sigValid},
+		{"with uri", uriBody, uriSig, sigValid},
+		{"uri added", uriBody, plainSig, sigInvalid},
+		{"uri stripped", plainBody, uriSig, sigInvalid},
+		{"uri changed", `{"address":"` + addr + `","network":"mainnet","expires_at":"` + expires + `","uri":"monero:` + addr + `?tx_amount=9"}`, uriSig, sigInvalid},
+		{"error", `{"error":"alias_not_found"}`, header("k1", protocol.ErrorCanonical(acct, "mainnet", "alias_not_found", "k1")), sigValid},
+		{"unknown kid", plainBody, header("k2", protocol.ResolveCanonical(acct, addr, "mainnet", expires, "k2")), sigUnknownKey},
+		{"unsigned", plainBody, http.Header{}, sigMissing},
+	}
+	for _, tt := range tests {
+		rep, err := inspectResponse([]byte(tt.body), tt.header, acct, "mainnet", keyFor)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if rep.Signature != tt.want {
+			t.Errorf("%s: signature = %s; want %s", tt.name, rep.Signature, tt.want)
+		}
+	}
+
+	rep, err := inspectResponse([]byte(uriBody), uriSig, acct, "", keyFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.URI != uri || rep.Network != "mainnet" || rep.ExpiresAt != expires {
+		t.Errorf("report = %+v", rep)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/seal"
+)
+
+const (
+	keygenUsage = "usage: monalias keygen [-force] [-seal] FILE"
+	pubkeyUsage = "usage: monalias pubkey [FILE]"
+)
+
+// readSigningKey loads the signing key file and returns the key with its
+// base64 public key.
+func readSigningKey(path string) (ed25519.PrivateKey, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	// Docker secrets and the like are often mounted read-only, so only the
+	// permission bits are checked, not the owner.
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return nil, "", fmt.Errorf("signing key file %s is readable by group or others (mode %04o); chmod 600 it", path, perm)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	priv, err := parseSigningKey(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return priv, base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)), nil
+}
+
+// parseSigningKey accepts a PKCS#8 PEM Ed25519 key (openssl genpkey
+// -algorithm ed25519) or a base64 32-byte seed or 64-byte private key.
+// Anything else is rejected rather than guessed at.
+func parseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" {
+		return nil, errors.New("signing key file is empty")
+	}
+
+	if strings.HasPrefix(trimmed, "-----BEGIN") {
+		block, rest := pem.Decode([]byte(trimmed))
+		if block == nil {
+			return nil, errors.New("signing key looks like PEM but does not parse")
+		}
+		if len(strings.TrimSpace(string(rest))) > 0 {
+			return nil, errors.New("signing key file holds more than one PEM block")
+		}
+		if block.Type != "PRIVATE KEY" {
+			return nil, fmt.Errorf("unsupported PEM block %q; expected a PKCS#8 \"PRIVATE KEY\"", block.Type)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse PKCS#8 key: %w", err)
+		}
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("PKCS#8 key is %T, not Ed25519", key)
+		}
+		return priv, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(trimmed)
+	if err != nil {
+		return nil, errors.New("signing key must be PKCS#8 PEM or base64; raw key bytes are not accepted")
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		priv := ed25519.PrivateKey(raw)
+		derived := ed25519.NewKeyFromSeed(priv.Seed())
+		if !derived.Equal(priv) {
+			return nil, errors.New("64-byte private key's public half does not match its seed")
+		}
+		return priv, nil
+	default:
+		return nil, fmt.Errorf("base64 signing key decodes to %d bytes; expected a 32-byte seed or 64-byte private key", len(raw))
+	}
+}
+
+// suggestedKID names a key after the month it was created and a short
+// fingerprint of its public key, so kids stay unique across rotations.
+func suggestedKID(pub ed25519.PublicKey, now time.Time) string {
+	sum := sha256.Sum256(pub)
+	return fmt.Sprintf("main-%s-%s", now.UTC().Format("2006-01"), hex.EncodeToString(sum[:4]))
+}
+
+func printPublicKey(pub ed25519.PublicKey) {
+	fmt.Printf("public_key: %s\n", base64.StdEncoding.EncodeToString(pub))
+	fmt.Printf("kid:        %s (suggested)\n", suggestedKID(pub, time.Now()))
+}
+
+// runKeygen writes a fresh base64 signing key seed, or with -seal a seal
+// key, to FILE with 0600 permissions.
+func runKeygen(args []string) int {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, keygenUsage) }
+	force := fs.Bool("force", false, "overwrite FILE if it exists")
+	sealKey := fs.Bool("seal", false, "write a seal key for MONALIAS_SEAL_KEY_FILE instead of a signing key")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+
+	var key string
+	var priv ed25519.PrivateKey
+	var err error
+	if *sealKey {
+		key, err = seal.GenerateKey()
+	} else if _, priv, err = ed25519.GenerateKey(rand.Reader); err == nil {
+		key = base64.StdEncoding.EncodeToString(priv.Seed())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+		return 1
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+		return 1
+	}
+	// OpenFile leaves the mode of an existing file alone.
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+		return 1
+	}
+	if _, err := fmt.Fprintln(f, key); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("wrote %s\n", path)
+	if priv != nil {
+		printPublicKey(priv.Public().(ed25519.PublicKey))
+	}
+	return 0
+}
+
+// runPubkey prints the public key of FILE, or of the configured signing key
+// file when FILE is omitted.
+func runPubkey(args []string) int {
+	fs := flag.NewFlagSet("pubkey", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, pubkeyUsage) }
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+	if path == "" {
+		path = config.SigningKeyPath()
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "pubkey: no FILE given and MONALIAS_SIGNING_KEY_FILE is not set")
+		return 2
+	}
+
+	priv, _, err := readSigningKey(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pubkey: %v\n", err)
+		return 1
+	}
+	printPublicKey(priv.Public().(ed25519.PublicKey))
+	return 0
+}
@@ -6,7 +6,9 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -19,19 +21,54 @@ import (
 	"github.com/kaigoh/monalias/internal/graphql"
 	httpx "github.com/kaigoh/monalias/internal/http"
 	"github.com/kaigoh/monalias/internal/identity"
+	"github.com/kaigoh/monalias/internal/logging"
+	"github.com/kaigoh/monalias/internal/metrics"
 	"github.com/kaigoh/monalias/internal/monero"
+	"github.com/kaigoh/monalias/internal/seal"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "resolve":
+			os.Exit(runResolve(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		case "keygen":
+			os.Exit(runKeygen(os.Args[2:]))
+		case "pubkey":
+			os.Exit(runPubkey(os.Args[2:]))
+		case "serve":
+		default:
+			log.Fatalf("unknown command %q", os.Args[1])
+		}
+	}
+	serve()
+}
+
+func serve() {
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("config error: %v", err)
 	}
 
+	// Route the standard log package through slog too, so startup messages
+	// share the configured format.
+	logger := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel, []byte(cfg.LogAcctKey))
+	slog.SetDefault(logger)
+
 	signer, pubkey, err := readSigningKey(cfg.SigningKeyFile)
 	if err != nil {
 		log.Fatalf("signing key error: %v", err)
 	}
+	var seals *seal.Box
+	if cfg.SealKeyFile != "" {
+		if seals, err = seal.Load(cfg.SealKeyFile); err != nil {
+			log.Fatalf("seal key error: %v", err)
+		}
+	}
 
 	database, err := db.Open(cfg.DBPath)
 	if err != nil {
@@ -39,40 +76,72 @@ func main() {
 	}
 	defer database.Close()
 
-	if err := initSchema(database); err != nil {
+	if err := migrateSchema(database); err != nil {
 		log.Fatalf("db schema error: %v", err)
 	}
 
-	if err := ensureInstanceConfig(database, cfg, pubkey); err != nil {
-		log.Fatalf("instance config error: %v", err)
+	if err := ensurePrimaryDomain(database, cfg); err != nil {
+		log.Fatalf("domain config error: %v", err)
+	}
+
+	if err := sealSigningKeySeeds(database, seals); err != nil {
+		log.Fatalf("signing key error: %v", err)
+	}
+	if _, err := ensureSigningKeys(database, cfg, seals, signer, pubkey); err != nil {
+		log.Fatalf("signing key error: %v", err)
 	}
 
 	var walletRPC *monero.WalletRPC
 	if cfg.WalletRPCURL != "" {
-		walletRPC = monero.NewWalletRPC(cfg.WalletRPCURL, cfg.WalletRPCUser, cfg.WalletRPCPass)
+		walletRPC = monero.NewWalletRPC(cfg.WalletRPCURL, cfg.WalletRPCUser, cfg.WalletRPCPass, logger)
 	}
+	wallets := monero.NewWalletSessions(walletRPC)
+
+	watchdog := identity.New(database, logger)
 
-	watchdog := identity.New(cfg, database)
+	clientIPs := httpx.NewClientIPResolver(cfg.TrustedProxies, cfg.ForwardedHeader, cfg.RateIPv6Prefix)
+	limiter := httpx.NewIPRateLimiter(cfg.RateRPS, cfg.RateBurst, clientIPs)
+	guard := httpx.NewEnumerationGuard(httpx.EnumerationConfig{
+		Window:        cfg.EnumWindow,
+		MinLookups:    cfg.EnumMinLookups,
+		NotFoundRatio: cfg.EnumNotFoundRatio,
+		BanDuration:   cfg.EnumBanDuration,
+	}, clientIPs, logger)
 
-	gqlHandler, err := graphql.NewHandler(cfg, database, walletRPC, watchdog)
+	gqlHandler, err := graphql.NewHandler(cfg, database, seals, wallets, watchdog, guard, logger)
 	if err != nil {
 		log.Fatalf("graphql error: %v", err)
 	}
 
-	adminHandler := httpx.AdminHandler(cfg, gqlHandler)
-	publicSvc := httpx.NewPublicService(cfg, database, signer, walletRPC)
-	limiter := httpx.NewIPRateLimiter(cfg.RateRPS, cfg.RateBurst)
-	publicHandler := publicSvc.Handler(limiter)
+	adminHandler := httpx.AdminHandler(cfg, database, gqlHandler, logger)
+	publicSvc := httpx.NewPublicService(cfg, database, seals, wallets, logger)
+	publicHandler := publicSvc.Handler(limiter, guard)
+
+	metrics.RegisterRateLimiter(limiter.Len)
+	metrics.RegisterEnumerationBans(guard.Len)
+	metrics.RegisterInstanceStatus(func(ctx context.Context) ([]metrics.DomainStatus, error) {
+		domains, err := database.ListDomains(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]metrics.DomainStatus, len(domains))
+		for i, d := range domains {
+			out[i] = metrics.DomainStatus{Domain: d.Domain, Status: d.Status, LastCheck: d.LastIdentityCheckAt.Time}
+		}
+		return out, nil
+	})
 
 	publicServer := &http.Server{
 		Addr:              cfg.PublicBind,
 		Handler:           publicHandler,
 		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
 	}
 	adminServer := &http.Server{
 		Addr:              cfg.AdminBind,
 		Handler:           adminHandler,
 		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -81,17 +150,17 @@ func main() {
 	go watchdog.Run(ctx, cfg.IdentityInterval)
 
 	go func() {
-		log.Printf("public listener on %s", cfg.PublicBind)
+		logger.Info("public listener started", "addr", cfg.PublicBind)
 		if err := publicServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("public server error: %v", err)
+			logger.Error("public server failed", "err", err)
 			stop()
 		}
 	}()
 
 	go func() {
-		log.Printf("admin listener on %s", cfg.AdminBind)
+		logger.Info("admin listener started", "addr", cfg.AdminBind)
 		if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("admin server error: %v", err)
+			logger.Error("admin server failed", "err", err)
 			stop()
 		}
 	}()
@@ -104,64 +173,153 @@ func main() {
 	_ = adminServer.Shutdown(shutdownCtx)
 }
 
-func initSchema(database *db.DB) error {
-	schema, err := db.Schema()
-	if err != nil {
-		return err
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func migrateSchema(database *db.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	return database.InitSchema(ctx, schema)
+	applied, err := database.MigrateUp(ctx)
+	for _, m := range applied {
+		log.Printf("applied migration %04d_%s", m.Version, m.Name)
+	}
+	return err
 }
 
-func ensureInstanceConfig(database *db.DB, cfg config.Config, pubkey string) error {
+// ensurePrimaryDomain creates the row for MONALIAS_DOMAIN on first start and
+// otherwise brings its homeserver in line with the environment. The
+// catch-all addresses in the environment only seed the ones the row does not
+// have yet; once set, they are changed through setDomainCatchAll, which
+// audits the change. Other domains are managed only through the admin API.
+func ensurePrimaryDomain(database *db.DB, cfg config.Config) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	current, err := database.GetInstanceConfig(ctx)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return err
-	}
+	domain := cfg.Domain
+	return database.InTx(ctx, func(tx *db.DB) error {
+		current, err := tx.GetDomain(ctx, domain)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if _, err := tx.CreateDomain(ctx, domain, cfg.PublicBaseURL); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case current.Homeserver != cfg.PublicBaseURL:
+			if _, err := tx.UpdateDomainHomeserver(ctx, domain, cfg.PublicBaseURL); err != nil {
+				return err
+			}
+		}
 
-	status := current.Status
-	if status == "" {
-		status = "OK"
-	}
+		catchAll := map[string]string{
+			db.NetworkMainnet:  cfg.CatchAllAddress,
+			db.NetworkStagenet: cfg.CatchAllStagenetAddress,
+		}
+		for _, network := range db.Networks {
+			addr := catchAll[network]
+			if addr == "" {
+				continue
+			}
+			if stored := current.CatchAllFor(network); stored.Valid {
+				if stored.String != addr {
+					log.Printf("domain %s already has a %s catch-all; ignoring the one in the environment", domain, network)
+				}
+				continue
+			}
+			if _, err := tx.UpdateDomainCatchAll(ctx, domain, network, sql.NullString{String: addr, Valid: true}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	_, err = database.UpsertInstanceConfig(
-		ctx,
-		cfg.Domain,
-		cfg.PublicBaseURL,
-		cfg.SigningKeyID,
-		pubkey,
-		status,
-		current.StatusReason,
-		current.LastIdentityCheckAt,
-	)
-	return err
+// sealSigningKeySeeds encrypts the seeds stored in plaintext before a seal
+// key was configured, and checks that every other seed a key could still
+// sign with opens with it. Without a seal key (seals nil) seeds stay
+// plaintext, and a sealed seed a key could still sign with is an error.
+func sealSigningKeySeeds(database *db.DB, seals *seal.Box) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return database.InTx(ctx, func(tx *db.DB) error {
+		keys, err := tx.ListSigningKeys(ctx)
+		if err != nil {
+			return err
+		}
+		sealed := 0
+		for _, key := range keys {
+			if !key.PrivateSeed.Valid {
+				continue
+			}
+			if seal.IsSealed(key.PrivateSeed.String) {
+				if key.State == db.SigningKeyRevoked {
+					continue
+				}
+				if seals == nil {
+					return fmt.Errorf("signing key %q is sealed; set MONALIAS_SEAL_KEY_FILE to the key it was sealed with", key.KID)
+				}
+				if _, err := seals.Open(key.KID, key.PrivateSeed.String); err != nil {
+					return fmt.Errorf("signing key %q: %w; is MONALIAS_SEAL_KEY_FILE the key it was sealed with?", key.KID, err)
+				}
+				continue
+			}
+			if seals == nil {
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(key.PrivateSeed.String)
+			if err != nil || len(raw) != ed25519.SeedSize {
+				return fmt.Errorf("signing key %q has an invalid private seed", key.KID)
+			}
+			seed := sql.NullString{String: seals.Seal(key.KID, raw), Valid: true}
+			if _, err := tx.UpdateSigningKeySeed(ctx, key.KID, seed); err != nil {
+				return err
+			}
+			sealed++
+		}
+		if sealed > 0 {
+			log.Printf("sealed %d plaintext signing key seeds", sealed)
+		}
+		return nil
+	})
 }
 
-func readSigningKey(path string) (ed25519.PrivateKey, string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, "", err
-	}
-	trimmed := strings.TrimSpace(string(data))
-	raw, err := base64.StdEncoding.DecodeString(trimmed)
-	if err != nil {
-		raw = []byte(trimmed)
-	}
+// ensureSigningKeys imports the key from MONALIAS_SIGNING_KEY_FILE into the
+// primary domain's key ring. On a fresh database it becomes the active key;
+// once a key is active, a new kid from the file is only staged as NEXT and has
+// to be activated through the admin API.
+func ensureSigningKeys(database *db.DB, cfg config.Config, seals *seal.Box, signer ed25519.PrivateKey, pubkey string) (db.SigningKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	var priv ed25519.PrivateKey
-	switch len(raw) {
-	case ed25519.SeedSize:
-		priv = ed25519.NewKeyFromSeed(raw)
-	case ed25519.PrivateKeySize:
-		priv = ed25519.PrivateKey(raw)
-	default:
-		return nil, "", errors.New("signing key must be 32-byte seed or 64-byte private key")
+	domain := cfg.Domain
+	existing, err := database.GetSigningKey(ctx, cfg.SigningKeyID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		state := db.SigningKeyActive
+		if _, err := database.GetActiveSigningKey(ctx, domain); err == nil {
+			state = db.SigningKeyNext
+			log.Printf("signing key %s staged as NEXT; activate it with activateSigningKey", cfg.SigningKeyID)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return db.SigningKey{}, err
+		}
+		seed := sql.NullString{String: seals.Seal(cfg.SigningKeyID, signer.Seed()), Valid: true}
+		if _, err := database.CreateSigningKey(ctx, domain, cfg.SigningKeyID, pubkey, seed, state); err != nil {
+			return db.SigningKey{}, err
+		}
+	case err != nil:
+		return db.SigningKey{}, err
+	case existing.Domain != domain:
+		return db.SigningKey{}, fmt.Errorf("signing key %q belongs to domain %s, not %s", cfg.SigningKeyID, existing.Domain, domain)
+	case existing.PublicKey != pubkey:
+		return db.SigningKey{}, fmt.Errorf("key file does not match stored signing key %q", cfg.SigningKeyID)
 	}
 
-	pub := priv.Public().(ed25519.PublicKey)
-	return priv, base64.StdEncoding.EncodeToString(pub), nil
+	active, err := database.GetActiveSigningKey(ctx, domain)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Only admins bring a key back into use, through the audited
+		// activateSigningKey; a restart does not.
+		if existing.State == db.SigningKeyRevoked || existing.State == db.SigningKeyRetired {
+			return active, fmt.Errorf("signing key %q is %s and no other key is active; set MONALIAS_SIGNING_KEY_FILE and MONALIAS_SIGNING_KEY_ID to a new key", cfg.SigningKeyID, strings.ToLower(existing.State))
+		}
+		return database.ActivateSigningKey(ctx, cfg.SigningKeyID)
+	}
+	return active, err
 }
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/db"
+	"github.com/kaigoh/monalias/internal/seal"
+)
+
+// testSeals seals the signing key seeds the tests store.
+var testSeals = func() *seal.Box {
+	box, err := seal.New(make([]byte, seal.KeySize))
+	if err != nil {
+		panic(err)
+	}
+	return box
+}()
+
+// newTestDatabase opens a migrated database serving the primary domain of
+// testConfig.
+func newTestDatabase(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "monalias.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensurePrimaryDomain(database, testConfig("k1")); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func testConfig(kid string) config.Config {
+	return config.Config{Domain: "example.com", PublicBaseURL: "https://monalias.example.com", SigningKeyID: kid}
+}
+
+func newTestSigner(t *testing.T) (ed25519.PrivateKey, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, base64.StdEncoding.EncodeToString(pub)
+}
+
+func TestEnsureSigningKeys(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t)
+
+	signer1, pub1 := newTestSigner(t)
+	active, err := ensureSigningKeys(database, testConfig("k1"), testSeals, signer1, pub1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active.KID != "k1" || active.State != db.SigningKeyActive {
+		t.Fatalf("first boot: active key = %+v", active)
+	}
+	// A restart with the same file changes nothing.
+	if active, err = ensureSigningKeys(database, testConfig("k1"), testSeals, signer1, pub1); err != nil || active.KID != "k1" {
+		t.Fatalf("restart: active key = %+v, %v", active, err)
+	}
+
+	// A new kid in the file is staged, not activated.
+	signer2, pub2 := newTestSigner(t)
+	if active, err = ensureSigningKeys(database, testConfig("k2"), testSeals, signer2, pub2); err != nil || active.KID != "k1" {
+		t.Fatalf("new kid: active key = %+v, %v", active, err)
+	}
+	staged, err := database.GetSigningKey(ctx, "k2")
+	if err != nil || staged.State != db.SigningKeyNext {
+		t.Fatalf("new kid: k2 = %+v, %v", staged, err)
+	}
+
+	// A kid whose stored public key differs from the file is refused.
+	if _, err := ensureSigningKeys(database, testConfig("k2"), testSeals, signer1, pub1); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("mismatched key file: err = %v", err)
+	}
+}
+
+func TestEnsureSigningKeysRefusesEndedKeys(t *testing.T) {
+	for _, state := range []string{db.SigningKeyRetired, db.SigningKeyRevoked} {
+		ctx := context.Background()
+		database := newTestDatabase(t)
+		signer1, pub1 := newTestSigner(t)
+		if _, err := ensureSigningKeys(database, testConfig("k1"), testSeals, signer1, pub1); err != nil {
+			t.Fatal(err)
+		}
+		// Leave the domain with no active key and k1 ended.
+		signer2, pub2 := newTestSigner(t)
+		if _, err := ensureSigningKeys(database, testConfig("k2"), testSeals, signer2, pub2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.ActivateSigningKey(ctx, "k2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.UpdateSigningKeyState(ctx, "k2", db.SigningKeyRevoked); err != nil {
+			t.Fatal(err)
+		}
+		if state == db.SigningKeyRevoked {
+			if _, err := database.UpdateSigningKeyState(ctx, "k1", db.SigningKeyRevoked); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err := ensureSigningKeys(database, testConfig("k1"), testSeals, signer1, pub1)
+		if err == nil || !strings.Contains(err.Error(), strings.ToLower(state)) {
+			t.Errorf("%s key: err = %v", state, err)
+		}
+		key, err := database.GetSigningKey(ctx, "k1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.State != state {
+			t.Errorf("%s key was moved to %s", state, key.State)
+		}
+	}
+}
+
+func TestEnsureSigningKeysSealsSeed(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t)
+	signer, pub := newTestSigner(t)
+	if _, err := ensureSigningKeys(database, testConfig("k1"), testSeals, signer, pub); err != nil {
+		t.Fatal(err)
+	}
+	key, err := database.GetSigningKey(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seal.IsSealed(key.PrivateSeed.String) || strings.Contains(key.PrivateSeed.String, base64.StdEncoding.EncodeToString(signer.Seed())) {
+		t.Fatalf("stored seed %q is not sealed", key.PrivateSeed.String)
+	}
+	seed, err := testSeals.Open("k1", key.PrivateSeed.String)
+	if err != nil || !bytes.Equal(seed, signer.Seed()) {
+		t.Errorf("Open = %x, %v; want the signer's seed", seed, err)
+	}
+}
+
+func TestSealSigningKeySeeds(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t)
+
+	// Seeds stored before sealing are plaintext base64.
+	signer, pub := newTestSigner(t)
+	plain := sql.NullString{String: base64.StdEncoding.EncodeToString(signer.Seed()), Valid: true}
+	if _, err := database.CreateSigningKey(ctx, "example.com", "k1", pub, plain, db.SigningKeyActive); err != nil {
+		t.Fatal(err)
+	}
+	if err := sealSigningKeySeeds(database, testSeals); err != nil {
+		t.Fatal(err)
+	}
+	key, err := database.GetSigningKey(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := testSeals.Open("k1", key.PrivateSeed.String)
+	if err != nil || !bytes.Equal(seed, signer.Seed()) {
+		t.Fatalf("resealed seed: Open = %x, %v", seed, err)
+	}
+	// Sealed seeds are left alone.
+	if err := sealSigningKeySeeds(database, testSeals); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := database.GetSigningKey(ctx, "k1"); err != nil || again.PrivateSeed != key.PrivateSeed {
+		t.Errorf("second run changed the seed: %+v, %v", again, err)
+	}
+
+	// A seal key the seeds were not sealed with is refused.
+	other, err := seal.New(bytes.Repeat([]byte{9}, seal.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sealSigningKeySeeds(database, other); err == nil || !strings.Contains(err.Error(), "MONALIAS_SEAL_KEY_FILE") {
+		t.Errorf("wrong seal key: err = %v", err)
+	}
+}
+
+func TestSealSigningKeySeedsWithoutKey(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t)
+
+	// Without a seal key, an upgraded database keeps its plaintext seeds.
+	signer, pub := newTestSigner(t)
+	plain := sql.NullString{String: base64.StdEncoding.EncodeToString(signer.Seed()), Valid: true}
+	if _, err := database.CreateSigningKey(ctx, "example.com", "k1", pub, plain, db.SigningKeyActive); err != nil {
+		t.Fatal(err)
+	}
+	if err := sealSigningKeySeeds(database, nil); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := database.GetSigningKey(ctx, "k1"); err != nil || key.PrivateSeed != plain {
+		t.Fatalf("seed changed without a seal key: %+v, %v", key, err)
+	}
+
+	// Once sealed, the seeds need the key.
+	if err := sealSigningKeySeeds(database, testSeals); err != nil {
+		t.Fatal(err)
+	}
+	if err := sealSigningKeySeeds(database, nil); err == nil || !strings.Contains(err.Error(), "MONALIAS_SEAL_KEY_FILE") {
+		t.Errorf("sealed seeds without a seal key: err = %v", err)
+	}
+}
+
+func TestEnsurePrimaryDomainSeedsCatchAllOnce(t *testing.T) {
+	ctx := context.Background()
+	const (
+		envAddr   = "888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H"
+		adminAddr = "4AdUndXHHZ6cfufTMvppY6JwXNouMBzSkbLYfpAV5Usx3skxNgYeYTRj5UzqtReoS44qo9mtmXCqY45DJ852K5Jv2684Rge"
+	)
+	database := newTestDatabase(t)
+	cfg := testConfig("k1")
+	cfg.CatchAllAddress = envAddr
+	catchAll := func() sql.NullString {
+		t.Helper()
+		domain, err := database.GetDomain(ctx, cfg.Domain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return domain.CatchAllAddress
+	}
+
+	// A catch-all the row lacks is seeded from the environment.
+	if err := ensurePrimaryDomain(database, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := catchAll(); got.String != envAddr {
+		t.Fatalf("catch-all = %v; want the environment's", got)
+	}
+
+	// One set through the admin API survives a restart.
+	if _, err := database.UpdateDomainCatchAll(ctx, cfg.Domain, db.NetworkMainnet, sql.NullString{String: adminAddr, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensurePrimaryDomain(database, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := catchAll(); got.String != adminAddr {
+		t.Errorf("catch-all = %v; want the admin's %s kept", got, adminAddr)
+	}
+
+	// A cleared one is seeded again.
+	if _, err := database.UpdateDomainCatchAll(ctx, cfg.Domain, db.NetworkMainnet, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensurePrimaryDomain(database, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := catchAll(); got.String != envAddr {
+		t.Errorf("catch-all = %v; want the environment's after clearing", got)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/db"
+)
+
+const migrateUsage = "usage: monalias migrate status|up|down"
+
+func runMigrate(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	database, err := db.Open(config.DBPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db open error: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "status":
+		err = migrateStatus(ctx, database)
+	case "up":
+		var applied []db.Migration
+		applied, err = database.MigrateUp(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		var m db.Migration
+		m, err = database.MigrateDown(ctx)
+		if err == nil {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func migrateStatus(ctx context.Context, database *db.DB) error {
+	statuses, err := database.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := database.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, st := range statuses {
+		applied := "pending"
+		if st.AppliedAt.Valid {
+			applied = "applied " + st.AppliedAt.Time.UTC().Format(time.RFC3339)
+		}
+		fmt.Printf("%04d_%-20s %s\n", st.Version, st.Name, applied)
+	}
+	fmt.Printf("database version %d, binary version %d\n", current, len(statuses))
+	if current > len(statuses) {
+		return db.ErrSchemaTooNew
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kaigoh/monalias/pkg/client"
+)
+
+const resolveUsage = "usage: monalias resolve [-network mainnet|stagenet] [-homeserver URL] [-json] [-save-body FILE] [-save-headers FILE] <id>"
+
+// runResolve looks up an ID the way a wallet would and prints the response
+// together with the signature check, including for responses a client would
+// reject.
+func runResolve(args []string) int {
+	fs := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, resolveUsage) }
+	network := fs.String("network", client.Mainnet, "network to resolve on")
+	homeserver := fs.String("homeserver", "", "resolve against this homeserver instead of discovering it")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	saveBody := fs.String("save-body", "", "write the raw response body to FILE")
+	saveHeaders := fs.String("save-headers", "", "write the raw response headers to FILE")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	id, err := client.ParseID(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolve: %v\n", err)
+		return 2
+	}
+	acct := id.String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	c := client.New(&http.Client{Timeout: 15 * time.Second})
+	var wk *client.WellKnown
+	if *homeserver != "" {
+		base := strings.TrimRight(*homeserver, "/")
+		wk, err = c.FetchWellKnown(ctx, base)
+		if err == nil {
+			wk.Homeserver = base
+		}
+	} else {
+		wk, err = c.WellKnown(ctx, id.Domain)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolve: %v\n", err)
+		return 1
+	}
+
+	status, header, body, err := postResolve(ctx, c, wk.Homeserver, acct, *network)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolve: %v\n", err)
+		return 1
+	}
+	if err := saveResponse(*saveBody, *saveHeaders, status, header, body); err != nil {
+		fmt.Fprintf(os.Stderr, "resolve: %v\n", err)
+		return 1
+	}
+
+	rep, err := inspectResponse(body, header, acct, *network, wk.Key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolve: HTTP %d: %v\n", status, err)
+		return 1
+	}
+	rep.Homeserver = wk.Homeserver
+	rep.Status = status
+	printReport(os.Stdout, rep, *asJSON)
+
+	if status != http.StatusOK || rep.Signature != sigValid {
+		return 1
+	}
+	return 0
+}
+
+func postResolve(ctx context.Context, c *client.Client, homeserver, acct, network string) (int, http.Header, []byte, error) {
+	payload, err := json.Marshal(map[string]string{"acct": acct, "network": network})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, homeserver+"/_monalias/resolve", bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, resp.Header, body, err
+}
+
+// saveResponse writes the body and headers in the form verify reads back:
+// the body verbatim, and the headers as an HTTP status line followed by
+// header lines, like curl -D.
+func saveResponse(bodyPath, headersPath string, status int, header http.Header, body []byte) error {
+	if bodyPath != "" {
+		if err := os.WriteFile(bodyPath, body, 0o644); err != nil {
+			return err
+		}
+	}
+	if headersPath != "" {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+		if err := header.Write(&buf); err != nil {
+			return err
+		}
+		buf.WriteString("\r\n")
+		if err := os.WriteFile(headersPath, buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// singleKey serves one public key regardless of kid, for offline checks
+// against a key the operator supplies.
+func singleKey(pub ed25519.PublicKey) func(string) (ed25519.PublicKey, bool) {
+	return func(string) (ed25519.PublicKey, bool) { return pub, true }
+}
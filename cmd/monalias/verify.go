@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/kaigoh/monalias/pkg/client"
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+const verifyUsage = "usage: monalias verify -acct ID -pubkey BASE64 -body FILE (-headers FILE | -kid KID -sig SIG) [-network mainnet|stagenet] [-json]"
+
+// runVerify checks a saved resolve response offline against a public key.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, verifyUsage) }
+	acctFlag := fs.String("acct", "", "Monalias ID the response was requested for")
+	network := fs.String("network", "", "network the response was requested for (defaults to the body's network)")
+	pubkeyFlag := fs.String("pubkey", "", "base64 Ed25519 public key")
+	bodyPath := fs.String("body", "", "file holding the response body")
+	headersPath := fs.String("headers", "", "file holding the response headers, as written by curl -D")
+	kid := fs.String("kid", "", "X-Monalias-Key-Id value, instead of -headers")
+	sig := fs.String("sig", "", "X-Monalias-Sig value, instead of -headers")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if *acctFlag == "" || *pubkeyFlag == "" || *bodyPath == "" || (*headersPath == "") == (*sig == "") {
+		fs.Usage()
+		return 2
+	}
+
+	id, err := client.ParseID(*acctFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 2
+	}
+	pub, ok := protocol.ParsePublicKey(*pubkeyFlag)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "verify: -pubkey must be a base64-encoded 32-byte Ed25519 public key")
+		return 2
+	}
+	body, err := os.ReadFile(*bodyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 1
+	}
+
+	header := http.Header{}
+	if *headersPath != "" {
+		header, err = readHeaderFile(*headersPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+			return 1
+		}
+	} else {
+		header.Set(protocol.HeaderKeyID, *kid)
+		header.Set(protocol.HeaderSignature, *sig)
+	}
+
+	rep, err := inspectResponse(body, header, id.String(), *network, singleKey(pub))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 1
+	}
+	printReport(os.Stdout, rep, *asJSON)
+	if rep.Signature != sigValid {
+		return 1
+	}
+	return 0
+}
+
+// readHeaderFile parses a header dump such as the output of curl -D, with
+// or without the leading HTTP status line.
+func readHeaderFile(path string) (http.Header, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(bytes.NewReader(data))
+	if first, err := r.Peek(5); err == nil && strings.HasPrefix(string(first), "HTTP/") {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+	}
+	mime, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil && len(mime) == 0 {
+		return nil, fmt.Errorf("parse headers: %w", err)
+	}
+	return http.Header(mime), nil
+}
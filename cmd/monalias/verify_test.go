@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A response signed by the Ed25519 key whose seed is the bytes 0 to 31.
+const (
+	knownPubkey = "A6EHv/POEL4dcN0Y50vAmWfk1jCbpQ1fHdyGZBJVMbg="
+	knownBody   = `{"address":"888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H","network":"mainnet","expires_at":"2030-01-01T00:00:00Z"}`
+	knownSig    = "9pN4ra7Qu6nvgr5haCc1fWwP/s1LGF7tY0S7HX0KmcYPgD8QbcFL3Wr2PnwS14Pr0hWxtLOPJ0f0GFfFCbzgAA=="
+)
+
+func TestRunVerify(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	body := write("body.json", knownBody)
+	headers := write("headers.txt", "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nX-Monalias-Key-Id: k1\r\nX-Monalias-Sig: "+knownSig+"\r\n\r\n")
+	tampered := write("tampered.json", strings.Replace(knownBody, "2030", "2031", 1))
+	_, otherPub := newTestSigner(t)
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"headers file", []string{"-acct", "bob$example.com", "-pubkey", knownPubkey, "-body", body, "-headers", headers}, 0},
+		{"kid and sig", []string{"-acct", "bob$example.com", "-pubkey", knownPubkey, "-body", body, "-kid", "k1", "-sig", knownSig}, 0},
+		{"acct in another case", []string{"-acct", "Bob$Example.com", "-pubkey", knownPubkey, "-body", body, "-headers", headers}, 1},
+		{"tampered body", []string{"-acct", "bob$example.com", "-pubkey", knownPubkey, "-body", tampered, "-headers", headers}, 1},
+		{"other acct", []string{"-acct", "alice$example.com", "-pubkey", knownPubkey, "-body", body, "-headers", headers}, 1},
+		{"other network", []string{"-acct", "bob$example.com", "-network", "stagenet", "-pubkey", knownPubkey, "-body", body, "-headers", headers}, 1},
+		{"other kid", []string{"-acct", "bob$example.com", "-pubkey", knownPubkey, "-body", body, "-kid", "k2", "-sig", knownSig}, 1},
+		{"other key", []string{"-acct", "bob$example.com", "-pubkey", otherPub, "-body", body, "-headers", headers}, 1},
+		{"bad pubkey", []string{"-acct", "bob$example.com", "-pubkey", "nope", "-body", body, "-headers", headers}, 2},
+		{"headers and sig", []string{"-acct", "bob$example.com", "-pubkey", knownPubkey, "-body", body, "-headers", headers, "-sig", knownSig}, 2},
+	}
+	for _, tt := range tests {
+		if code := runVerify(tt.args); code != tt.code {
+			t.Errorf("%s: exited %d; want %d", tt.name, code, tt.code)
+		}
+	}
+}
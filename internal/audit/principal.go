@@ -0,0 +1,20 @@
+// Package audit carries the identity of the admin making a request from the
+// HTTP layer down to the GraphQL resolvers that record it in audit_log.
+package audit
+
+import "context"
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Principal returns the authenticated admin, or "unknown" when the request
+// did not pass through admin authentication.
+func Principal(ctx context.Context) string {
+	if p, ok := ctx.Value(principalKey{}).(string); ok && p != "" {
+		return p
+	}
+	return "unknown"
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -10,6 +12,10 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
+
+	"github.com/kaigoh/monalias/internal/logging"
+	"github.com/kaigoh/monalias/internal/monero/address"
+	"github.com/kaigoh/monalias/internal/names"
 )
 
 const (
@@ -19,51 +25,107 @@ const (
 
 // Config holds all runtime configuration values.
 type Config struct {
-	Domain           string
-	PublicBaseURL    string
-	DBPath           string
-	RateRPS          float64
-	RateBurst        int
-	CatchAllAddress  string
-	WalletRPCURL     string
-	WalletRPCUser    string
-	WalletRPCPass    string
-	SigningKeyFile   string
-	SigningKeyID     string
-	AdminUser        string
-	AdminPassword    string
-	PublicBind       string
-	AdminBind        string
-	IdentityInterval time.Duration
+	// Domain is the primary domain, normalized by names.Domain. Further
+	// domains are added through the admin API.
+	Domain          string
+	PublicBaseURL   string
+	DBPath          string
+	RateRPS         float64
+	RateBurst       int
+	CatchAllAddress string
+	// CatchAllStagenetAddress is served for unknown aliases resolved on stagenet.
+	CatchAllStagenetAddress string
+	WalletRPCURL            string
+	WalletRPCUser           string
+	WalletRPCPass           string
+	SigningKeyFile          string
+	SigningKeyID            string
+	AdminUser               string
+	AdminPassword           string
+	PublicBind              string
+	AdminBind               string
+	IdentityInterval        time.Duration
+	ResolveTTL              time.Duration
+	// TrustedProxies are the peers whose X-Forwarded-For / Forwarded
+	// headers are believed when working out the client address.
+	TrustedProxies []netip.Prefix
+	// RateIPv6Prefix is the prefix length IPv6 clients are grouped by for
+	// rate limiting.
+	RateIPv6Prefix int
+	// AliasRatePerMinute is the default per-alias resolve limit for aliases
+	// without their own; 0 means unlimited.
+	AliasRatePerMinute int
+	// Enumeration detection: a client (or, at five times EnumMinLookups, a
+	// /24 or /64) whose resolves within EnumWindow miss at EnumNotFoundRatio
+	// or more is banned for EnumBanDuration. EnumMinLookups 0 disables it.
+	EnumWindow        time.Duration
+	EnumMinLookups    int
+	EnumNotFoundRatio float64
+	EnumBanDuration   time.Duration
+	// BatchMax is the most pairs one resolve-batch request may carry.
+	BatchMax int
+	// LogFormat is "text" or "json"; LogLevel filters records below it.
+	LogFormat string
+	LogLevel  slog.Level
+	// ReservedNames are the normalized local parts and labels no account
+	// or alias may be created with.
+	ReservedNames []string
+	// SealKeyFile holds the key signing key seeds are encrypted with in the
+	// database. Empty, seeds are stored unsealed.
+	SealKeyFile string
+	// ProvisionMaxPerAccount caps the aliases PROVISION resolves may create
+	// on one account; ProvisionRatePerMinute limits how fast they may create
+	// them, 0 meaning unlimited.
+	ProvisionMaxPerAccount int
+	ProvisionRatePerMinute int
+	// LogAcctKey keys the acct_hash digests in logs. Empty, each run picks
+	// a random key.
+	LogAcctKey string
+	// ForwardedHeader is the header trusted proxies record the client in:
+	// "X-Forwarded-For" or the RFC 7239 "Forwarded". The other is ignored,
+	// since a client can send it through a proxy that does not set it.
+	ForwardedHeader string
 }
 
+const (
+	signingKeySecretPath = "/run/secrets/monalias_signing_key"
+	sealKeySecretPath    = "/run/secrets/monalias_seal_key"
+)
+
 func Load() (Config, error) {
 	_ = godotenv.Load()
 
 	cfg := Config{
-		Domain:           os.Getenv("MONALIAS_DOMAIN"),
-		PublicBaseURL:    os.Getenv("MONALIAS_PUBLIC_BASE_URL"),
-		DBPath:           getenvDefault("MONALIAS_DB_PATH", "./monalias.db"),
-		RateRPS:          getenvFloat("MONALIAS_RATE_IP_RPS", 1.0),
-		RateBurst:        getenvInt("MONALIAS_RATE_IP_BURST", 10),
-		CatchAllAddress:  os.Getenv("MONALIAS_CATCHALL_ADDRESS"),
-		WalletRPCURL:     os.Getenv("MONALIAS_WALLET_RPC_URL"),
-		WalletRPCUser:    os.Getenv("MONALIAS_WALLET_RPC_USER"),
-		WalletRPCPass:    os.Getenv("MONALIAS_WALLET_RPC_PASSWORD"),
-		SigningKeyFile:   os.Getenv("MONALIAS_SIGNING_KEY_FILE"),
-		SigningKeyID:     getenvDefault("MONALIAS_SIGNING_KEY_ID", "main-2026-01"),
-		AdminUser:        getenvDefault("MONALIAS_ADMIN_USER", "admin"),
-		AdminPassword:    os.Getenv("MONALIAS_ADMIN_PASSWORD"),
-		PublicBind:       getenvDefault("MONALIAS_PUBLIC_BIND", defaultPublicBind),
-		AdminBind:        getenvDefault("MONALIAS_ADMIN_BIND", defaultAdminBind),
-		IdentityInterval: getenvDuration("MONALIAS_IDENTITY_INTERVAL", 15*time.Minute),
-	}
-
-	if cfg.SigningKeyFile == "" {
-		secretPath := "/run/secrets/monalias_signing_key"
-		if fileExists(secretPath) {
-			cfg.SigningKeyFile = secretPath
-		}
+		Domain:                  os.Getenv("MONALIAS_DOMAIN"),
+		PublicBaseURL:           os.Getenv("MONALIAS_PUBLIC_BASE_URL"),
+		DBPath:                  getenvDefault("MONALIAS_DB_PATH", "./monalias.db"),
+		RateRPS:                 getenvFloat("MONALIAS_RATE_IP_RPS", 1.0),
+		RateBurst:               getenvInt("MONALIAS_RATE_IP_BURST", 10),
+		RateIPv6Prefix:          getenvInt("MONALIAS_RATE_IPV6_PREFIX", 64),
+		AliasRatePerMinute:      getenvInt("MONALIAS_RATE_ALIAS_PER_MINUTE", 0),
+		EnumWindow:              getenvDuration("MONALIAS_ENUM_WINDOW", 10*time.Minute),
+		EnumMinLookups:          getenvInt("MONALIAS_ENUM_MIN_LOOKUPS", 20),
+		EnumNotFoundRatio:       getenvFloat("MONALIAS_ENUM_NOT_FOUND_RATIO", 0.5),
+		EnumBanDuration:         getenvDuration("MONALIAS_ENUM_BAN_DURATION", 30*time.Minute),
+		BatchMax:                getenvInt("MONALIAS_BATCH_MAX", 25),
+		CatchAllAddress:         os.Getenv("MONALIAS_CATCHALL_ADDRESS"),
+		CatchAllStagenetAddress: os.Getenv("MONALIAS_CATCHALL_STAGENET_ADDRESS"),
+		WalletRPCURL:            os.Getenv("MONALIAS_WALLET_RPC_URL"),
+		WalletRPCUser:           os.Getenv("MONALIAS_WALLET_RPC_USER"),
+		WalletRPCPass:           os.Getenv("MONALIAS_WALLET_RPC_PASSWORD"),
+		SigningKeyFile:          signingKeyPathFromEnv(),
+		SigningKeyID:            getenvDefault("MONALIAS_SIGNING_KEY_ID", "main-2026-01"),
+		AdminUser:               getenvDefault("MONALIAS_ADMIN_USER", "admin"),
+		AdminPassword:           os.Getenv("MONALIAS_ADMIN_PASSWORD"),
+		PublicBind:              getenvDefault("MONALIAS_PUBLIC_BIND", defaultPublicBind),
+		AdminBind:               getenvDefault("MONALIAS_ADMIN_BIND", defaultAdminBind),
+		IdentityInterval:        getenvDuration("MONALIAS_IDENTITY_INTERVAL", 15*time.Minute),
+		ResolveTTL:              getenvDuration("MONALIAS_RESOLVE_TTL", 5*time.Minute),
+		SealKeyFile:             sealKeyPathFromEnv(),
+		ProvisionMaxPerAccount:  getenvInt("MONALIAS_PROVISION_MAX_PER_ACCOUNT", 100),
+		ProvisionRatePerMinute:  getenvInt("MONALIAS_PROVISION_RATE_PER_MINUTE", 10),
+		LogAcctKey:              os.Getenv("MONALIAS_LOG_ACCT_KEY"),
+		ForwardedHeader:         getenvDefault("MONALIAS_FORWARDED_HEADER", "X-Forwarded-For"),
 	}
 
 	if cfg.WalletRPCPass == "" {
@@ -89,10 +151,112 @@ func Load() (Config, error) {
 		return cfg, errors.New("MONALIAS_ADMIN_PASSWORD is required")
 	}
 
-	cfg.DBPath = filepath.Clean(cfg.DBPath)
+	if cfg.CatchAllAddress != "" {
+		if _, err := address.Validate(cfg.CatchAllAddress, address.Mainnet); err != nil {
+			return cfg, fmt.Errorf("MONALIAS_CATCHALL_ADDRESS: %w", err)
+		}
+	}
+	if cfg.CatchAllStagenetAddress != "" {
+		if _, err := address.Validate(cfg.CatchAllStagenetAddress, address.Stagenet); err != nil {
+			return cfg, fmt.Errorf("MONALIAS_CATCHALL_STAGENET_ADDRESS: %w", err)
+		}
+	}
+	if cfg.ResolveTTL < 0 {
+		return cfg, errors.New("MONALIAS_RESOLVE_TTL must not be negative")
+	}
+
+	if cfg.AliasRatePerMinute < 0 {
+		return cfg, errors.New("MONALIAS_RATE_ALIAS_PER_MINUTE must not be negative")
+	}
+	if cfg.EnumMinLookups < 0 {
+		return cfg, errors.New("MONALIAS_ENUM_MIN_LOOKUPS must not be negative")
+	}
+	if cfg.EnumNotFoundRatio <= 0 || cfg.EnumNotFoundRatio > 1 {
+		return cfg, errors.New("MONALIAS_ENUM_NOT_FOUND_RATIO must be in (0, 1]")
+	}
+	if cfg.BatchMax < 1 {
+		return cfg, errors.New("MONALIAS_BATCH_MAX must be at least 1")
+	}
+	if cfg.ProvisionMaxPerAccount < 1 {
+		return cfg, errors.New("MONALIAS_PROVISION_MAX_PER_ACCOUNT must be at least 1")
+	}
+	if cfg.ProvisionRatePerMinute < 0 {
+		return cfg, errors.New("MONALIAS_PROVISION_RATE_PER_MINUTE must not be negative")
+	}
+	if cfg.LogAcctKey != "" && len(cfg.LogAcctKey) < 16 {
+		return cfg, errors.New("MONALIAS_LOG_ACCT_KEY must be at least 16 characters")
+	}
+
+	var err error
+	if cfg.Domain, err = names.Domain(cfg.Domain); err != nil {
+		return cfg, fmt.Errorf("MONALIAS_DOMAIN: %w", err)
+	}
+	if cfg.TrustedProxies, err = parsePrefixes(os.Getenv("MONALIAS_TRUSTED_PROXIES")); err != nil {
+		return cfg, fmt.Errorf("MONALIAS_TRUSTED_PROXIES: %w", err)
+	}
+	switch {
+	case strings.EqualFold(cfg.ForwardedHeader, "X-Forwarded-For"):
+		cfg.ForwardedHeader = "X-Forwarded-For"
+	case strings.EqualFold(cfg.ForwardedHeader, "Forwarded"):
+		cfg.ForwardedHeader = "Forwarded"
+	default:
+		return cfg, errors.New("MONALIAS_FORWARDED_HEADER must be X-Forwarded-For or Forwarded")
+	}
+	if cfg.RateIPv6Prefix < 1 || cfg.RateIPv6Prefix > 128 {
+		return cfg, errors.New("MONALIAS_RATE_IPV6_PREFIX must be between 1 and 128")
+	}
+	if cfg.LogFormat, err = logging.ParseFormat(getenvDefault("MONALIAS_LOG_FORMAT", logging.FormatText)); err != nil {
+		return cfg, fmt.Errorf("MONALIAS_LOG_FORMAT: %w", err)
+	}
+	if cfg.LogLevel, err = logging.ParseLevel(getenvDefault("MONALIAS_LOG_LEVEL", "info")); err != nil {
+		return cfg, fmt.Errorf("MONALIAS_LOG_LEVEL: %w", err)
+	}
+	if cfg.ReservedNames, err = parseReservedNames(); err != nil {
+		return cfg, fmt.Errorf("MONALIAS_RESERVED_NAMES: %w", err)
+	}
+
 	return cfg, nil
 }
 
+// DBPath returns the database path from .env or the environment without
+// requiring the rest of the server configuration. Used by maintenance
+// subcommands.
+func DBPath() string {
+	_ = godotenv.Load()
+	return dbPathFromEnv()
+}
+
+func dbPathFromEnv() string {
+	return filepath.Clean(getenvDefault("MONALIAS_DB_PATH", "./monalias.db"))
+}
+
+// SigningKeyPath returns MONALIAS_SIGNING_KEY_FILE, falling back to the
+// Docker secret path when it exists. Empty means no key file is configured.
+func SigningKeyPath() string {
+	_ = godotenv.Load()
+	return signingKeyPathFromEnv()
+}
+
+func signingKeyPathFromEnv() string {
+	if path := os.Getenv("MONALIAS_SIGNING_KEY_FILE"); path != "" {
+		return path
+	}
+	if fileExists(signingKeySecretPath) {
+		return signingKeySecretPath
+	}
+	return ""
+}
+
+func sealKeyPathFromEnv() string {
+	if path := os.Getenv("MONALIAS_SEAL_KEY_FILE"); path != "" {
+		return path
+	}
+	if fileExists(sealKeySecretPath) {
+		return sealKeySecretPath
+	}
+	return ""
+}
+
 func getenvDefault(key, val string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -127,6 +291,56 @@ func getenvDuration(key string, def time.Duration) time.Duration {
 	return def
 }
 
+// parsePrefixes parses a comma-separated list of CIDRs. A bare address is
+// taken as a single-host prefix.
+func parsePrefixes(v string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, field := range strings.Split(v, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, err
+			}
+			addr = addr.Unmap()
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, prefix.Masked())
+	}
+	return out, nil
+}
+
+// parseReservedNames normalizes the comma-separated MONALIAS_RESERVED_NAMES,
+// falling back to names.DefaultReserved when it is unset. Set but empty, it
+// reserves nothing.
+func parseReservedNames() ([]string, error) {
+	v, ok := os.LookupEnv("MONALIAS_RESERVED_NAMES")
+	if !ok {
+		return names.DefaultReserved, nil
+	}
+	var out []string
+	for _, field := range strings.Split(v, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, err := names.Local(field)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", field, err)
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
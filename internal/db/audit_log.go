@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// AuditEntry is one row of the append-only audit_log. OldValue and NewValue
+// hold JSON snapshots of the fields a mutation changed.
+type AuditEntry struct {
+	ID         int64
+	CreatedAt  time.Time
+	Principal  string
+	Mutation   string
+	TargetType sql.NullString
+	TargetID   sql.NullString
+	OldValue   sql.NullString
+	NewValue   sql.NullString
+}
+
+type AuditFilter struct {
+	Principal  string
+	Mutation   string
+	TargetType string
+	TargetID   string
+	Since      sql.NullTime
+	Until      sql.NullTime
+}
+
+// sqliteTimeFormat matches what CURRENT_TIMESTAMP stores, so range filters
+// compare like with like.
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+const auditColumns = `id, created_at, principal, mutation, target_type, target_id, old_value, new_value`
+
+func scanAuditEntry(row rowScanner) (AuditEntry, error) {
+	var e AuditEntry
+	if err := row.Scan(&e.ID, &e.CreatedAt, &e.Principal, &e.Mutation, &e.TargetType, &e.TargetID, &e.OldValue, &e.NewValue); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+func (d *DB) InsertAuditEntry(ctx context.Context, principal, mutation string, targetType, targetID, oldValue, newValue sql.NullString) (AuditEntry, error) {
+	row := d.q.QueryRowContext(ctx, `INSERT INTO audit_log (principal, mutation, target_type, target_id, old_value, new_value) VALUES (?, ?, ?, ?, ?, ?) RETURNING `+auditColumns,
+		principal, mutation, targetType, targetID, oldValue, newValue,
+	)
+	return scanAuditEntry(row)
+}
+
+func (f AuditFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.Principal != "" {
+		conds = append(conds, "principal = ?")
+		args = append(args, f.Principal)
+	}
+	if f.Mutation != "" {
+		conds = append(conds, "mutation = ?")
+		args = append(args, f.Mutation)
+	}
+	if f.TargetType != "" {
+		conds = append(conds, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		conds = append(conds, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.Since.Valid {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, f.Since.Time.UTC().Format(sqliteTimeFormat))
+	}
+	if f.Until.Valid {
+		conds = append(conds, "created_at < ?")
+		args = append(args, f.Until.Time.UTC().Format(sqliteTimeFormat))
+	}
+	if len(conds) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// ListAuditLog returns up to limit entries matching filter, newest first.
+// beforeID is the pagination cursor: only entries with a smaller id are
+// returned when it is non-zero.
+func (d *DB) ListAuditLog(ctx context.Context, filter AuditFilter, beforeID int64, limit int) ([]AuditEntry, error) {
+	where, args := filter.where()
+	if beforeID > 0 {
+		where += " AND id < ?"
+		args = append(args, beforeID)
+	}
+	args = append(args, limit)
+
+	rows, err := d.q.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_log WHERE `+where+` ORDER BY id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// EachAuditEntry streams every entry matching filter, oldest first.
+func (d *DB) EachAuditEntry(ctx context.Context, filter AuditFilter, fn func(AuditEntry) error) error {
+	where, args := filter.where()
+	rows, err := d.q.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_log WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
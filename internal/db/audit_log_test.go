@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newTestAlias creates bob$example.com with the alias bob+coffee and returns
+// the alias.
+func newTestAlias(t *testing.T, database *DB) Alias {
+	t.Helper()
+	ctx := context.Background()
+	account, err := database.CreateAccount(ctx, "bob$example.com", sql.NullString{}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias, err := database.CreateAlias(ctx, account.ID, "bob+coffee$example.com", "coffee", "DYNAMIC_SUBADDRESS", sql.NullString{}, sql.NullInt64{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alias
+}
+
+func auditEntries(t *testing.T, database *DB) int {
+	t.Helper()
+	var n int
+	if err := database.SQL().QueryRow(`SELECT COUNT(*) FROM audit_log`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// deleteAudited deletes the alias and writes its audit entry in one
+// transaction, the way the admin API does, then returns fail.
+func deleteAudited(ctx context.Context, database *DB, id int64, fail error) error {
+	return database.InTx(ctx, func(tx *DB) error {
+		if err := tx.DeleteAlias(ctx, id); err != nil {
+			return err
+		}
+		if _, err := tx.InsertAuditEntry(ctx, "tester", "deleteAlias", sql.NullString{String: "alias", Valid: true}, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+			return err
+		}
+		return fail
+	})
+}
+
+func TestAuditEntryCommitsWithMutation(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDB(t)
+	alias := newTestAlias(t, database)
+
+	// A failure after both writes rolls back both.
+	boom := errors.New("boom")
+	if err := deleteAudited(ctx, database, alias.ID, boom); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := database.GetAliasByID(ctx, alias.ID); err != nil {
+		t.Errorf("alias deleted by a rolled back transaction: %v", err)
+	}
+	if n := auditEntries(t, database); n != 0 {
+		t.Errorf("%d audit entries from a rolled back transaction", n)
+	}
+
+	// So does a failing audit write.
+	if _, err := database.SQL().Exec(`CREATE TRIGGER audit_down BEFORE INSERT ON audit_log BEGIN SELECT RAISE(ABORT, 'audit down'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteAudited(ctx, database, alias.ID, nil); err == nil || !strings.Contains(err.Error(), "audit down") {
+		t.Fatalf("err = %v; want the audit write's", err)
+	}
+	if _, err := database.GetAliasByID(ctx, alias.ID); err != nil {
+		t.Errorf("alias deleted without its audit entry: %v", err)
+	}
+
+	if _, err := database.SQL().Exec(`DROP TRIGGER audit_down`); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteAudited(ctx, database, alias.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.GetAliasByID(ctx, alias.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("alias not deleted: %v", err)
+	}
+	if n := auditEntries(t, database); n != 1 {
+		t.Errorf("%d audit entries; want 1", n)
+	}
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDB(t)
+	entry, err := database.InsertAuditEntry(ctx, "tester", "createAccount", sql.NullString{}, sql.NullString{}, sql.NullString{}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range []string{
+		`UPDATE audit_log SET principal = 'mallory' WHERE id = ?`,
+		`DELETE FROM audit_log WHERE id = ?`,
+	} {
+		if _, err := database.SQL().Exec(stmt, entry.ID); err == nil || !strings.Contains(err.Error(), "append-only") {
+			t.Errorf("%s: err = %v; want append-only", stmt, err)
+		}
+	}
+	entries, err := database.ListAuditLog(ctx, AuditFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Principal != "tester" {
+		t.Errorf("audit log = %+v", entries)
+	}
+}
+
+func TestDeleteMissing(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDB(t)
+	alias := newTestAlias(t, database)
+
+	if err := database.DeleteAlias(ctx, alias.ID+1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("DeleteAlias of a missing alias: err = %v; want sql.ErrNoRows", err)
+	}
+	if err := database.DeleteAccount(ctx, alias.AccountID+1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("DeleteAccount of a missing account: err = %v; want sql.ErrNoRows", err)
+	}
+	if err := database.DeleteAccount(ctx, alias.AccountID); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteAlias(ctx, alias.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("DeleteAlias after the cascade: err = %v; want sql.ErrNoRows", err)
+	}
+}
@@ -12,24 +12,82 @@ import (
 
 type DB struct {
 	sql *sql.DB
+	// q runs queries: the pool itself, or tx for a DB handed out by InTx.
+	q  querier
+	tx *sql.Tx
 }
 
-type InstanceConfig struct {
-	ID                  int64
-	Domain              string
-	Homeserver          string
-	SigningKeyID        string
-	SigningPubkey       string
-	Status              string
-	StatusReason        sql.NullString
-	LastIdentityCheckAt sql.NullTime
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
+// Networks an alias can carry an address for.
+const (
+	NetworkMainnet  = "mainnet"
+	NetworkStagenet = "stagenet"
+)
+
+var Networks = []string{NetworkMainnet, NetworkStagenet}
+
+// Account catch-all modes. An account without a mode follows its domain's
+// catch-all.
+const (
+	// CatchAllOff answers alias_not_found for the account's unknown aliases,
+	// even when the domain has a catch-all.
+	CatchAllOff = "OFF"
+	// CatchAllDefaultAlias resolves the account's unknown aliases as its
+	// default alias.
+	CatchAllDefaultAlias = "DEFAULT_ALIAS"
+	// CatchAllAddress serves the account's own catch-all address.
+	CatchAllAddress = "ADDRESS"
+	// CatchAllProvision creates a dynamic alias for an unknown +label on
+	// its first resolve, and otherwise behaves like CatchAllDefaultAlias.
+	CatchAllProvision = "PROVISION"
+)
+
 type Account struct {
-	ID         int64
-	Handle     string
-	WalletName sql.NullString
-	CreatedAt  time.Time
+	ID                      int64
+	Handle                  string
+	WalletName              sql.NullString
+	StagenetWalletName      sql.NullString
+	CreatedAt               time.Time
+	CatchAllMode            sql.NullString
+	CatchAllAddress         sql.NullString
+	CatchAllStagenetAddress sql.NullString
+}
+
+const accountColumns = `id, handle, wallet_name, stagenet_wallet_name, created_at, catchall_mode, catchall_address, catchall_stagenet_address`
+
+func scanAccount(row rowScanner) (Account, error) {
+	var a Account
+	if err := row.Scan(&a.ID, &a.Handle, &a.WalletName, &a.StagenetWalletName, &a.CreatedAt, &a.CatchAllMode, &a.CatchAllAddress, &a.CatchAllStagenetAddress); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// WalletFor returns the wallet-rpc wallet bound to the account on network.
+func (a Account) WalletFor(network string) sql.NullString {
+	switch network {
+	case NetworkMainnet:
+		return a.WalletName
+	case NetworkStagenet:
+		return a.StagenetWalletName
+	}
+	return sql.NullString{}
+}
+
+// CatchAllFor returns the account's catch-all address on network.
+func (a Account) CatchAllFor(network string) sql.NullString {
+	switch network {
+	case NetworkMainnet:
+		return a.CatchAllAddress
+	case NetworkStagenet:
+		return a.CatchAllStagenetAddress
+	}
+	return sql.NullString{}
 }
 
 type Alias struct {
@@ -40,76 +98,83 @@ type Alias struct {
 	Mode           string
 	StaticAddress  sql.NullString
 	NextSubaddrIdx sql.NullInt64
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	// Stagenet counterparts of StaticAddress and NextSubaddrIdx.
+	StagenetAddress        sql.NullString
+	StagenetNextSubaddrIdx sql.NullInt64
+	TTLSeconds             sql.NullInt64
+	// Enabled is false for aliases an admin has switched off; resolve then
+	// treats them as if they did not exist.
+	Enabled bool
+	// RateLimitPerMinute caps resolves of the alias. NULL falls back to the
+	// instance default; 0 means unlimited.
+	RateLimitPerMinute sql.NullInt64
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
 }
 
-func Open(path string) (*DB, error) {
-	db, err := sql.Open("sqlite", path)
-	if err != nil {
-		return nil, err
-	}
-	if _, err := db.Exec("PRAGMA foreign_keys = ON;"); err != nil {
-		return nil, err
+const aliasColumns = `id, account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx, stagenet_address, stagenet_next_subaddr_idx, ttl_seconds, enabled, rate_limit_per_minute, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAlias(row rowScanner) (Alias, error) {
+	var a Alias
+	if err := row.Scan(&a.ID, &a.AccountID, &a.FullAcct, &a.AliasLabel, &a.Mode, &a.StaticAddress, &a.NextSubaddrIdx, &a.StagenetAddress, &a.StagenetNextSubaddrIdx, &a.TTLSeconds, &a.Enabled, &a.RateLimitPerMinute, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return a, err
 	}
-	return &DB{sql: db}, nil
+	return a, nil
 }
 
-func (d *DB) Close() error {
-	return d.sql.Close()
+// AddressFor returns the alias's stored address and next subaddress index on
+// network.
+func (a Alias) AddressFor(network string) (sql.NullString, sql.NullInt64) {
+	switch network {
+	case NetworkMainnet:
+		return a.StaticAddress, a.NextSubaddrIdx
+	case NetworkStagenet:
+		return a.StagenetAddress, a.StagenetNextSubaddrIdx
+	}
+	return sql.NullString{}, sql.NullInt64{}
 }
 
-func (d *DB) InitSchema(ctx context.Context, schema string) error {
-	if schema == "" {
-		return errors.New("schema is empty")
+// aliasNetworkColumns names the alias columns holding address state for
+// network.
+func aliasNetworkColumns(network string) (addrCol, idxCol string, err error) {
+	switch network {
+	case NetworkMainnet:
+		return "static_address", "next_subaddr_idx", nil
+	case NetworkStagenet:
+		return "stagenet_address", "stagenet_next_subaddr_idx", nil
 	}
-	_, err := d.sql.ExecContext(ctx, schema)
-	return err
+	return "", "", fmt.Errorf("unknown network %q", network)
 }
 
-func (d *DB) GetInstanceConfig(ctx context.Context) (InstanceConfig, error) {
-	row := d.sql.QueryRowContext(ctx, `SELECT id, domain, homeserver, signing_key_id, signing_pubkey, status, status_reason, last_identity_check_at FROM instance_config WHERE id = 1`)
-	var cfg InstanceConfig
-	if err := row.Scan(&cfg.ID, &cfg.Domain, &cfg.Homeserver, &cfg.SigningKeyID, &cfg.SigningPubkey, &cfg.Status, &cfg.StatusReason, &cfg.LastIdentityCheckAt); err != nil {
-		return cfg, err
+func Open(path string) (*DB, error) {
+	// Pragmas go in the DSN so every pooled connection gets them, not just
+	// the first one. busy_timeout lets concurrent writers wait for the lock
+	// instead of failing with SQLITE_BUSY.
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
 	}
-	return cfg, nil
-}
-
-func (d *DB) UpsertInstanceConfig(ctx context.Context, domain, homeserver, keyID, pubkey, status string, statusReason sql.NullString, lastCheck sql.NullTime) (InstanceConfig, error) {
-	row := d.sql.QueryRowContext(ctx, `INSERT INTO instance_config (id, domain, homeserver, signing_key_id, signing_pubkey, status, status_reason, last_identity_check_at)
-VALUES (1, ?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT(id) DO UPDATE SET
-  domain=excluded.domain,
-  homeserver=excluded.homeserver,
-  signing_key_id=excluded.signing_key_id,
-  signing_pubkey=excluded.signing_pubkey,
-  status=excluded.status,
-  status_reason=excluded.status_reason,
-  last_identity_check_at=excluded.last_identity_check_at
-RETURNING id, domain, homeserver, signing_key_id, signing_pubkey, status, status_reason, last_identity_check_at`,
-		domain, homeserver, keyID, pubkey, status, statusReason, lastCheck,
-	)
-	var cfg InstanceConfig
-	if err := row.Scan(&cfg.ID, &cfg.Domain, &cfg.Homeserver, &cfg.SigningKeyID, &cfg.SigningPubkey, &cfg.Status, &cfg.StatusReason, &cfg.LastIdentityCheckAt); err != nil {
-		return cfg, err
+	if err := db.Ping(); err != nil {
+		return nil, err
 	}
-	return cfg, nil
+	return &DB{sql: db, q: db}, nil
 }
 
-func (d *DB) UpdateInstanceStatus(ctx context.Context, status string, reason sql.NullString, lastCheck sql.NullTime) (InstanceConfig, error) {
-	row := d.sql.QueryRowContext(ctx, `UPDATE instance_config SET status = ?, status_reason = ?, last_identity_check_at = ? WHERE id = 1 RETURNING id, domain, homeserver, signing_key_id, signing_pubkey, status, status_reason, last_identity_check_at`,
-		status, reason, lastCheck,
-	)
-	var cfg InstanceConfig
-	if err := row.Scan(&cfg.ID, &cfg.Domain, &cfg.Homeserver, &cfg.SigningKeyID, &cfg.SigningPubkey, &cfg.Status, &cfg.StatusReason, &cfg.LastIdentityCheckAt); err != nil {
-		return cfg, err
-	}
-	return cfg, nil
+func (d *DB) Close() error {
+	return d.sql.Close()
+}
+
+// Ping checks that the database can still be reached.
+func (d *DB) Ping(ctx context.Context) error {
+	return d.sql.PingContext(ctx)
 }
 
 func (d *DB) ListAccounts(ctx context.Context) ([]Account, error) {
-	rows, err := d.sql.QueryContext(ctx, `SELECT id, handle, wallet_name, created_at FROM accounts ORDER BY created_at`)
+	rows, err := d.q.QueryContext(ctx, `SELECT `+accountColumns+` FROM accounts ORDER BY created_at`)
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +182,8 @@ func (d *DB) ListAccounts(ctx context.Context) ([]Account, error) {
 
 	var out []Account
 	for rows.Next() {
-		var a Account
-		if err := rows.Scan(&a.ID, &a.Handle, &a.WalletName, &a.CreatedAt); err != nil {
+		a, err := scanAccount(rows)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, a)
@@ -127,39 +192,69 @@ func (d *DB) ListAccounts(ctx context.Context) ([]Account, error) {
 }
 
 func (d *DB) GetAccount(ctx context.Context, id int64) (Account, error) {
-	row := d.sql.QueryRowContext(ctx, `SELECT id, handle, wallet_name, created_at FROM accounts WHERE id = ?`, id)
-	var a Account
-	if err := row.Scan(&a.ID, &a.Handle, &a.WalletName, &a.CreatedAt); err != nil {
-		return a, err
-	}
-	return a, nil
+	row := d.q.QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE id = ?`, id)
+	return scanAccount(row)
 }
 
 func (d *DB) GetAccountByHandle(ctx context.Context, handle string) (Account, error) {
-	row := d.sql.QueryRowContext(ctx, `SELECT id, handle, wallet_name, created_at FROM accounts WHERE handle = ?`, handle)
-	var a Account
-	if err := row.Scan(&a.ID, &a.Handle, &a.WalletName, &a.CreatedAt); err != nil {
-		return a, err
+	row := d.q.QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE handle = ?`, handle)
+	return scanAccount(row)
+}
+
+func (d *DB) CreateAccount(ctx context.Context, handle string, walletName, stagenetWalletName sql.NullString) (Account, error) {
+	row := d.q.QueryRowContext(ctx, `INSERT INTO accounts (handle, wallet_name, stagenet_wallet_name) VALUES (?, ?, ?) RETURNING `+accountColumns, handle, walletName, stagenetWalletName)
+	return scanAccount(row)
+}
+
+func (d *DB) UpdateAccountWallet(ctx context.Context, id int64, network string, walletName sql.NullString) (Account, error) {
+	var column string
+	switch network {
+	case NetworkMainnet:
+		column = "wallet_name"
+	case NetworkStagenet:
+		column = "stagenet_wallet_name"
+	default:
+		return Account{}, fmt.Errorf("unknown network %q", network)
 	}
-	return a, nil
+	row := d.q.QueryRowContext(ctx, `UPDATE accounts SET `+column+` = ? WHERE id = ? RETURNING `+accountColumns, walletName, id)
+	return scanAccount(row)
 }
 
-func (d *DB) CreateAccount(ctx context.Context, handle string, walletName sql.NullString) (Account, error) {
-	row := d.sql.QueryRowContext(ctx, `INSERT INTO accounts (handle, wallet_name) VALUES (?, ?) RETURNING id, handle, wallet_name, created_at`, handle, walletName)
-	var a Account
-	if err := row.Scan(&a.ID, &a.Handle, &a.WalletName, &a.CreatedAt); err != nil {
-		return a, err
+// UpdateAccountCatchAllMode sets the account's catch-all mode; a NULL mode
+// makes it follow the domain's catch-all.
+func (d *DB) UpdateAccountCatchAllMode(ctx context.Context, id int64, mode sql.NullString) (Account, error) {
+	row := d.q.QueryRowContext(ctx, `UPDATE accounts SET catchall_mode = ? WHERE id = ? RETURNING `+accountColumns, mode, id)
+	return scanAccount(row)
+}
+
+// UpdateAccountCatchAll sets the address the account serves on network in
+// ADDRESS mode.
+func (d *DB) UpdateAccountCatchAll(ctx context.Context, id int64, network string, address sql.NullString) (Account, error) {
+	var column string
+	switch network {
+	case NetworkMainnet:
+		column = "catchall_address"
+	case NetworkStagenet:
+		column = "catchall_stagenet_address"
+	default:
+		return Account{}, fmt.Errorf("unknown network %q", network)
 	}
-	return a, nil
+	row := d.q.QueryRowContext(ctx, `UPDATE accounts SET `+column+` = ? WHERE id = ? RETURNING `+accountColumns, address, id)
+	return scanAccount(row)
 }
 
+// DeleteAccount deletes the account and, by cascade, its aliases. It
+// returns sql.ErrNoRows when there is no such account.
 func (d *DB) DeleteAccount(ctx context.Context, id int64) error {
-	_, err := d.sql.ExecContext(ctx, `DELETE FROM accounts WHERE id = ?`, id)
-	return err
+	res, err := d.q.ExecContext(ctx, `DELETE FROM accounts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
 }
 
 func (d *DB) ListAliasesForAccount(ctx context.Context, accountID int64) ([]Alias, error) {
-	rows, err := d.sql.QueryContext(ctx, `SELECT id, account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx, created_at, updated_at FROM aliases WHERE account_id = ? ORDER BY created_at`, accountID)
+	rows, err := d.q.QueryContext(ctx, `SELECT `+aliasColumns+` FROM aliases WHERE account_id = ? ORDER BY created_at`, accountID)
 	if err != nil {
 		return nil, err
 	}
@@ -167,8 +262,8 @@ func (d *DB) ListAliasesForAccount(ctx context.Context, accountID int64) ([]Alia
 
 	var out []Alias
 	for rows.Next() {
-		var a Alias
-		if err := rows.Scan(&a.ID, &a.AccountID, &a.FullAcct, &a.AliasLabel, &a.Mode, &a.StaticAddress, &a.NextSubaddrIdx, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		a, err := scanAlias(rows)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, a)
@@ -177,69 +272,160 @@ func (d *DB) ListAliasesForAccount(ctx context.Context, accountID int64) ([]Alia
 }
 
 func (d *DB) GetAliasByFullAcct(ctx context.Context, fullAcct string) (Alias, error) {
-	row := d.sql.QueryRowContext(ctx, `SELECT id, account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx, created_at, updated_at FROM aliases WHERE full_acct = ?`, fullAcct)
-	var a Alias
-	if err := row.Scan(&a.ID, &a.AccountID, &a.FullAcct, &a.AliasLabel, &a.Mode, &a.StaticAddress, &a.NextSubaddrIdx, &a.CreatedAt, &a.UpdatedAt); err != nil {
-		return a, err
-	}
-	return a, nil
+	row := d.q.QueryRowContext(ctx, `SELECT `+aliasColumns+` FROM aliases WHERE full_acct = ?`, fullAcct)
+	return scanAlias(row)
 }
 
 func (d *DB) GetAliasByID(ctx context.Context, id int64) (Alias, error) {
-	row := d.sql.QueryRowContext(ctx, `SELECT id, account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx, created_at, updated_at FROM aliases WHERE id = ?`, id)
-	var a Alias
-	if err := row.Scan(&a.ID, &a.AccountID, &a.FullAcct, &a.AliasLabel, &a.Mode, &a.StaticAddress, &a.NextSubaddrIdx, &a.CreatedAt, &a.UpdatedAt); err != nil {
-		return a, err
-	}
-	return a, nil
+	row := d.q.QueryRowContext(ctx, `SELECT `+aliasColumns+` FROM aliases WHERE id = ?`, id)
+	return scanAlias(row)
 }
 
 func (d *DB) CreateAlias(ctx context.Context, accountID int64, fullAcct, aliasLabel, mode string, staticAddress sql.NullString, nextIdx sql.NullInt64) (Alias, error) {
-	row := d.sql.QueryRowContext(ctx, `INSERT INTO aliases (account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx)
-VALUES (?, ?, ?, ?, ?, ?) RETURNING id, account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx, created_at, updated_at`,
+	row := d.q.QueryRowContext(ctx, `INSERT INTO aliases (account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx)
+VALUES (?, ?, ?, ?, ?, ?) RETURNING `+aliasColumns,
 		accountID, fullAcct, aliasLabel, mode, staticAddress, nextIdx,
 	)
-	var a Alias
-	if err := row.Scan(&a.ID, &a.AccountID, &a.FullAcct, &a.AliasLabel, &a.Mode, &a.StaticAddress, &a.NextSubaddrIdx, &a.CreatedAt, &a.UpdatedAt); err != nil {
-		return a, err
+	return scanAlias(row)
+}
+
+// ErrProvisionCap is returned by CreateProvisionedAlias when the account
+// already has its maximum of provisioned aliases.
+var ErrProvisionCap = errors.New("account has reached its cap of provisioned aliases")
+
+// CreateProvisionedAlias creates the DYNAMIC_SUBADDRESS alias a PROVISION
+// resolve asks for, unless the account already has max provisioned
+// aliases. The count and the insert are one statement, so concurrent
+// resolves cannot take the account past the cap.
+func (d *DB) CreateProvisionedAlias(ctx context.Context, accountID int64, fullAcct, aliasLabel string, max int) (Alias, error) {
+	row := d.q.QueryRowContext(ctx, `INSERT INTO aliases (account_id, full_acct, alias_label, mode, provisioned)
+SELECT ?, ?, ?, 'DYNAMIC_SUBADDRESS', 1
+WHERE (SELECT COUNT(*) FROM aliases WHERE account_id = ? AND provisioned = 1) < ?
+RETURNING `+aliasColumns,
+		accountID, fullAcct, aliasLabel, accountID, max,
+	)
+	alias, err := scanAlias(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Alias{}, ErrProvisionCap
 	}
-	return a, nil
+	return alias, err
 }
 
-func (d *DB) UpdateAliasStaticAddress(ctx context.Context, id int64, address sql.NullString) (Alias, error) {
-	row := d.sql.QueryRowContext(ctx, `UPDATE aliases SET static_address = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING id, account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx, created_at, updated_at`,
+func (d *DB) UpdateAliasStaticAddress(ctx context.Context, id int64, network string, address sql.NullString) (Alias, error) {
+	addrCol, _, err := aliasNetworkColumns(network)
+	if err != nil {
+		return Alias{}, err
+	}
+	row := d.q.QueryRowContext(ctx, `UPDATE aliases SET `+addrCol+` = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING `+aliasColumns,
 		address, id,
 	)
-	var a Alias
-	if err := row.Scan(&a.ID, &a.AccountID, &a.FullAcct, &a.AliasLabel, &a.Mode, &a.StaticAddress, &a.NextSubaddrIdx, &a.CreatedAt, &a.UpdatedAt); err != nil {
-		return a, err
-	}
-	return a, nil
+	return scanAlias(row)
 }
 
 func (d *DB) UpdateAliasMode(ctx context.Context, id int64, mode string) (Alias, error) {
-	row := d.sql.QueryRowContext(ctx, `UPDATE aliases SET mode = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING id, account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx, created_at, updated_at`,
+	row := d.q.QueryRowContext(ctx, `UPDATE aliases SET mode = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING `+aliasColumns,
 		mode, id,
 	)
-	var a Alias
-	if err := row.Scan(&a.ID, &a.AccountID, &a.FullAcct, &a.AliasLabel, &a.Mode, &a.StaticAddress, &a.NextSubaddrIdx, &a.CreatedAt, &a.UpdatedAt); err != nil {
-		return a, err
-	}
-	return a, nil
+	return scanAlias(row)
 }
 
-func (d *DB) UpdateAliasNextIndex(ctx context.Context, id int64, nextIdx sql.NullInt64) (Alias, error) {
-	row := d.sql.QueryRowContext(ctx, `UPDATE aliases SET next_subaddr_idx = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING id, account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx, created_at, updated_at`,
+func (d *DB) UpdateAliasNextIndex(ctx context.Context, id int64, network string, nextIdx sql.NullInt64) (Alias, error) {
+	_, idxCol, err := aliasNetworkColumns(network)
+	if err != nil {
+		return Alias{}, err
+	}
+	row := d.q.QueryRowContext(ctx, `UPDATE aliases SET `+idxCol+` = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING `+aliasColumns,
 		nextIdx, id,
 	)
-	var a Alias
-	if err := row.Scan(&a.ID, &a.AccountID, &a.FullAcct, &a.AliasLabel, &a.Mode, &a.StaticAddress, &a.NextSubaddrIdx, &a.CreatedAt, &a.UpdatedAt); err != nil {
-		return a, err
+	return scanAlias(row)
+}
+
+// RenameAlias changes the alias label together with the full_acct derived
+// from it.
+func (d *DB) RenameAlias(ctx context.Context, id int64, fullAcct, aliasLabel string) (Alias, error) {
+	row := d.q.QueryRowContext(ctx, `UPDATE aliases SET full_acct = ?, alias_label = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING `+aliasColumns,
+		fullAcct, aliasLabel, id,
+	)
+	return scanAlias(row)
+}
+
+func (d *DB) SetAliasEnabled(ctx context.Context, id int64, enabled bool) (Alias, error) {
+	row := d.q.QueryRowContext(ctx, `UPDATE aliases SET enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING `+aliasColumns,
+		enabled, id,
+	)
+	return scanAlias(row)
+}
+
+// DeleteAlias deletes the alias. It returns sql.ErrNoRows when there is no
+// such alias.
+func (d *DB) DeleteAlias(ctx context.Context, id int64) error {
+	res, err := d.q.ExecContext(ctx, `DELETE FROM aliases WHERE id = ?`, id)
+	if err != nil {
+		return err
 	}
-	return a, nil
+	return requireRow(res)
+}
+
+// requireRow returns sql.ErrNoRows when res affected no rows.
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateAliasTTL sets how long resolve responses for the alias may be cached.
+// A NULL ttl falls back to the instance default.
+func (d *DB) UpdateAliasTTL(ctx context.Context, id int64, ttl sql.NullInt64) (Alias, error) {
+	row := d.q.QueryRowContext(ctx, `UPDATE aliases SET ttl_seconds = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING `+aliasColumns,
+		ttl, id,
+	)
+	return scanAlias(row)
+}
+
+// UpdateAliasRateLimit sets how many resolves per minute the alias allows.
+// A NULL limit falls back to the instance default.
+func (d *DB) UpdateAliasRateLimit(ctx context.Context, id int64, perMinute sql.NullInt64) (Alias, error) {
+	row := d.q.QueryRowContext(ctx, `UPDATE aliases SET rate_limit_per_minute = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING `+aliasColumns,
+		perMinute, id,
+	)
+	return scanAlias(row)
+}
+
+// AdvanceAliasSubaddress records that the wallet has handed out address, at
+// subaddress index issuedIdx, for the alias on network. The stored next index
+// only ever moves forward, so concurrent resolves committing out of order
+// cannot rewind it, and the stored address stays the one issued last.
+func (d *DB) AdvanceAliasSubaddress(ctx context.Context, id int64, network, address string, issuedIdx int64) (Alias, error) {
+	addrCol, idxCol, err := aliasNetworkColumns(network)
+	if err != nil {
+		return Alias{}, err
+	}
+	row := d.q.QueryRowContext(ctx, `UPDATE aliases SET
+`+addrCol+` = CASE WHEN ? >= COALESCE(`+idxCol+`, 0) THEN ? ELSE `+addrCol+` END,
+`+idxCol+` = MAX(COALESCE(`+idxCol+`, 0), ?),
+updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING `+aliasColumns,
+		issuedIdx+1, address, issuedIdx+1, id,
+	)
+	return scanAlias(row)
+}
+
+// InTx runs fn with a DB whose queries all run in one transaction. Calling it
+// on a DB that is already in a transaction joins that transaction.
+func (d *DB) InTx(ctx context.Context, fn func(tx *DB) error) error {
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		return fn(&DB{sql: d.sql, q: tx, tx: tx})
+	})
 }
 
 func (d *DB) WithTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	if d.tx != nil {
+		return fn(d.tx)
+	}
 	tx, err := d.sql.BeginTx(ctx, nil)
 	if err != nil {
 		return err
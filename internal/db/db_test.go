@@ -0,0 +1,22 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB opens a fresh database in a temporary directory with every
+// migration applied.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	database, err := Open(filepath.Join(t.TempDir(), "monalias.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Domain is one domain the instance serves aliases for. Each domain has its
+// own homeserver, signing key ring, catch-all addresses and identity status,
+// so a problem with one domain never affects the others.
+type Domain struct {
+	// Domain is the lowercase domain name, as used in acct IDs.
+	Domain     string
+	Homeserver string
+	// SigningKeyID mirrors the domain's ACTIVE key and is maintained by
+	// ActivateSigningKey.
+	SigningKeyID            sql.NullString
+	CatchAllAddress         sql.NullString
+	CatchAllStagenetAddress sql.NullString
+	Status                  string
+	StatusReason            sql.NullString
+	LastIdentityCheckAt     sql.NullTime
+	CreatedAt               time.Time
+}
+
+const domainColumns = `domain, homeserver, signing_key_id, catchall_address, catchall_stagenet_address, status, status_reason, last_identity_check_at, created_at`
+
+func scanDomain(row rowScanner) (Domain, error) {
+	var d Domain
+	if err := row.Scan(&d.Domain, &d.Homeserver, &d.SigningKeyID, &d.CatchAllAddress, &d.CatchAllStagenetAddress, &d.Status, &d.StatusReason, &d.LastIdentityCheckAt, &d.CreatedAt); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// CatchAllFor returns the address served for unknown aliases of the domain
+// on network.
+func (d Domain) CatchAllFor(network string) sql.NullString {
+	switch network {
+	case NetworkMainnet:
+		return d.CatchAllAddress
+	case NetworkStagenet:
+		return d.CatchAllStagenetAddress
+	}
+	return sql.NullString{}
+}
+
+func (d *DB) ListDomains(ctx context.Context) ([]Domain, error) {
+	rows, err := d.q.QueryContext(ctx, `SELECT `+domainColumns+` FROM domains ORDER BY created_at, domain`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Domain
+	for rows.Next() {
+		dom, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dom)
+	}
+	return out, rows.Err()
+}
+
+func (d *DB) GetDomain(ctx context.Context, domain string) (Domain, error) {
+	row := d.q.QueryRowContext(ctx, `SELECT `+domainColumns+` FROM domains WHERE domain = ?`, domain)
+	return scanDomain(row)
+}
+
+// CreateDomain adds a domain with status OK and no signing key; the key is
+// attached by activating one with ActivateSigningKey.
+func (d *DB) CreateDomain(ctx context.Context, domain, homeserver string) (Domain, error) {
+	row := d.q.QueryRowContext(ctx, `INSERT INTO domains (domain, homeserver) VALUES (?, ?) RETURNING `+domainColumns, domain, homeserver)
+	return scanDomain(row)
+}
+
+func (d *DB) UpdateDomainHomeserver(ctx context.Context, domain, homeserver string) (Domain, error) {
+	row := d.q.QueryRowContext(ctx, `UPDATE domains SET homeserver = ? WHERE domain = ? RETURNING `+domainColumns, homeserver, domain)
+	return scanDomain(row)
+}
+
+// UpdateDomainCatchAll sets the domain's catch-all address on network. A NULL
+// address turns the catch-all off.
+func (d *DB) UpdateDomainCatchAll(ctx context.Context, domain, network string, address sql.NullString) (Domain, error) {
+	var column string
+	switch network {
+	case NetworkMainnet:
+		column = "catchall_address"
+	case NetworkStagenet:
+		column = "catchall_stagenet_address"
+	default:
+		return Domain{}, fmt.Errorf("unknown network %q", network)
+	}
+	row := d.q.QueryRowContext(ctx, `UPDATE domains SET `+column+` = ? WHERE domain = ? RETURNING `+domainColumns, address, domain)
+	return scanDomain(row)
+}
+
+func (d *DB) UpdateDomainStatus(ctx context.Context, domain, status string, reason sql.NullString, lastCheck sql.NullTime) (Domain, error) {
+	row := d.q.QueryRowContext(ctx, `UPDATE domains SET status = ?, status_reason = ?, last_identity_check_at = ? WHERE domain = ? RETURNING `+domainColumns,
+		status, reason, lastCheck, domain,
+	)
+	return scanDomain(row)
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// goSteps run after the up script of the migration with the same version,
+// in its transaction, for changes SQL cannot express.
+var goSteps = map[int]func(ctx context.Context, tx *sql.Tx) error{
+	10: normalizeNames,
+}
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary does not know about.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+// Migrations returns the embedded migrations in version order. Files are
+// named NNNN_name.up.sql and NNNN_name.down.sql.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+		data, err := migrationsFS.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %04d", m.Version)
+		}
+	}
+	return out, nil
+}
+
+func (d *DB) ensureMigrationsTable(ctx context.Context) error {
+	_, err := d.sql.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	return err
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an
+// unmigrated database.
+func (d *DB) SchemaVersion(ctx context.Context) (int, error) {
+	if err := d.ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := d.sql.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+func (d *DB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]sql.NullTime)
+	rows, err := d.sql.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at sql.NullTime
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		out = append(out, MigrationStatus{Migration: m, AppliedAt: applied[m.Version]})
+	}
+	return out, nil
+}
+
+// MigrateUp applies every pending migration, each in its own transaction,
+// and returns the ones it applied. It refuses to touch a database whose
+// schema is newer than the embedded migrations.
+func (d *DB) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	current, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest := len(migrations); current > latest {
+		return nil, fmt.Errorf("%w (database at version %d, binary knows %d)", ErrSchemaTooNew, current, latest)
+	}
+
+	var applied []Migration
+	for _, m := range migrations[current:] {
+		err := d.WithTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+				return err
+			}
+			if step, ok := goSteps[m.Version]; ok {
+				if err := step(ctx, tx); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the most recently applied migration.
+func (d *DB) MigrateDown(ctx context.Context) (Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return Migration{}, err
+	}
+	current, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	if current == 0 {
+		return Migration{}, errors.New("no migrations applied")
+	}
+	if current > len(migrations) {
+		return Migration{}, fmt.Errorf("%w (database at version %d, binary knows %d)", ErrSchemaTooNew, current, len(migrations))
+	}
+
+	m := migrations[current-1]
+	if m.Down == "" {
+		return m, fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+	}
+	err = d.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+		return err
+	})
+	if err != nil {
+		return m, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	return m, nil
+}
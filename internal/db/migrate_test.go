@@ -0,0 +1,289 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openEmptyDB opens a fresh database without applying any migrations.
+func openEmptyDB(t *testing.T) *DB {
+	t.Helper()
+	database, err := Open(filepath.Join(t.TempDir(), "monalias.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func latestVersion(t *testing.T) int {
+	t.Helper()
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(migrations)
+}
+
+func schemaVersion(t *testing.T, d *DB) int {
+	t.Helper()
+	version, err := d.SchemaVersion(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+// migrateDownTo reverts migrations until d is at version.
+func migrateDownTo(t *testing.T, d *DB, version int) {
+	t.Helper()
+	for schemaVersion(t, d) > version {
+		if _, err := d.MigrateDown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// schema returns the statements that create d's tables, indexes and
+// triggers.
+func schema(t *testing.T, d *DB) string {
+	t.Helper()
+	rows, err := d.SQL().Query(`SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY type, name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, stmt)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(out, ";\n")
+}
+
+func exec(t *testing.T, d *DB, query string, args ...any) {
+	t.Helper()
+	if _, err := d.SQL().Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func TestMigrateUpFromEmpty(t *testing.T) {
+	ctx := context.Background()
+	d := openEmptyDB(t)
+	latest := latestVersion(t)
+
+	applied, err := d.MigrateUp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != latest || schemaVersion(t, d) != latest {
+		t.Fatalf("applied %d migrations, at version %d; want %d", len(applied), schemaVersion(t, d), latest)
+	}
+	if applied, err := d.MigrateUp(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("second MigrateUp applied %d, err %v", len(applied), err)
+	}
+
+	status, err := d.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range status {
+		if !m.AppliedAt.Valid {
+			t.Errorf("migration %04d_%s not recorded as applied", m.Version, m.Name)
+		}
+	}
+}
+
+// TestMigrateUpFromBaselineSchema upgrades a database created from the
+// schema the service had before migrations, which 0001 recreates with
+// IF NOT EXISTS.
+func TestMigrateUpFromBaselineSchema(t *testing.T) {
+	ctx := context.Background()
+	d := openEmptyDB(t)
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec(t, d, migrations[0].Up)
+	exec(t, d, `INSERT INTO instance_config (id, domain, homeserver, signing_key_id, signing_pubkey) VALUES (1, 'Example.com', 'https://monalias.example.com', 'k1', 'pk1')`)
+	exec(t, d, `INSERT INTO accounts (handle, wallet_name) VALUES ('bob$example.com', 'bob')`)
+	exec(t, d, `INSERT INTO aliases (account_id, full_acct, alias_label, mode) VALUES (1, 'bob+coffee$example.com', 'coffee', 'DYNAMIC_SUBADDRESS')`)
+
+	if _, err := d.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := schemaVersion(t, d); v != len(migrations) {
+		t.Fatalf("at version %d; want %d", v, len(migrations))
+	}
+	domain, err := d.GetDomain(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain.Homeserver != "https://monalias.example.com" || domain.SigningKeyID.String != "k1" {
+		t.Errorf("domain = %+v", domain)
+	}
+	alias, err := d.GetAliasByFullAcct(ctx, "bob+coffee$example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alias.Enabled || alias.AliasLabel != "coffee" {
+		t.Errorf("alias = %+v", alias)
+	}
+}
+
+// TestMigrateDownUp reverts each migration and reapplies it, and checks
+// that the schema comes back as it was.
+func TestMigrateDownUp(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t)
+	latest := latestVersion(t)
+	want := schema(t, d)
+
+	for version := latest - 1; version >= 0; version-- {
+		migrateDownTo(t, d, version)
+		if _, err := d.MigrateUp(ctx); err != nil {
+			t.Fatalf("up from %d: %v", version, err)
+		}
+		if got := schema(t, d); got != want {
+			t.Errorf("schema after down to %d and up differs:\n%s\nwant:\n%s", version, got, want)
+		}
+	}
+}
+
+// TestMigrateDown0008KeepsOldestDomain covers the lossy down script of
+// 0008, which folds the domains back into the single instance_config row.
+func TestMigrateDown0008KeepsOldestDomain(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t)
+	for _, k := range []struct{ domain, kid string }{{"example.com", "k1"}, {"example.org", "k2"}} {
+		if _, err := d.CreateDomain(ctx, k.domain, "https://"+k.domain); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.CreateSigningKey(ctx, k.domain, k.kid, "pub-"+k.kid, sql.NullString{}, SigningKeyNext); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.ActivateSigningKey(ctx, k.kid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec(t, d, `UPDATE domains SET created_at = '2020-01-01 00:00:00' WHERE domain = 'example.org'`)
+
+	migrateDownTo(t, d, 7)
+	var domain, kid, pubkey string
+	if err := d.SQL().QueryRow(`SELECT domain, signing_key_id, signing_pubkey FROM instance_config`).Scan(&domain, &kid, &pubkey); err != nil {
+		t.Fatal(err)
+	}
+	if domain != "example.org" || kid != "k2" || pubkey != "pub-k2" {
+		t.Errorf("instance_config = %s %s %s; want the oldest domain, example.org", domain, kid, pubkey)
+	}
+	var keys int
+	if err := d.SQL().QueryRow(`SELECT COUNT(*) FROM signing_keys WHERE kid = 'k1'`).Scan(&keys); err != nil {
+		t.Fatal(err)
+	}
+	if keys != 0 {
+		t.Error("the dropped domain's signing key survived the downgrade")
+	}
+
+	if _, err := d.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	domains, err := d.ListDomains(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) != 1 || domains[0].Domain != "example.org" || domains[0].SigningKeyID.String != "k2" {
+		t.Errorf("domains after upgrading again = %+v", domains)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t)
+	exec(t, d, `INSERT INTO schema_migrations (version, name) VALUES (?, 'from_the_future')`, latestVersion(t)+1)
+
+	if _, err := d.MigrateUp(ctx); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("MigrateUp err = %v; want ErrSchemaTooNew", err)
+	}
+	if _, err := d.MigrateDown(ctx); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("MigrateDown err = %v; want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrate0010NormalizesNames(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t)
+	migrateDownTo(t, d, 9)
+	exec(t, d, `INSERT INTO accounts (handle) VALUES ('Bob$Example.COM')`)
+	exec(t, d, `INSERT INTO aliases (account_id, full_acct, alias_label, mode) VALUES (1, 'Bob+Coffee$Example.COM', 'Coffee', 'DYNAMIC_SUBADDRESS')`)
+
+	if _, err := d.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetAccountByHandle(ctx, "bob$example.com"); err != nil {
+		t.Errorf("handle not normalized: %v", err)
+	}
+	alias, err := d.GetAliasByFullAcct(ctx, "bob+coffee$example.com")
+	if err != nil {
+		t.Fatalf("alias not normalized: %v", err)
+	}
+	if alias.AliasLabel != "coffee" {
+		t.Errorf("label = %q; want coffee", alias.AliasLabel)
+	}
+
+	// A collision fails the migration and leaves the rows as they were.
+	migrateDownTo(t, d, 9)
+	exec(t, d, `INSERT INTO accounts (handle) VALUES ('BOB$example.com')`)
+	_, err = d.MigrateUp(ctx)
+	if err == nil || !strings.Contains(err.Error(), "BOB$example.com") {
+		t.Fatalf("MigrateUp err = %v; want the colliding handle listed", err)
+	}
+	if v := schemaVersion(t, d); v != 9 {
+		t.Errorf("at version %d after the failed migration; want 9", v)
+	}
+	if _, err := d.GetAccountByHandle(ctx, "BOB$example.com"); err != nil {
+		t.Errorf("colliding handle changed: %v", err)
+	}
+}
+
+// TestMigrateGoStepRollsBack checks that a failing Go step undoes its
+// migration's up script too.
+func TestMigrateGoStepRollsBack(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t)
+	migrateDownTo(t, d, 9)
+
+	step := goSteps[10]
+	t.Cleanup(func() { goSteps[10] = step })
+	var called bool
+	goSteps[10] = func(ctx context.Context, tx *sql.Tx) error {
+		called = true
+		if _, err := tx.ExecContext(ctx, `INSERT INTO accounts (handle) VALUES ('carol$example.com')`); err != nil {
+			return err
+		}
+		return errors.New("step failed")
+	}
+
+	if _, err := d.MigrateUp(ctx); err == nil || !strings.Contains(err.Error(), "step failed") {
+		t.Fatalf("MigrateUp err = %v; want the step's error", err)
+	}
+	if !called {
+		t.Fatal("goSteps[10] was not run")
+	}
+	if v := schemaVersion(t, d); v != 9 {
+		t.Errorf("at version %d; want 9", v)
+	}
+	if _, err := d.GetAccountByHandle(ctx, "carol$example.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("the failed step's write survived: %v", err)
+	}
+}
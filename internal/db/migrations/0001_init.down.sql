@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS aliases;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS instance_config;
@@ -0,0 +1 @@
+ALTER TABLE aliases ADD COLUMN ttl_seconds INTEGER;
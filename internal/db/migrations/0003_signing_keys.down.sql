@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS signing_keys_single_active;
+DROP TABLE IF EXISTS signing_keys;
@@ -0,0 +1,11 @@
+CREATE TABLE signing_keys (
+  kid TEXT PRIMARY KEY,
+  public_key TEXT NOT NULL,
+  private_seed TEXT,
+  state TEXT NOT NULL CHECK (state IN ('NEXT', 'ACTIVE', 'RETIRED', 'REVOKED')),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  activated_at DATETIME,
+  retired_at DATETIME
+);
+
+CREATE UNIQUE INDEX signing_keys_single_active ON signing_keys(state) WHERE state = 'ACTIVE';
@@ -0,0 +1,3 @@
+ALTER TABLE aliases DROP COLUMN stagenet_next_subaddr_idx;
+ALTER TABLE aliases DROP COLUMN stagenet_address;
+ALTER TABLE accounts DROP COLUMN stagenet_wallet_name;
@@ -0,0 +1,3 @@
+ALTER TABLE accounts ADD COLUMN stagenet_wallet_name TEXT;
+ALTER TABLE aliases ADD COLUMN stagenet_address TEXT;
+ALTER TABLE aliases ADD COLUMN stagenet_next_subaddr_idx INTEGER;
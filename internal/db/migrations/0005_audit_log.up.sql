@@ -0,0 +1,22 @@
+CREATE TABLE audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  principal TEXT NOT NULL,
+  mutation TEXT NOT NULL,
+  target_type TEXT,
+  target_id TEXT,
+  old_value TEXT,
+  new_value TEXT
+);
+
+CREATE INDEX audit_log_target ON audit_log(target_type, target_id);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
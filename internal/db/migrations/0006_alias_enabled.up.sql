@@ -0,0 +1 @@
+ALTER TABLE aliases ADD COLUMN enabled INTEGER NOT NULL DEFAULT 1;
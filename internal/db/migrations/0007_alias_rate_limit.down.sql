@@ -0,0 +1 @@
+ALTER TABLE aliases DROP COLUMN rate_limit_per_minute;
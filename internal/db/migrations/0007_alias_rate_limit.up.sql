@@ -0,0 +1 @@
+ALTER TABLE aliases ADD COLUMN rate_limit_per_minute INTEGER;
@@ -0,0 +1,25 @@
+CREATE TABLE instance_config (
+  id INTEGER PRIMARY KEY CHECK (id = 1),
+  domain TEXT NOT NULL,
+  homeserver TEXT NOT NULL,
+  signing_key_id TEXT NOT NULL,
+  signing_pubkey TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'OK',
+  status_reason TEXT,
+  last_identity_check_at DATETIME
+);
+
+-- Only the oldest domain survives the downgrade, with its keys.
+INSERT INTO instance_config (id, domain, homeserver, signing_key_id, signing_pubkey, status, status_reason, last_identity_check_at)
+SELECT 1, d.domain, d.homeserver, COALESCE(d.signing_key_id, ''), COALESCE(k.public_key, ''), d.status, d.status_reason, d.last_identity_check_at
+FROM domains d LEFT JOIN signing_keys k ON k.kid = d.signing_key_id
+ORDER BY d.created_at, d.domain
+LIMIT 1;
+
+DELETE FROM signing_keys WHERE domain IS NOT (SELECT domain FROM instance_config);
+
+DROP INDEX signing_keys_single_active;
+CREATE UNIQUE INDEX signing_keys_single_active ON signing_keys(state) WHERE state = 'ACTIVE';
+ALTER TABLE signing_keys DROP COLUMN domain;
+
+DROP TABLE domains;
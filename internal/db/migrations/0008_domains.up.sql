@@ -0,0 +1,25 @@
+CREATE TABLE domains (
+  domain TEXT PRIMARY KEY,
+  homeserver TEXT NOT NULL,
+  signing_key_id TEXT,
+  catchall_address TEXT,
+  catchall_stagenet_address TEXT,
+  status TEXT NOT NULL DEFAULT 'OK',
+  status_reason TEXT,
+  last_identity_check_at DATETIME,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO domains (domain, homeserver, signing_key_id, status, status_reason, last_identity_check_at)
+SELECT lower(domain), homeserver, signing_key_id, status, status_reason, last_identity_check_at
+FROM instance_config;
+
+-- Every signing key belongs to one domain, which publishes and signs with
+-- it. Existing keys belong to the single domain the instance served.
+ALTER TABLE signing_keys ADD COLUMN domain TEXT;
+UPDATE signing_keys SET domain = (SELECT domain FROM domains);
+
+DROP INDEX signing_keys_single_active;
+CREATE UNIQUE INDEX signing_keys_single_active ON signing_keys(domain) WHERE state = 'ACTIVE';
+
+DROP TABLE instance_config;
@@ -0,0 +1,3 @@
+ALTER TABLE accounts DROP COLUMN catchall_stagenet_address;
+ALTER TABLE accounts DROP COLUMN catchall_address;
+ALTER TABLE accounts DROP COLUMN catchall_mode;
@@ -0,0 +1,5 @@
+-- catchall_mode is NULL (follow the domain's catch-all), OFF, DEFAULT_ALIAS
+-- or ADDRESS.
+ALTER TABLE accounts ADD COLUMN catchall_mode TEXT;
+ALTER TABLE accounts ADD COLUMN catchall_address TEXT;
+ALTER TABLE accounts ADD COLUMN catchall_stagenet_address TEXT;
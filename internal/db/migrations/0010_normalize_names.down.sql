@@ -0,0 +1,2 @@
+-- Normalized names are kept; the original spellings are not recorded.
+SELECT 1;
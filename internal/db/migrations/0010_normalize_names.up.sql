@@ -0,0 +1,3 @@
+-- Domains, account handles and aliases are rewritten into their normalized
+-- form by normalizeNames (names_migration.go), which SQL cannot express.
+SELECT 1;
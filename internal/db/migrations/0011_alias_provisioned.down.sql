@@ -0,0 +1 @@
+ALTER TABLE aliases DROP COLUMN provisioned;
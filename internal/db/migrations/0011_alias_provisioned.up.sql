@@ -0,0 +1,3 @@
+-- provisioned marks aliases created by a PROVISION catch-all resolve rather
+-- than by an admin; they count against MONALIAS_PROVISION_MAX_PER_ACCOUNT.
+ALTER TABLE aliases ADD COLUMN provisioned INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Which default aliases had an empty label is not recorded.
+SELECT 1;
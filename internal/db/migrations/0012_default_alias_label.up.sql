@@ -0,0 +1,3 @@
+-- Default aliases created with an empty label take the label "default", as
+-- createAlias now stores them.
+UPDATE aliases SET alias_label = 'default' WHERE alias_label = '';
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/kaigoh/monalias/internal/names"
+)
+
+// rename is one row whose value changes when normalized.
+type rename struct {
+	id       any
+	from, to string
+}
+
+// normalizeNames rewrites domains, account handles and aliases into the form
+// the names package produces, which is what lookups use. Rows that do not
+// normalize, or that would collide with another row once normalized, fail
+// the migration with all of them listed, so they can be renamed or deleted
+// with the previous binary before migrating again.
+func normalizeNames(ctx context.Context, tx *sql.Tx) error {
+	var problems []string
+	domains, err := planRenames(ctx, tx, "domain", `SELECT domain, domain FROM domains`, names.Domain, &problems)
+	if err != nil {
+		return err
+	}
+	handles, err := planRenames(ctx, tx, "account handle", `SELECT id, handle FROM accounts`, names.Acct, &problems)
+	if err != nil {
+		return err
+	}
+	fullAccts, err := planRenames(ctx, tx, "alias", `SELECT id, full_acct FROM aliases`, names.Acct, &problems)
+	if err != nil {
+		return err
+	}
+	labels, err := planRenames(ctx, tx, "alias label", `SELECT id, alias_label FROM aliases WHERE alias_label != ''`, names.Label, nil)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("names do not normalize; rename or delete these rows and migrate again:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	for _, r := range domains {
+		if _, err := tx.ExecContext(ctx, `UPDATE domains SET domain = ? WHERE domain = ?`, r.to, r.from); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE signing_keys SET domain = ? WHERE domain = ?`, r.to, r.from); err != nil {
+			return err
+		}
+	}
+	for _, r := range handles {
+		if _, err := tx.ExecContext(ctx, `UPDATE accounts SET handle = ? WHERE id = ?`, r.to, r.id); err != nil {
+			return err
+		}
+	}
+	for _, r := range fullAccts {
+		if _, err := tx.ExecContext(ctx, `UPDATE aliases SET full_acct = ? WHERE id = ?`, r.to, r.id); err != nil {
+			return err
+		}
+	}
+	for _, r := range labels {
+		if _, err := tx.ExecContext(ctx, `UPDATE aliases SET alias_label = ? WHERE id = ?`, r.to, r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planRenames normalizes the (id, value) rows query returns and lists the
+// ones that change. Values that do not normalize or that collide are added
+// to problems; with nil problems, values that do not normalize are left as
+// they are and collisions are allowed.
+func planRenames(ctx context.Context, tx *sql.Tx, what, query string, normalize func(string) (string, error), problems *[]string) ([]rename, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []rename
+	seen := make(map[string]string)
+	for rows.Next() {
+		var id any
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		normalized, err := normalize(value)
+		if err != nil {
+			if problems != nil {
+				*problems = append(*problems, fmt.Sprintf("%s %q: %v", what, value, err))
+			}
+			continue
+		}
+		if other, ok := seen[normalized]; ok && problems != nil {
+			*problems = append(*problems, fmt.Sprintf("%ss %q and %q both normalize to %q", what, other, value, normalized))
+		}
+		seen[normalized] = value
+		if normalized != value {
+			out = append(out, rename{id: id, from: value, to: normalized})
+		}
+	}
+	return out, rows.Err()
+}
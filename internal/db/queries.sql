@@ -1,23 +1,23 @@
--- name: GetInstanceConfig :one
-SELECT * FROM instance_config WHERE id = 1;
-
--- name: UpsertInstanceConfig :one
-INSERT INTO instance_config (id, domain, homeserver, signing_key_id, signing_pubkey, status, status_reason, last_identity_check_at)
-VALUES (1, ?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT(id) DO UPDATE SET
-  domain=excluded.domain,
-  homeserver=excluded.homeserver,
-  signing_key_id=excluded.signing_key_id,
-  signing_pubkey=excluded.signing_pubkey,
-  status=excluded.status,
-  status_reason=excluded.status_reason,
-  last_identity_check_at=excluded.last_identity_check_at
-RETURNING *;
+-- name: ListDomains :many
+SELECT * FROM domains ORDER BY created_at, domain;
+
+-- name: GetDomain :one
+SELECT * FROM domains WHERE domain = ?;
+
+-- name: CreateDomain :one
+INSERT INTO domains (domain, homeserver) VALUES (?, ?) RETURNING *;
+
+-- name: UpdateDomainHomeserver :one
+UPDATE domains SET homeserver = ? WHERE domain = ? RETURNING *;
 
--- name: UpdateInstanceStatus :one
-UPDATE instance_config
+-- name: UpdateDomainCatchAll :one
+-- Column is catchall_address or catchall_stagenet_address depending on the network.
+UPDATE domains SET catchall_address = ? WHERE domain = ? RETURNING *;
+
+-- name: UpdateDomainStatus :one
+UPDATE domains
 SET status = ?, status_reason = ?, last_identity_check_at = ?
-WHERE id = 1
+WHERE domain = ?
 RETURNING *;
 
 -- name: ListAccounts :many
@@ -30,7 +30,18 @@ SELECT * FROM accounts WHERE id = ?;
 SELECT * FROM accounts WHERE handle = ?;
 
 -- name: CreateAccount :one
-INSERT INTO accounts (handle, wallet_name) VALUES (?, ?) RETURNING *;
+INSERT INTO accounts (handle, wallet_name, stagenet_wallet_name) VALUES (?, ?, ?) RETURNING *;
+
+-- name: UpdateAccountWallet :one
+-- Column is wallet_name or stagenet_wallet_name depending on the network.
+UPDATE accounts SET wallet_name = ? WHERE id = ? RETURNING *;
+
+-- name: UpdateAccountCatchAllMode :one
+UPDATE accounts SET catchall_mode = ? WHERE id = ? RETURNING *;
+
+-- name: UpdateAccountCatchAll :one
+-- Column is catchall_address or catchall_stagenet_address depending on the network.
+UPDATE accounts SET catchall_address = ? WHERE id = ? RETURNING *;
 
 -- name: DeleteAccount :exec
 DELETE FROM accounts WHERE id = ?;
@@ -48,11 +59,78 @@ SELECT * FROM aliases WHERE id = ?;
 INSERT INTO aliases (account_id, full_acct, alias_label, mode, static_address, next_subaddr_idx)
 VALUES (?, ?, ?, ?, ?, ?) RETURNING *;
 
+-- name: CreateProvisionedAlias :one
+-- No row, and so no alias, once the account has max provisioned aliases.
+INSERT INTO aliases (account_id, full_acct, alias_label, mode, provisioned)
+SELECT ?, ?, ?, 'DYNAMIC_SUBADDRESS', 1
+WHERE (SELECT COUNT(*) FROM aliases WHERE account_id = ? AND provisioned = 1) < ?
+RETURNING *;
+
 -- name: UpdateAliasStaticAddress :one
+-- Column is static_address or stagenet_address depending on the network.
 UPDATE aliases SET static_address = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING *;
 
 -- name: UpdateAliasMode :one
 UPDATE aliases SET mode = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING *;
 
 -- name: UpdateAliasNextIndex :one
+-- Column is next_subaddr_idx or stagenet_next_subaddr_idx depending on the network.
 UPDATE aliases SET next_subaddr_idx = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING *;
+
+-- name: UpdateAliasTTL :one
+UPDATE aliases SET ttl_seconds = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING *;
+
+-- name: UpdateAliasRateLimit :one
+UPDATE aliases SET rate_limit_per_minute = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING *;
+
+-- name: RenameAlias :one
+UPDATE aliases SET full_acct = ?, alias_label = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING *;
+
+-- name: SetAliasEnabled :one
+UPDATE aliases SET enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING *;
+
+-- name: DeleteAlias :exec
+DELETE FROM aliases WHERE id = ?;
+
+-- name: AdvanceAliasSubaddress :one
+-- Columns are static_address and next_subaddr_idx, or stagenet_address and
+-- stagenet_next_subaddr_idx, depending on the network.
+UPDATE aliases SET
+static_address = CASE WHEN ? >= COALESCE(next_subaddr_idx, 0) THEN ? ELSE static_address END,
+next_subaddr_idx = MAX(COALESCE(next_subaddr_idx, 0), ?),
+updated_at = CURRENT_TIMESTAMP WHERE id = ? RETURNING *;
+
+-- name: ListSigningKeys :many
+SELECT * FROM signing_keys ORDER BY created_at;
+
+-- name: ListPublishedSigningKeys :many
+SELECT * FROM signing_keys WHERE domain = ? AND state <> 'REVOKED' ORDER BY created_at;
+
+-- name: GetSigningKey :one
+SELECT * FROM signing_keys WHERE kid = ?;
+
+-- name: GetActiveSigningKey :one
+SELECT * FROM signing_keys WHERE domain = ? AND state = 'ACTIVE';
+
+-- name: CreateSigningKey :one
+INSERT INTO signing_keys (domain, kid, public_key, private_seed, state) VALUES (?, ?, ?, ?, ?) RETURNING *;
+
+-- name: ActivateSigningKey :one
+-- Runs in one transaction: retire the domain's current key, activate kid, repoint the domain.
+UPDATE signing_keys SET state = 'RETIRED', retired_at = CURRENT_TIMESTAMP WHERE domain = ? AND state = 'ACTIVE' AND kid <> ?;
+UPDATE signing_keys SET state = 'ACTIVE', activated_at = CURRENT_TIMESTAMP, retired_at = NULL WHERE kid = ? AND state <> 'REVOKED' RETURNING *;
+UPDATE domains SET signing_key_id = ? WHERE domain = ?;
+
+-- name: UpdateSigningKeyState :one
+-- The allowed previous states depend on the new one: RETIRED from NEXT or ACTIVE, REVOKED from any but REVOKED.
+UPDATE signing_keys SET state = ?, retired_at = COALESCE(retired_at, CURRENT_TIMESTAMP) WHERE kid = ? AND state IN (?, ?, ?) RETURNING *;
+
+-- name: UpdateSigningKeySeed :one
+UPDATE signing_keys SET private_seed = ? WHERE kid = ? RETURNING *;
+
+-- name: InsertAuditEntry :one
+INSERT INTO audit_log (principal, mutation, target_type, target_id, old_value, new_value) VALUES (?, ?, ?, ?, ?, ?) RETURNING *;
+
+-- name: ListAuditLog :many
+-- Filter conditions are appended dynamically; see AuditFilter.
+SELECT * FROM audit_log WHERE id < ? ORDER BY id DESC LIMIT ?;
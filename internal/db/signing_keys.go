@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Signing key states. Every state except REVOKED is published in the
+// well-known document; only the ACTIVE key signs resolve responses.
+const (
+	SigningKeyNext    = "NEXT"
+	SigningKeyActive  = "ACTIVE"
+	SigningKeyRetired = "RETIRED"
+	SigningKeyRevoked = "REVOKED"
+)
+
+type SigningKey struct {
+	KID string
+	// Domain is the domain whose well-known document publishes the key.
+	Domain      string
+	PublicKey   string
+	PrivateSeed sql.NullString
+	State       string
+	CreatedAt   time.Time
+	ActivatedAt sql.NullTime
+	RetiredAt   sql.NullTime
+}
+
+const signingKeyColumns = `kid, domain, public_key, private_seed, state, created_at, activated_at, retired_at`
+
+func scanSigningKey(row rowScanner) (SigningKey, error) {
+	var k SigningKey
+	if err := row.Scan(&k.KID, &k.Domain, &k.PublicKey, &k.PrivateSeed, &k.State, &k.CreatedAt, &k.ActivatedAt, &k.RetiredAt); err != nil {
+		return k, err
+	}
+	return k, nil
+}
+
+func (d *DB) listSigningKeys(ctx context.Context, query string, args ...any) ([]SigningKey, error) {
+	rows, err := d.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SigningKey
+	for rows.Next() {
+		k, err := scanSigningKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (d *DB) ListSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	return d.listSigningKeys(ctx, `SELECT `+signingKeyColumns+` FROM signing_keys ORDER BY created_at`)
+}
+
+// ListPublishedSigningKeys returns every key that belongs in the domain's
+// well-known document, i.e. all of its keys that have not been revoked.
+func (d *DB) ListPublishedSigningKeys(ctx context.Context, domain string) ([]SigningKey, error) {
+	return d.listSigningKeys(ctx, `SELECT `+signingKeyColumns+` FROM signing_keys WHERE domain = ? AND state <> 'REVOKED' ORDER BY created_at`, domain)
+}
+
+func (d *DB) GetSigningKey(ctx context.Context, kid string) (SigningKey, error) {
+	row := d.q.QueryRowContext(ctx, `SELECT `+signingKeyColumns+` FROM signing_keys WHERE kid = ?`, kid)
+	return scanSigningKey(row)
+}
+
+func (d *DB) GetActiveSigningKey(ctx context.Context, domain string) (SigningKey, error) {
+	row := d.q.QueryRowContext(ctx, `SELECT `+signingKeyColumns+` FROM signing_keys WHERE domain = ? AND state = 'ACTIVE'`, domain)
+	return scanSigningKey(row)
+}
+
+func (d *DB) CreateSigningKey(ctx context.Context, domain, kid, pubkey string, seed sql.NullString, state string) (SigningKey, error) {
+	row := d.q.QueryRowContext(ctx, `INSERT INTO signing_keys (domain, kid, public_key, private_seed, state) VALUES (?, ?, ?, ?, ?) RETURNING `+signingKeyColumns,
+		domain, kid, pubkey, seed, state,
+	)
+	return scanSigningKey(row)
+}
+
+// ActivateSigningKey makes kid its domain's signing key, retiring the
+// domain's previously active key and pointing the domain at the new one in a
+// single transaction.
+func (d *DB) ActivateSigningKey(ctx context.Context, kid string) (SigningKey, error) {
+	var key SigningKey
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		var domain string
+		if err := tx.QueryRowContext(ctx, `SELECT domain FROM signing_keys WHERE kid = ?`, kid).Scan(&domain); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE signing_keys SET state = 'RETIRED', retired_at = CURRENT_TIMESTAMP WHERE domain = ? AND state = 'ACTIVE' AND kid <> ?`, domain, kid); err != nil {
+			return err
+		}
+		row := tx.QueryRowContext(ctx, `UPDATE signing_keys SET state = 'ACTIVE', activated_at = CURRENT_TIMESTAMP, retired_at = NULL WHERE kid = ? AND state <> 'REVOKED' RETURNING `+signingKeyColumns, kid)
+		var err error
+		key, err = scanSigningKey(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s is REVOKED", ErrSigningKeyState, kid)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE domains SET signing_key_id = ? WHERE domain = ?`, key.KID, domain)
+		return err
+	})
+	return key, err
+}
+
+// ErrSigningKeyState is returned for a state change a key cannot make.
+var ErrSigningKeyState = errors.New("signing key cannot change to that state")
+
+// signingKeyEndStates maps RETIRED and REVOKED to the states a key can reach
+// them from. REVOKED is final, and a key retires only once.
+var signingKeyEndStates = map[string][]string{
+	SigningKeyRetired: {SigningKeyNext, SigningKeyActive},
+	SigningKeyRevoked: {SigningKeyNext, SigningKeyActive, SigningKeyRetired},
+}
+
+// UpdateSigningKeyState moves a key to RETIRED or REVOKED. retired_at
+// records when the key first left use; revoking a retired key keeps it.
+// A key in a state it cannot leave that way fails with ErrSigningKeyState.
+func (d *DB) UpdateSigningKeyState(ctx context.Context, kid, state string) (SigningKey, error) {
+	from, ok := signingKeyEndStates[state]
+	if !ok {
+		return SigningKey{}, fmt.Errorf("%w: %s", ErrSigningKeyState, state)
+	}
+	args := []any{state, kid}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	row := d.q.QueryRowContext(ctx, `UPDATE signing_keys SET state = ?, retired_at = COALESCE(retired_at, CURRENT_TIMESTAMP) WHERE kid = ? AND state IN (?`+strings.Repeat(", ?", len(from)-1)+`) RETURNING `+signingKeyColumns,
+		args...,
+	)
+	key, err := scanSigningKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		current, getErr := d.GetSigningKey(ctx, kid)
+		if getErr != nil {
+			return key, getErr
+		}
+		return key, fmt.Errorf("%w: %s is %s", ErrSigningKeyState, kid, current.State)
+	}
+	return key, err
+}
+
+// UpdateSigningKeySeed replaces a key's stored seed, for resealing it.
+func (d *DB) UpdateSigningKeySeed(ctx context.Context, kid string, seed sql.NullString) (SigningKey, error) {
+	row := d.q.QueryRowContext(ctx, `UPDATE signing_keys SET private_seed = ? WHERE kid = ? RETURNING `+signingKeyColumns, seed, kid)
+	return scanSigningKey(row)
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// newTestKeyRing serves example.com with an ACTIVE key "active" and a key in
+// each other state, named after it.
+func newTestKeyRing(t *testing.T) *DB {
+	t.Helper()
+	ctx := context.Background()
+	database := openTestDB(t)
+	if _, err := database.CreateDomain(ctx, "example.com", "https://monalias.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	for _, kid := range []string{"retired", "revoked", "active", "next"} {
+		if _, err := database.CreateSigningKey(ctx, "example.com", kid, "pub-"+kid, sql.NullString{String: "seed", Valid: true}, SigningKeyNext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, kid := range []string{"retired", "revoked", "active"} {
+		if _, err := database.ActivateSigningKey(ctx, kid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.UpdateSigningKeyState(ctx, "revoked", SigningKeyRevoked); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func TestUpdateSigningKeyState(t *testing.T) {
+	ctx := context.Background()
+	database := newTestKeyRing(t)
+
+	retired, err := database.GetSigningKey(ctx, "retired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retired.State != SigningKeyRetired || !retired.RetiredAt.Valid {
+		t.Fatalf("retired key = %+v", retired)
+	}
+	// Revoking a retired key keeps the time it left use.
+	revoked, err := database.UpdateSigningKeyState(ctx, "retired", SigningKeyRevoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.State != SigningKeyRevoked || !revoked.RetiredAt.Time.Equal(retired.RetiredAt.Time) {
+		t.Errorf("revoked retired key = %+v; want retired_at %v", revoked, retired.RetiredAt.Time)
+	}
+
+	next, err := database.UpdateSigningKeyState(ctx, "next", SigningKeyRetired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.State != SigningKeyRetired || !next.RetiredAt.Valid {
+		t.Errorf("retired next key = %+v", next)
+	}
+}
+
+func TestUpdateSigningKeyStateRejectsIllegalTransitions(t *testing.T) {
+	tests := []struct {
+		kid, state string
+	}{
+		{"revoked", SigningKeyRetired},
+		{"revoked", SigningKeyRevoked},
+		{"retired", SigningKeyRetired},
+		{"next", SigningKeyNext},
+		{"active", SigningKeyActive},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		database := newTestKeyRing(t)
+		before, err := database.GetSigningKey(ctx, tt.kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.UpdateSigningKeyState(ctx, tt.kid, tt.state); !errors.Is(err, ErrSigningKeyState) {
+			t.Errorf("%s -> %s: err = %v; want ErrSigningKeyState", before.State, tt.state, err)
+		}
+		after, err := database.GetSigningKey(ctx, tt.kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.State != before.State || after.RetiredAt != before.RetiredAt {
+			t.Errorf("%s -> %s changed the key: %+v", before.State, tt.state, after)
+		}
+	}
+
+	database := newTestKeyRing(t)
+	if _, err := database.UpdateSigningKeyState(context.Background(), "missing", SigningKeyRetired); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown kid: err = %v; want sql.ErrNoRows", err)
+	}
+}
+
+func TestActivateSigningKeyRefusesRevoked(t *testing.T) {
+	ctx := context.Background()
+	database := newTestKeyRing(t)
+	if _, err := database.ActivateSigningKey(ctx, "revoked"); !errors.Is(err, ErrSigningKeyState) {
+		t.Fatalf("err = %v; want ErrSigningKeyState", err)
+	}
+	active, err := database.GetActiveSigningKey(ctx, "example.com")
+	if err != nil || active.KID != "active" {
+		t.Errorf("active key = %+v, %v; want active", active, err)
+	}
+}
@@ -0,0 +1,102 @@
+package graphql
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testAddress = "888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H"
+
+func TestDeleteMissing(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustExec(t, `mutation { createAccount(handle: "bob$example.com") { id } }`)
+	env.mustExec(t, `mutation { createAlias(accountId: "1", aliasLabel: "coffee", mode: STATIC_ADDRESS) { id } }`)
+
+	tests := []struct {
+		mutation string
+		message  string
+	}{
+		{`mutation { deleteAlias(id: "2") }`, "alias not found"},
+		{`mutation { deleteAccount(id: "2") }`, "account not found"},
+	}
+	for _, tt := range tests {
+		err := env.mustFail(t, tt.mutation)
+		if err.Message != tt.message || err.Extensions["code"] != "NOT_FOUND" {
+			t.Errorf("%s: got %q %v; want %q NOT_FOUND", tt.mutation, err.Message, err.Extensions, tt.message)
+		}
+	}
+
+	// Deleting twice fails the second time, with no second audit entry.
+	env.mustExec(t, `mutation { deleteAlias(id: "1") }`)
+	env.mustFail(t, `mutation { deleteAlias(id: "1") }`)
+	env.mustExec(t, `mutation { deleteAccount(id: "1") }`)
+	env.mustFail(t, `mutation { deleteAccount(id: "1") }`)
+}
+
+func TestUpdateMissing(t *testing.T) {
+	env := newTestEnv(t)
+
+	tests := []struct {
+		mutation string
+		message  string
+	}{
+		{`mutation { setAliasTtl(aliasId: "1", ttlSeconds: 60) { id } }`, "alias not found"},
+		{`mutation { setAliasStaticAddress(aliasId: "1", address: "` + testAddress + `") { id } }`, "alias not found"},
+		{`mutation { setAliasMode(aliasId: "1", mode: STATIC_ADDRESS) { id } }`, "alias not found"},
+		{`mutation { setAliasNextIndex(aliasId: "1", nextSubaddrIdx: 5, network: STAGENET) { id } }`, "alias not found"},
+		{`mutation { setAccountWallet(accountId: "1", network: MAINNET, walletName: "bob") { id } }`, "account not found"},
+		{`mutation { createAlias(accountId: "1", aliasLabel: "coffee", mode: STATIC_ADDRESS) { id } }`, "account not found"},
+		{`mutation { renameAlias(aliasId: "1", aliasLabel: "tea") { id } }`, "alias not found"},
+		{`mutation { setAliasEnabled(aliasId: "1", enabled: false) { id } }`, "alias not found"},
+		{`mutation { setAliasRateLimit(aliasId: "1", perMinute: 10) { id } }`, "alias not found"},
+		{`mutation { setAccountCatchAllMode(accountId: "1", mode: OFF) { id } }`, "account not found"},
+		{`mutation { setAccountCatchAllAddress(accountId: "1", address: "` + testAddress + `") { id } }`, "account not found"},
+	}
+	for _, tt := range tests {
+		err := env.mustFail(t, tt.mutation)
+		if err.Message != tt.message || err.Extensions["code"] != "NOT_FOUND" {
+			t.Errorf("%s: got %q %v; want %q NOT_FOUND", tt.mutation, err.Message, err.Extensions, tt.message)
+		}
+	}
+}
+
+func TestRenameAlias(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustExec(t, `mutation { createAccount(handle: "bob$example.com") { id } }`)
+	env.mustExec(t, `mutation { createAlias(accountId: "1", aliasLabel: "coffee", mode: STATIC_ADDRESS) { id } }`)
+	env.mustExec(t, `mutation { createAlias(accountId: "1", aliasLabel: "tea", mode: STATIC_ADDRESS) { id } }`)
+
+	tests := []struct {
+		label   string
+		message string
+		reason  string
+	}{
+		{"admin", "", "RESERVED"},
+		{"-coffee", "", "BAD_EDGE"},
+		{"tea", "alias bob+tea$example.com already exists", ""},
+		{"Tea", "alias bob+tea$example.com already exists", ""},
+	}
+	for _, tt := range tests {
+		err := env.mustFail(t, `mutation { renameAlias(aliasId: "1", aliasLabel: "`+tt.label+`") { id } }`)
+		reason, _ := err.Extensions["reason"].(string)
+		if reason != tt.reason || tt.message != "" && err.Message != tt.message {
+			t.Errorf("%q: got %q reason %q; want %q reason %q", tt.label, err.Message, reason, tt.message, tt.reason)
+		}
+	}
+
+	data := env.mustExec(t, `mutation { renameAlias(aliasId: "1", aliasLabel: "Latte") { fullAcct aliasLabel } }`)
+	var got struct {
+		RenameAlias struct {
+			FullAcct   string `json:"fullAcct"`
+			AliasLabel string `json:"aliasLabel"`
+		} `json:"renameAlias"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.RenameAlias.FullAcct != "bob+latte$example.com" || got.RenameAlias.AliasLabel != "latte" {
+		t.Errorf("renamed to %+v", got.RenameAlias)
+	}
+	// The old label is free again.
+	env.mustExec(t, `mutation { renameAlias(aliasId: "2", aliasLabel: "coffee") { id } }`)
+}
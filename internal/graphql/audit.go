@@ -0,0 +1,176 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	graph "github.com/graph-gophers/graphql-go"
+
+	"github.com/kaigoh/monalias/internal/audit"
+	"github.com/kaigoh/monalias/internal/db"
+)
+
+const maxAuditPageSize = 500
+
+// auditChange describes what a mutation did. old and new are recorded as JSON
+// and should only carry the fields the mutation touched; old is nil when
+// something was created and new is nil when it was deleted.
+type auditChange struct {
+	targetType string
+	targetID   string
+	old        any
+	new        any
+}
+
+// audited runs fn in a transaction and appends the change it reports to
+// audit_log in that same transaction, so a mutation is never committed
+// without its audit entry.
+func (r *Resolver) audited(ctx context.Context, mutation string, fn func(tx *db.DB) (auditChange, error)) error {
+	var change auditChange
+	err := r.db.InTx(ctx, func(tx *db.DB) error {
+		var err error
+		change, err = fn(tx)
+		if err != nil {
+			return err
+		}
+		oldValue, err := auditJSON(change.old)
+		if err != nil {
+			return err
+		}
+		newValue, err := auditJSON(change.new)
+		if err != nil {
+			return err
+		}
+		_, err = tx.InsertAuditEntry(ctx, audit.Principal(ctx), mutation,
+			nullString(&change.targetType), nullString(&change.targetID), oldValue, newValue)
+		return err
+	})
+	if err != nil {
+		r.log.WarnContext(ctx, "mutation failed", "mutation", mutation, "principal", audit.Principal(ctx), "err", err)
+		return err
+	}
+	r.log.InfoContext(ctx, "mutation applied", "mutation", mutation, "principal", audit.Principal(ctx),
+		"target_type", change.targetType, "target_id", change.targetID)
+	return nil
+}
+
+func auditJSON(v any) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func idString(id int64) string {
+	return fmt.Sprintf("%d", id)
+}
+
+type auditLogFilterInput struct {
+	Principal  *string
+	Mutation   *string
+	TargetType *string
+	TargetId   *string
+	Since      *DateTime
+	Until      *DateTime
+}
+
+func (f *auditLogFilterInput) toDB() db.AuditFilter {
+	var out db.AuditFilter
+	if f == nil {
+		return out
+	}
+	out.Principal = nullString(f.Principal).String
+	out.Mutation = nullString(f.Mutation).String
+	out.TargetType = nullString(f.TargetType).String
+	out.TargetID = nullString(f.TargetId).String
+	if f.Since != nil {
+		out.Since = sql.NullTime{Time: f.Since.Time, Valid: true}
+	}
+	if f.Until != nil {
+		out.Until = sql.NullTime{Time: f.Until.Time, Valid: true}
+	}
+	return out
+}
+
+// AuditLog pages through the audit log newest first. after is the nextCursor
+// of the previous page.
+func (r *Resolver) AuditLog(ctx context.Context, args struct {
+	Filter *auditLogFilterInput
+	First  int32
+	After  *graph.ID
+}) (*AuditLogPageResolver, error) {
+	if args.First < 1 || args.First > maxAuditPageSize {
+		return nil, fmt.Errorf("first must be between 1 and %d", maxAuditPageSize)
+	}
+	var before int64
+	if args.After != nil {
+		id, err := parseID(*args.After)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		before = id
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	entries, err := r.db.ListAuditLog(ctx, args.Filter.toDB(), before, int(args.First)+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &AuditLogPageResolver{}
+	if len(entries) > int(args.First) {
+		entries = entries[:args.First]
+		cursor := graph.ID(idString(entries[len(entries)-1].ID))
+		page.next = &cursor
+	}
+	for _, entry := range entries {
+		page.entries = append(page.entries, &AuditEntryResolver{entry: entry})
+	}
+	return page, nil
+}
+
+type AuditLogPageResolver struct {
+	entries []*AuditEntryResolver
+	next    *graph.ID
+}
+
+func (r *AuditLogPageResolver) Entries() []*AuditEntryResolver {
+	if r.entries == nil {
+		return []*AuditEntryResolver{}
+	}
+	return r.entries
+}
+func (r *AuditLogPageResolver) NextCursor() *graph.ID { return r.next }
+
+type AuditEntryResolver struct {
+	entry db.AuditEntry
+}
+
+func (r *AuditEntryResolver) ID() graph.ID        { return graph.ID(idString(r.entry.ID)) }
+func (r *AuditEntryResolver) CreatedAt() DateTime { return DateTime{Time: r.entry.CreatedAt} }
+func (r *AuditEntryResolver) Principal() string   { return r.entry.Principal }
+func (r *AuditEntryResolver) Mutation() string    { return r.entry.Mutation }
+func (r *AuditEntryResolver) TargetType() *string { return optString(r.entry.TargetType) }
+func (r *AuditEntryResolver) TargetId() *string   { return optString(r.entry.TargetID) }
+func (r *AuditEntryResolver) OldValue() *string   { return optString(r.entry.OldValue) }
+func (r *AuditEntryResolver) NewValue() *string   { return optString(r.entry.NewValue) }
+
+func optString(s sql.NullString) *string {
+	if s.Valid {
+		return &s.String
+	}
+	return nil
+}
+
+func optInt64(n sql.NullInt64) *int64 {
+	if n.Valid {
+		return &n.Int64
+	}
+	return nil
+}
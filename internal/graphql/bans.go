@@ -0,0 +1,47 @@
+package graphql
+
+import (
+	"context"
+
+	"github.com/kaigoh/monalias/internal/db"
+	httpx "github.com/kaigoh/monalias/internal/http"
+)
+
+// Bans lists clients and networks currently refused for alias enumeration.
+func (r *Resolver) Bans() []*BanResolver {
+	bans := r.guard.Bans()
+	out := make([]*BanResolver, 0, len(bans))
+	for _, ban := range bans {
+		out = append(out, &BanResolver{ban: ban})
+	}
+	return out
+}
+
+// ClearBan lifts an enumeration ban. It returns false when key was not
+// banned. The ban is only lifted once the audit entry is committed, so a
+// failed audit write leaves it in force.
+func (r *Resolver) ClearBan(ctx context.Context, args struct{ Key string }) (bool, error) {
+	err := r.audited(ctx, "clearBan", func(tx *db.DB) (auditChange, error) {
+		change := auditChange{targetType: "ban", targetID: args.Key}
+		if ban, ok := r.guard.ActiveBan(args.Key); ok {
+			change.old = map[string]any{"scope": ban.Scope, "until": ban.Until.UTC()}
+		}
+		return change, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	_, cleared := r.guard.ClearBan(args.Key)
+	return cleared, nil
+}
+
+type BanResolver struct {
+	ban httpx.Ban
+}
+
+func (r *BanResolver) Key() string         { return r.ban.Key }
+func (r *BanResolver) Scope() string       { return r.ban.Scope }
+func (r *BanResolver) BannedAt() DateTime  { return DateTime{Time: r.ban.Since} }
+func (r *BanResolver) ExpiresAt() DateTime { return DateTime{Time: r.ban.Until} }
+func (r *BanResolver) Lookups() int32      { return int32(r.ban.Lookups) }
+func (r *BanResolver) NotFound() int32     { return int32(r.ban.NotFound) }
@@ -0,0 +1,57 @@
+package graphql
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kaigoh/monalias/internal/config"
+	httpx "github.com/kaigoh/monalias/internal/http"
+	"github.com/kaigoh/monalias/internal/monero"
+)
+
+// ban gets client banned by resolving an unknown alias from it.
+func (e *testEnv) ban(t *testing.T, client string) {
+	t.Helper()
+	svc := httpx.NewPublicService(config.Config{Domain: "example.com"}, e.db, testSeals, monero.NewWalletSessions(nil), slog.New(slog.DiscardHandler))
+	handler := svc.Handler(nil, e.guard)
+	for _, want := range []int{http.StatusNotFound, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodPost, "/_monalias/resolve", strings.NewReader(`{"acct":"nobody$example.com","network":"mainnet"}`))
+		r.RemoteAddr = client + ":1000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Fatalf("resolve from %s: got %d, want %d", client, w.Code, want)
+		}
+	}
+}
+
+func TestClearBanWaitsForAuditEntry(t *testing.T) {
+	env := newTestEnv(t)
+	env.ban(t, "203.0.113.7")
+
+	// With the audit log refusing writes, the ban stays in force.
+	if _, err := env.db.SQL().Exec(`CREATE TRIGGER audit_down BEFORE INSERT ON audit_log BEGIN SELECT RAISE(ABORT, 'audit down'); END`); err != nil {
+		t.Fatal(err)
+	}
+	env.mustFail(t, `mutation { clearBan(key: "203.0.113.7") }`)
+	if _, ok := env.guard.ActiveBan("203.0.113.7"); !ok {
+		t.Fatal("ban lifted although its audit entry was not written")
+	}
+
+	if _, err := env.db.SQL().Exec(`DROP TRIGGER audit_down`); err != nil {
+		t.Fatal(err)
+	}
+	before := env.auditCount(t)
+	if data := env.mustExec(t, `mutation { clearBan(key: "203.0.113.7") }`); string(data) != `{"clearBan":true}` {
+		t.Errorf("clearBan = %s", data)
+	}
+	if _, ok := env.guard.ActiveBan("203.0.113.7"); ok {
+		t.Error("ban still in force")
+	}
+	if after := env.auditCount(t); after != before+1 {
+		t.Errorf("audit entries %d -> %d", before, after)
+	}
+}
@@ -0,0 +1,35 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateTime backs the schema's DateTime scalar. graph.Time only binds to a
+// scalar named Time, so the schema needs its own type.
+type DateTime struct {
+	time.Time
+}
+
+func (DateTime) ImplementsGraphQLType(name string) bool {
+	return name == "DateTime"
+}
+
+func (t *DateTime) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case time.Time:
+		t.Time = input
+		return nil
+	case string:
+		var err error
+		t.Time, err = time.Parse(time.RFC3339, input)
+		return err
+	default:
+		return fmt.Errorf("wrong type for DateTime: %T", input)
+	}
+}
+
+func (t DateTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Time.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,194 @@
+package graphql
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/kaigoh/monalias/internal/db"
+	"github.com/kaigoh/monalias/internal/monero/address"
+	"github.com/kaigoh/monalias/internal/names"
+)
+
+func (r *Resolver) Domains(ctx context.Context) ([]*DomainResolver, error) {
+	domains, err := r.db.ListDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*DomainResolver, 0, len(domains))
+	for _, domain := range domains {
+		resolvers = append(resolvers, &DomainResolver{db: r.db, domain: domain})
+	}
+	return resolvers, nil
+}
+
+func (r *Resolver) Domain(ctx context.Context, args struct{ Domain string }) (*DomainResolver, error) {
+	name, err := r.domainArg(&args.Domain)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := r.db.GetDomain(ctx, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &DomainResolver{db: r.db, domain: domain}, nil
+}
+
+// CreateDomain starts serving a new domain with its own homeserver and an
+// active signing key kid. Without a seed a fresh key is generated
+// server-side. The domain's well-known document has to be published before
+// the watchdog's first check, or the domain locks itself.
+func (r *Resolver) CreateDomain(ctx context.Context, args struct {
+	Domain     string
+	Homeserver string
+	Kid        string
+	Seed       *string
+}) (*DomainResolver, error) {
+	name, err := r.domainArg(&args.Domain)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Homeserver) == "" {
+		return nil, errors.New("homeserver is required")
+	}
+	if strings.TrimSpace(args.Kid) == "" {
+		return nil, errors.New("kid is required")
+	}
+	priv, err := signingKeyFromSeed(args.Seed)
+	if err != nil {
+		return nil, err
+	}
+	pub := base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))
+	seed := sql.NullString{String: r.seals.Seal(args.Kid, priv.Seed()), Valid: true}
+
+	var domain db.Domain
+	err = r.audited(ctx, "createDomain", func(tx *db.DB) (auditChange, error) {
+		if _, err := tx.CreateDomain(ctx, name, args.Homeserver); err != nil {
+			return auditChange{}, err
+		}
+		if _, err := tx.CreateSigningKey(ctx, name, args.Kid, pub, seed, db.SigningKeyNext); err != nil {
+			return auditChange{}, err
+		}
+		if _, err := tx.ActivateSigningKey(ctx, args.Kid); err != nil {
+			return auditChange{}, err
+		}
+		var err error
+		domain, err = tx.GetDomain(ctx, name)
+		if err != nil {
+			return auditChange{}, err
+		}
+		// Never record the seed.
+		return auditChange{
+			targetType: "domain",
+			targetID:   domain.Domain,
+			new: map[string]any{
+				"homeserver":     domain.Homeserver,
+				"signing_key_id": args.Kid,
+				"public_key":     pub,
+			},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DomainResolver{db: r.db, domain: domain}, nil
+}
+
+// SetDomainCatchAll sets the address served on network for aliases of the
+// domain that do not exist. A null or empty address turns the catch-all off.
+func (r *Resolver) SetDomainCatchAll(ctx context.Context, args struct {
+	Domain  string
+	Address *string
+	Network string
+}) (*DomainResolver, error) {
+	name, err := r.domainArg(&args.Domain)
+	if err != nil {
+		return nil, err
+	}
+	network := networkFromEnum(args.Network)
+	var addr sql.NullString
+	if args.Address != nil && strings.TrimSpace(*args.Address) != "" {
+		addr = sql.NullString{String: strings.TrimSpace(*args.Address), Valid: true}
+		if _, err := address.Validate(addr.String, network); err != nil {
+			return nil, err
+		}
+	}
+	var domain db.Domain
+	err = r.audited(ctx, "setDomainCatchAll", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetDomain(ctx, name)
+		if err != nil {
+			return auditChange{}, err
+		}
+		domain, err = tx.UpdateDomainCatchAll(ctx, name, network, addr)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "domain",
+			targetID:   domain.Domain,
+			old:        map[string]any{"network": network, "address": optString(before.CatchAllFor(network))},
+			new:        map[string]any{"network": network, "address": optString(domain.CatchAllFor(network))},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DomainResolver{db: r.db, domain: domain}, nil
+}
+
+// domainArg returns the normalized domain argument, or the primary domain
+// when it is omitted.
+func (r *Resolver) domainArg(domain *string) (string, error) {
+	if domain == nil {
+		return r.cfg.Domain, nil
+	}
+	out, err := names.Domain(*domain)
+	if err != nil {
+		return "", &argumentError{field: "domain", err: err}
+	}
+	return out, nil
+}
+
+// DomainResolver serves both Domain and InstanceInfo, which describe the
+// same row.
+type DomainResolver struct {
+	db     *db.DB
+	domain db.Domain
+}
+
+func (r *DomainResolver) Domain() string       { return r.domain.Domain }
+func (r *DomainResolver) Homeserver() string   { return r.domain.Homeserver }
+func (r *DomainResolver) SigningKeyId() string { return r.domain.SigningKeyID.String }
+func (r *DomainResolver) SigningPubkey(ctx context.Context) (string, error) {
+	if !r.domain.SigningKeyID.Valid {
+		return "", nil
+	}
+	key, err := r.db.GetSigningKey(ctx, r.domain.SigningKeyID.String)
+	if err != nil {
+		return "", err
+	}
+	return key.PublicKey, nil
+}
+func (r *DomainResolver) CatchAllAddress(args struct{ Network string }) *string {
+	return optString(r.domain.CatchAllFor(networkFromEnum(args.Network)))
+}
+func (r *DomainResolver) Status() string { return r.domain.Status }
+func (r *DomainResolver) StatusReason() *string {
+	if r.domain.StatusReason.Valid {
+		return &r.domain.StatusReason.String
+	}
+	return nil
+}
+func (r *DomainResolver) LastIdentityCheckAt() *DateTime {
+	if r.domain.LastIdentityCheckAt.Valid {
+		return &DateTime{Time: r.domain.LastIdentityCheckAt.Time}
+	}
+	return nil
+}
+func (r *DomainResolver) CreatedAt() DateTime { return DateTime{Time: r.domain.CreatedAt} }
@@ -0,0 +1,100 @@
+package graphql
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/kaigoh/monalias/internal/names"
+)
+
+// argumentError rejects the value of one argument. graphql-go copies its
+// extensions into the error, so clients can tell which field to flag
+// without parsing the message:
+//
+//	{"code": "INVALID_ARGUMENT", "field": "aliasLabel", "part": "label", "reason": "RESERVED"}
+type argumentError struct {
+	field string
+	err   error
+}
+
+func (e *argumentError) Error() string {
+	return e.field + ": " + e.err.Error()
+}
+
+func (e *argumentError) Unwrap() error {
+	return e.err
+}
+
+func (e *argumentError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{
+		"code":   "INVALID_ARGUMENT",
+		"field":  e.field,
+		"reason": argumentReason(e.err),
+	}
+	var nerr *names.Error
+	if errors.As(e.err, &nerr) {
+		ext["part"] = nerr.Part
+	}
+	return ext
+}
+
+// errLabelInHandle rejects a +label in createAccount's handle.
+var errLabelInHandle = &names.Error{Part: "label", Err: errors.New("is not allowed in a handle")}
+
+// argumentReasons are the reason codes of the names errors.
+var argumentReasons = []struct {
+	err    error
+	reason string
+}{
+	{names.ErrEmpty, "EMPTY"},
+	{names.ErrTooLong, "TOO_LONG"},
+	{names.ErrDisallowed, "DISALLOWED_CHARACTER"},
+	{names.ErrMixedScripts, "MIXED_SCRIPTS"},
+	{names.ErrEdge, "BAD_EDGE"},
+	{names.ErrReserved, "RESERVED"},
+	{errLabelInHandle, "LABEL_NOT_ALLOWED"},
+}
+
+func argumentReason(err error) string {
+	for _, r := range argumentReasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return "INVALID"
+}
+
+// notFoundError is returned by mutations on an account or alias that does
+// not exist, with the extensions {"code": "NOT_FOUND"}.
+type notFoundError struct {
+	what string
+}
+
+func (e *notFoundError) Error() string {
+	return e.what + " not found"
+}
+
+func (e *notFoundError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "NOT_FOUND"}
+}
+
+var (
+	errAccountNotFound = &notFoundError{what: "account"}
+	errAliasNotFound   = &notFoundError{what: "alias"}
+)
+
+// accountErr and aliasErr turn the sql.ErrNoRows of a lookup or change by ID
+// into the not-found error for the object, and pass other errors through.
+func accountErr(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errAccountNotFound
+	}
+	return err
+}
+
+func aliasErr(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errAliasNotFound
+	}
+	return err
+}
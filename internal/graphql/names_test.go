@@ -0,0 +1,44 @@
+package graphql
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAliasLabelPolicy(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustExec(t, `mutation { createAccount(handle: "bob$example.com") { id } }`)
+
+	// An empty label is the default alias, stored under the label default.
+	data := env.mustExec(t, `mutation { createAlias(accountId: "1", aliasLabel: "", mode: STATIC_ADDRESS) { fullAcct aliasLabel } }`)
+	var got struct {
+		CreateAlias struct {
+			FullAcct   string `json:"fullAcct"`
+			AliasLabel string `json:"aliasLabel"`
+		} `json:"createAlias"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.CreateAlias.FullAcct != "bob$example.com" || got.CreateAlias.AliasLabel != "default" {
+		t.Errorf("empty label created %+v", got.CreateAlias)
+	}
+
+	// "default", however spelled, names the alias just created; the other
+	// labels are refused by the policy.
+	tests := []struct {
+		label  string
+		reason string
+	}{
+		{"default", ""},
+		{"Default", ""},
+		{"admin", "RESERVED"},
+		{"-coffee", "BAD_EDGE"},
+	}
+	for _, tt := range tests {
+		err := env.mustFail(t, `mutation { createAlias(accountId: "1", aliasLabel: "`+tt.label+`", mode: STATIC_ADDRESS) { id } }`)
+		if reason, _ := err.Extensions["reason"].(string); reason != tt.reason {
+			t.Errorf("%q: reason = %q; want %q (%s)", tt.label, reason, tt.reason, err.Message)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package graphql
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"database/sql"
 	"embed"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
@@ -15,14 +19,18 @@ import (
 
 	"github.com/kaigoh/monalias/internal/config"
 	"github.com/kaigoh/monalias/internal/db"
+	httpx "github.com/kaigoh/monalias/internal/http"
 	"github.com/kaigoh/monalias/internal/identity"
 	"github.com/kaigoh/monalias/internal/monero"
+	"github.com/kaigoh/monalias/internal/monero/address"
+	"github.com/kaigoh/monalias/internal/names"
+	"github.com/kaigoh/monalias/internal/seal"
 )
 
 //go:embed schema.graphqls
 var schemaFS embed.FS
 
-func NewHandler(cfg config.Config, database *db.DB, wallet *monero.WalletRPC, watchdog *identity.Watchdog) (*relay.Handler, error) {
+func NewHandler(cfg config.Config, database *db.DB, seals *seal.Box, wallets *monero.WalletSessions, watchdog *identity.Watchdog, guard *httpx.EnumerationGuard, logger *slog.Logger) (*relay.Handler, error) {
 	schemaBytes, err := schemaFS.ReadFile("schema.graphqls")
 	if err != nil {
 		return nil, err
@@ -31,8 +39,12 @@ func NewHandler(cfg config.Config, database *db.DB, wallet *monero.WalletRPC, wa
 	resolvers := &Resolver{
 		cfg:      cfg,
 		db:       database,
-		wallet:   wallet,
+		seals:    seals,
+		wallets:  wallets,
 		watchdog: watchdog,
+		guard:    guard,
+		names:    names.NewPolicy(cfg.ReservedNames),
+		log:      logger,
 	}
 	schema := graph.MustParseSchema(string(schemaBytes), resolvers)
 	return &relay.Handler{Schema: schema}, nil
@@ -41,16 +53,48 @@ func NewHandler(cfg config.Config, database *db.DB, wallet *monero.WalletRPC, wa
 type Resolver struct {
 	cfg      config.Config
 	db       *db.DB
-	wallet   *monero.WalletRPC
+	seals    *seal.Box
+	wallets  *monero.WalletSessions
 	watchdog *identity.Watchdog
+	guard    *httpx.EnumerationGuard
+	names    *names.Policy
+	log      *slog.Logger
 }
 
-func (r *Resolver) InstanceInfo(ctx context.Context) (*InstanceInfoResolver, error) {
-	cfg, err := r.db.GetInstanceConfig(ctx)
+// InstanceInfo describes one served domain, the primary one unless domain is
+// given.
+func (r *Resolver) InstanceInfo(ctx context.Context, args struct{ Domain *string }) (*DomainResolver, error) {
+	name, err := r.domainArg(args.Domain)
 	if err != nil {
 		return nil, err
 	}
-	return &InstanceInfoResolver{cfg: cfg}, nil
+	domain, err := r.db.GetDomain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &DomainResolver{db: r.db, domain: domain}, nil
+}
+
+func (r *Resolver) SigningKeys(ctx context.Context, args struct{ Domain *string }) ([]*SigningKeyResolver, error) {
+	var domain string
+	if args.Domain != nil {
+		var err error
+		if domain, err = r.domainArg(args.Domain); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := r.db.ListSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*SigningKeyResolver, 0, len(keys))
+	for _, key := range keys {
+		if domain != "" && key.Domain != domain {
+			continue
+		}
+		resolvers = append(resolvers, &SigningKeyResolver{key: key})
+	}
+	return resolvers, nil
 }
 
 func (r *Resolver) Accounts(ctx context.Context) ([]*AccountResolver, error) {
@@ -80,41 +124,188 @@ func (r *Resolver) Account(ctx context.Context, args struct{ ID graph.ID }) (*Ac
 	return &AccountResolver{db: r.db, account: account}, nil
 }
 
+// SetInstanceConfig points an existing domain at a new homeserver. Domains
+// are added with createDomain.
 func (r *Resolver) SetInstanceConfig(ctx context.Context, args struct {
 	Domain     string
 	Homeserver string
-}) (*InstanceInfoResolver, error) {
-	current, err := r.db.GetInstanceConfig(ctx)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+}) (*DomainResolver, error) {
+	name, err := r.domainArg(&args.Domain)
+	if err != nil {
 		return nil, err
 	}
-	status := current.Status
-	if status == "" {
-		status = "OK"
+	var domain db.Domain
+	err = r.audited(ctx, "setInstanceConfig", func(tx *db.DB) (auditChange, error) {
+		current, err := tx.GetDomain(ctx, name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return auditChange{}, fmt.Errorf("unknown domain %s; add it with createDomain", name)
+			}
+			return auditChange{}, err
+		}
+		domain, err = tx.UpdateDomainHomeserver(ctx, name, args.Homeserver)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "domain",
+			targetID:   domain.Domain,
+			old:        map[string]any{"homeserver": current.Homeserver},
+			new:        map[string]any{"homeserver": domain.Homeserver},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	keyID := current.SigningKeyID
-	if keyID == "" {
-		keyID = r.cfg.SigningKeyID
+	return &DomainResolver{db: r.db, domain: domain}, nil
+}
+
+func (r *Resolver) CreateAccount(ctx context.Context, args struct {
+	Handle             string
+	WalletName         *string
+	StagenetWalletName *string
+}) (*AccountResolver, error) {
+	handle, err := r.handleArg(args.Handle)
+	if err != nil {
+		return nil, err
 	}
-	cfg, err := r.db.UpsertInstanceConfig(ctx, args.Domain, args.Homeserver, keyID, current.SigningPubkey, status, current.StatusReason, current.LastIdentityCheckAt)
+	_, domain, _ := strings.Cut(handle, "$")
+	var account db.Account
+	err = r.audited(ctx, "createAccount", func(tx *db.DB) (auditChange, error) {
+		if _, err := tx.GetDomain(ctx, domain); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return auditChange{}, fmt.Errorf("domain %s is not served by this instance", domain)
+			}
+			return auditChange{}, err
+		}
+		var err error
+		account, err = tx.CreateAccount(ctx, handle, nullString(args.WalletName), nullString(args.StagenetWalletName))
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "account",
+			targetID:   idString(account.ID),
+			new: map[string]any{
+				"handle":               account.Handle,
+				"wallet_name":          optString(account.WalletName),
+				"stagenet_wallet_name": optString(account.StagenetWalletName),
+			},
+		}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &InstanceInfoResolver{cfg: cfg}, nil
+	return &AccountResolver{db: r.db, account: account}, nil
 }
 
-func (r *Resolver) CreateAccount(ctx context.Context, args struct {
-	Handle     string
+func (r *Resolver) SetAccountWallet(ctx context.Context, args struct {
+	AccountID  graph.ID
+	Network    string
 	WalletName *string
 }) (*AccountResolver, error) {
-	if !acctMatchesDomain(args.Handle, r.cfg.Domain) {
-		return nil, fmt.Errorf("handle must match domain %s", r.cfg.Domain)
+	id, err := parseID(args.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	network := networkFromEnum(args.Network)
+	var account db.Account
+	err = r.audited(ctx, "setAccountWallet", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAccount(ctx, id)
+		if err != nil {
+			return auditChange{}, accountErr(err)
+		}
+		account, err = tx.UpdateAccountWallet(ctx, id, network, nullString(args.WalletName))
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "account",
+			targetID:   idString(id),
+			old:        map[string]any{"network": network, "wallet_name": optString(before.WalletFor(network))},
+			new:        map[string]any{"network": network, "wallet_name": optString(account.WalletFor(network))},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AccountResolver{db: r.db, account: account}, nil
+}
+
+// SetAccountCatchAllMode sets how the account answers for its unknown
+// aliases. INHERIT clears the account's mode so the domain's catch-all
+// applies.
+func (r *Resolver) SetAccountCatchAllMode(ctx context.Context, args struct {
+	AccountID graph.ID
+	Mode      string
+}) (*AccountResolver, error) {
+	id, err := parseID(args.AccountID)
+	if err != nil {
+		return nil, err
 	}
-	wallet := sql.NullString{}
-	if args.WalletName != nil && *args.WalletName != "" {
-		wallet = sql.NullString{String: *args.WalletName, Valid: true}
+	var mode sql.NullString
+	if args.Mode != "INHERIT" {
+		mode = sql.NullString{String: args.Mode, Valid: true}
 	}
-	account, err := r.db.CreateAccount(ctx, args.Handle, wallet)
+	var account db.Account
+	err = r.audited(ctx, "setAccountCatchAllMode", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAccount(ctx, id)
+		if err != nil {
+			return auditChange{}, accountErr(err)
+		}
+		account, err = tx.UpdateAccountCatchAllMode(ctx, id, mode)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "account",
+			targetID:   idString(id),
+			old:        map[string]any{"catchall_mode": optString(before.CatchAllMode)},
+			new:        map[string]any{"catchall_mode": optString(account.CatchAllMode)},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AccountResolver{db: r.db, account: account}, nil
+}
+
+// SetAccountCatchAllAddress sets the address the account serves on network
+// in ADDRESS mode. A null or empty address clears it.
+func (r *Resolver) SetAccountCatchAllAddress(ctx context.Context, args struct {
+	AccountID graph.ID
+	Address   *string
+	Network   string
+}) (*AccountResolver, error) {
+	id, err := parseID(args.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	network := networkFromEnum(args.Network)
+	var addr sql.NullString
+	if args.Address != nil && strings.TrimSpace(*args.Address) != "" {
+		addr = sql.NullString{String: strings.TrimSpace(*args.Address), Valid: true}
+		if _, err := address.Validate(addr.String, network); err != nil {
+			return nil, err
+		}
+	}
+	var account db.Account
+	err = r.audited(ctx, "setAccountCatchAllAddress", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAccount(ctx, id)
+		if err != nil {
+			return auditChange{}, accountErr(err)
+		}
+		account, err = tx.UpdateAccountCatchAll(ctx, id, network, addr)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "account",
+			targetID:   idString(id),
+			old:        map[string]any{"network": network, "catchall_address": optString(before.CatchAllFor(network))},
+			new:        map[string]any{"network": network, "catchall_address": optString(account.CatchAllFor(network))},
+		}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +317,30 @@ func (r *Resolver) DeleteAccount(ctx context.Context, args struct{ ID graph.ID }
 	if err != nil {
 		return false, err
 	}
-	if err := r.db.DeleteAccount(ctx, id); err != nil {
+	err = r.audited(ctx, "deleteAccount", func(tx *db.DB) (auditChange, error) {
+		account, err := tx.GetAccount(ctx, id)
+		if err != nil {
+			return auditChange{}, accountErr(err)
+		}
+		aliases, err := tx.ListAliasesForAccount(ctx, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		// Aliases go with the account via ON DELETE CASCADE.
+		fullAccts := make([]string, 0, len(aliases))
+		for _, alias := range aliases {
+			fullAccts = append(fullAccts, alias.FullAcct)
+		}
+		if err := tx.DeleteAccount(ctx, id); err != nil {
+			return auditChange{}, accountErr(err)
+		}
+		return auditChange{
+			targetType: "account",
+			targetID:   idString(id),
+			old:        map[string]any{"handle": account.Handle, "aliases": fullAccts},
+		}, nil
+	})
+	if err != nil {
 		return false, err
 	}
 	return true, nil
@@ -141,34 +355,48 @@ func (r *Resolver) CreateAlias(ctx context.Context, args struct {
 	if err != nil {
 		return nil, err
 	}
-	account, err := r.db.GetAccount(ctx, accountID)
+	label, err := r.aliasLabelArg(args.AliasLabel)
 	if err != nil {
 		return nil, err
 	}
-	fullAcct := buildFullAcct(account.Handle, args.AliasLabel)
-
-	var staticAddress sql.NullString
-	var nextIdx sql.NullInt64
+	account, err := r.db.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, accountErr(err)
+	}
+	fullAcct := buildFullAcct(account.Handle, label)
 
+	// Talk to wallet-rpc before opening the transaction so the database is
+	// not held locked while the wallet works.
+	var subaddrs map[string]subaddress
 	if args.Mode == "DYNAMIC_SUBADDRESS" {
-		if r.wallet == nil || !r.wallet.Enabled() {
-			return nil, errors.New("wallet rpc is not configured")
-		}
-		if !account.WalletName.Valid || account.WalletName.String == "" {
-			return nil, errors.New("wallet name is required for dynamic alias")
-		}
-		if err := r.wallet.OpenWallet(ctx, account.WalletName.String); err != nil {
-			return nil, err
-		}
-		addr, idx, err := r.wallet.CreateAddress(ctx, args.AliasLabel)
+		subaddrs, err = r.allocateSubaddresses(ctx, account, label, db.Alias{})
 		if err != nil {
 			return nil, err
 		}
-		staticAddress = sql.NullString{String: addr, Valid: true}
-		nextIdx = sql.NullInt64{Int64: idx, Valid: true}
 	}
 
-	alias, err := r.db.CreateAlias(ctx, accountID, fullAcct, args.AliasLabel, args.Mode, staticAddress, nextIdx)
+	var alias db.Alias
+	err = r.audited(ctx, "createAlias", func(tx *db.DB) (auditChange, error) {
+		var err error
+		alias, err = tx.CreateAlias(ctx, accountID, fullAcct, label, args.Mode, sql.NullString{}, sql.NullInt64{})
+		if err != nil {
+			return auditChange{}, err
+		}
+		alias, err = storeSubaddresses(ctx, tx, alias, subaddrs)
+		if err != nil {
+			return auditChange{}, err
+		}
+		newValue := map[string]any{
+			"account_id":  alias.AccountID,
+			"full_acct":   alias.FullAcct,
+			"alias_label": alias.AliasLabel,
+			"mode":        alias.Mode,
+		}
+		if len(subaddrs) > 0 {
+			newValue["addresses"] = auditSubaddresses(subaddrs)
+		}
+		return auditChange{targetType: "alias", targetID: idString(alias.ID), new: newValue}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -178,12 +406,35 @@ func (r *Resolver) CreateAlias(ctx context.Context, args struct {
 func (r *Resolver) SetAliasStaticAddress(ctx context.Context, args struct {
 	AliasID graph.ID
 	Address string
+	Network string
 }) (*AliasResolver, error) {
 	id, err := parseID(args.AliasID)
 	if err != nil {
 		return nil, err
 	}
-	alias, err := r.db.UpdateAliasStaticAddress(ctx, id, sql.NullString{String: args.Address, Valid: true})
+	network := networkFromEnum(args.Network)
+	addr := strings.TrimSpace(args.Address)
+	if _, err := address.Validate(addr, network); err != nil {
+		return nil, err
+	}
+	var alias db.Alias
+	err = r.audited(ctx, "setAliasStaticAddress", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAliasByID(ctx, id)
+		if err != nil {
+			return auditChange{}, aliasErr(err)
+		}
+		alias, err = tx.UpdateAliasStaticAddress(ctx, id, network, sql.NullString{String: addr, Valid: true})
+		if err != nil {
+			return auditChange{}, err
+		}
+		oldAddr, _ := before.AddressFor(network)
+		return auditChange{
+			targetType: "alias",
+			targetID:   idString(id),
+			old:        map[string]any{"network": network, "address": optString(oldAddr)},
+			new:        map[string]any{"network": network, "address": addr},
+		}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -198,36 +449,47 @@ func (r *Resolver) SetAliasMode(ctx context.Context, args struct {
 	if err != nil {
 		return nil, err
 	}
-	alias, err := r.db.UpdateAliasMode(ctx, id, args.Mode)
+	alias, err := r.db.GetAliasByID(ctx, id)
 	if err != nil {
-		return nil, err
+		return nil, aliasErr(err)
 	}
-	if args.Mode == "DYNAMIC_SUBADDRESS" && !alias.NextSubaddrIdx.Valid {
+	var subaddrs map[string]subaddress
+	if args.Mode == "DYNAMIC_SUBADDRESS" {
 		account, err := r.db.GetAccount(ctx, alias.AccountID)
 		if err != nil {
 			return nil, err
 		}
-		if r.wallet == nil || !r.wallet.Enabled() {
-			return nil, errors.New("wallet rpc is not configured")
-		}
-		if !account.WalletName.Valid || account.WalletName.String == "" {
-			return nil, errors.New("wallet name is required for dynamic alias")
-		}
-		if err := r.wallet.OpenWallet(ctx, account.WalletName.String); err != nil {
+		subaddrs, err = r.allocateSubaddresses(ctx, account, alias.AliasLabel, alias)
+		if err != nil {
 			return nil, err
 		}
-		addr, idx, err := r.wallet.CreateAddress(ctx, alias.AliasLabel)
+	}
+	err = r.audited(ctx, "setAliasMode", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAliasByID(ctx, id)
 		if err != nil {
-			return nil, err
+			return auditChange{}, aliasErr(err)
 		}
-		alias, err = r.db.UpdateAliasStaticAddress(ctx, id, sql.NullString{String: addr, Valid: true})
+		alias, err = tx.UpdateAliasMode(ctx, id, args.Mode)
 		if err != nil {
-			return nil, err
+			return auditChange{}, err
 		}
-		alias, err = r.db.UpdateAliasNextIndex(ctx, id, sql.NullInt64{Int64: idx, Valid: true})
+		alias, err = storeSubaddresses(ctx, tx, alias, subaddrs)
 		if err != nil {
-			return nil, err
+			return auditChange{}, err
+		}
+		newValue := map[string]any{"mode": alias.Mode}
+		if len(subaddrs) > 0 {
+			newValue["addresses"] = auditSubaddresses(subaddrs)
 		}
+		return auditChange{
+			targetType: "alias",
+			targetID:   idString(id),
+			old:        map[string]any{"mode": before.Mode},
+			new:        newValue,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &AliasResolver{alias: alias}, nil
 }
@@ -235,62 +497,508 @@ func (r *Resolver) SetAliasMode(ctx context.Context, args struct {
 func (r *Resolver) SetAliasNextIndex(ctx context.Context, args struct {
 	AliasID        graph.ID
 	NextSubaddrIdx int32
+	Network        string
+}) (*AliasResolver, error) {
+	id, err := parseID(args.AliasID)
+	if err != nil {
+		return nil, err
+	}
+	network := networkFromEnum(args.Network)
+	var alias db.Alias
+	err = r.audited(ctx, "setAliasNextIndex", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAliasByID(ctx, id)
+		if err != nil {
+			return auditChange{}, aliasErr(err)
+		}
+		alias, err = tx.UpdateAliasNextIndex(ctx, id, network, sql.NullInt64{Int64: int64(args.NextSubaddrIdx), Valid: true})
+		if err != nil {
+			return auditChange{}, err
+		}
+		_, oldIdx := before.AddressFor(network)
+		return auditChange{
+			targetType: "alias",
+			targetID:   idString(id),
+			old:        map[string]any{"network": network, "next_subaddr_idx": optInt64(oldIdx)},
+			new:        map[string]any{"network": network, "next_subaddr_idx": args.NextSubaddrIdx},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AliasResolver{alias: alias}, nil
+}
+
+type subaddress struct {
+	address string
+	index   int64
+}
+
+// allocateSubaddresses creates the first subaddress in every wallet bound to
+// the account, skipping networks where alias already has an index. At least
+// one wallet must be bound.
+func (r *Resolver) allocateSubaddresses(ctx context.Context, account db.Account, label string, alias db.Alias) (map[string]subaddress, error) {
+	if !r.wallets.Enabled() {
+		return nil, errors.New("wallet rpc is not configured")
+	}
+	out := make(map[string]subaddress)
+	bound := false
+	for _, network := range db.Networks {
+		wallet := account.WalletFor(network)
+		if !wallet.Valid || wallet.String == "" {
+			continue
+		}
+		bound = true
+		if _, idx := alias.AddressFor(network); idx.Valid {
+			continue
+		}
+		addr, idx, err := r.wallets.CreateAddress(ctx, wallet.String, label)
+		if err != nil {
+			return nil, err
+		}
+		out[network] = subaddress{address: addr, index: idx}
+	}
+	if !bound {
+		return nil, errors.New("wallet name is required for dynamic alias")
+	}
+	return out, nil
+}
+
+func storeSubaddresses(ctx context.Context, tx *db.DB, alias db.Alias, subaddrs map[string]subaddress) (db.Alias, error) {
+	for _, network := range db.Networks {
+		sub, ok := subaddrs[network]
+		if !ok {
+			continue
+		}
+		var err error
+		alias, err = tx.UpdateAliasStaticAddress(ctx, alias.ID, network, sql.NullString{String: sub.address, Valid: true})
+		if err != nil {
+			return alias, err
+		}
+		alias, err = tx.UpdateAliasNextIndex(ctx, alias.ID, network, sql.NullInt64{Int64: sub.index + 1, Valid: true})
+		if err != nil {
+			return alias, err
+		}
+	}
+	return alias, nil
+}
+
+// auditSubaddresses renders allocated subaddresses for an audit entry, keyed
+// by network.
+func auditSubaddresses(subaddrs map[string]subaddress) map[string]any {
+	out := make(map[string]any, len(subaddrs))
+	for network, sub := range subaddrs {
+		out[network] = map[string]any{"address": sub.address, "index": sub.index}
+	}
+	return out
+}
+
+func (r *Resolver) SetAliasTtl(ctx context.Context, args struct {
+	AliasID    graph.ID
+	TtlSeconds *int32
+}) (*AliasResolver, error) {
+	id, err := parseID(args.AliasID)
+	if err != nil {
+		return nil, err
+	}
+	ttl := sql.NullInt64{}
+	if args.TtlSeconds != nil {
+		if *args.TtlSeconds < 0 {
+			return nil, errors.New("ttlSeconds must not be negative")
+		}
+		ttl = sql.NullInt64{Int64: int64(*args.TtlSeconds), Valid: true}
+	}
+	var alias db.Alias
+	err = r.audited(ctx, "setAliasTtl", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAliasByID(ctx, id)
+		if err != nil {
+			return auditChange{}, aliasErr(err)
+		}
+		alias, err = tx.UpdateAliasTTL(ctx, id, ttl)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "alias",
+			targetID:   idString(id),
+			old:        map[string]any{"ttl_seconds": optInt64(before.TTLSeconds)},
+			new:        map[string]any{"ttl_seconds": optInt64(alias.TTLSeconds)},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AliasResolver{alias: alias}, nil
+}
+
+// SetAliasRateLimit caps how many times per minute the alias can be
+// resolved. Null falls back to the instance default; 0 lifts the limit.
+func (r *Resolver) SetAliasRateLimit(ctx context.Context, args struct {
+	AliasID   graph.ID
+	PerMinute *int32
+}) (*AliasResolver, error) {
+	id, err := parseID(args.AliasID)
+	if err != nil {
+		return nil, err
+	}
+	limit := sql.NullInt64{}
+	if args.PerMinute != nil {
+		if *args.PerMinute < 0 {
+			return nil, errors.New("perMinute must not be negative")
+		}
+		limit = sql.NullInt64{Int64: int64(*args.PerMinute), Valid: true}
+	}
+	var alias db.Alias
+	err = r.audited(ctx, "setAliasRateLimit", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAliasByID(ctx, id)
+		if err != nil {
+			return auditChange{}, aliasErr(err)
+		}
+		alias, err = tx.UpdateAliasRateLimit(ctx, id, limit)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "alias",
+			targetID:   idString(id),
+			old:        map[string]any{"rate_limit_per_minute": optInt64(before.RateLimitPerMinute)},
+			new:        map[string]any{"rate_limit_per_minute": optInt64(alias.RateLimitPerMinute)},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AliasResolver{alias: alias}, nil
+}
+
+// RenameAlias changes an alias's label and the full_acct derived from it.
+func (r *Resolver) RenameAlias(ctx context.Context, args struct {
+	AliasID    graph.ID
+	AliasLabel string
+}) (*AliasResolver, error) {
+	id, err := parseID(args.AliasID)
+	if err != nil {
+		return nil, err
+	}
+	label, err := r.aliasLabelArg(args.AliasLabel)
+	if err != nil {
+		return nil, err
+	}
+	var alias db.Alias
+	err = r.audited(ctx, "renameAlias", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAliasByID(ctx, id)
+		if err != nil {
+			return auditChange{}, aliasErr(err)
+		}
+		account, err := tx.GetAccount(ctx, before.AccountID)
+		if err != nil {
+			return auditChange{}, err
+		}
+		fullAcct := buildFullAcct(account.Handle, label)
+		existing, err := tx.GetAliasByFullAcct(ctx, fullAcct)
+		switch {
+		case err == nil && existing.ID != id:
+			return auditChange{}, fmt.Errorf("alias %s already exists", fullAcct)
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			return auditChange{}, err
+		}
+		alias, err = tx.RenameAlias(ctx, id, fullAcct, label)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "alias",
+			targetID:   idString(id),
+			old:        map[string]any{"full_acct": before.FullAcct, "alias_label": before.AliasLabel},
+			new:        map[string]any{"full_acct": alias.FullAcct, "alias_label": alias.AliasLabel},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AliasResolver{alias: alias}, nil
+}
+
+// SetAliasEnabled switches an alias on or off. Resolving a disabled alias
+// behaves as if it did not exist.
+func (r *Resolver) SetAliasEnabled(ctx context.Context, args struct {
+	AliasID graph.ID
+	Enabled bool
 }) (*AliasResolver, error) {
 	id, err := parseID(args.AliasID)
 	if err != nil {
 		return nil, err
 	}
-	alias, err := r.db.UpdateAliasNextIndex(ctx, id, sql.NullInt64{Int64: int64(args.NextSubaddrIdx), Valid: true})
+	var alias db.Alias
+	err = r.audited(ctx, "setAliasEnabled", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetAliasByID(ctx, id)
+		if err != nil {
+			return auditChange{}, aliasErr(err)
+		}
+		alias, err = tx.SetAliasEnabled(ctx, id, args.Enabled)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "alias",
+			targetID:   idString(id),
+			old:        map[string]any{"enabled": before.Enabled},
+			new:        map[string]any{"enabled": alias.Enabled},
+		}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 	return &AliasResolver{alias: alias}, nil
 }
 
-func (r *Resolver) LockInstance(ctx context.Context, args struct{ Reason string }) (*InstanceInfoResolver, error) {
-	cfg, err := r.db.UpdateInstanceStatus(ctx, "LOCKED", sql.NullString{String: args.Reason, Valid: true}, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+func (r *Resolver) DeleteAlias(ctx context.Context, args struct{ ID graph.ID }) (bool, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return false, err
+	}
+	err = r.audited(ctx, "deleteAlias", func(tx *db.DB) (auditChange, error) {
+		alias, err := tx.GetAliasByID(ctx, id)
+		if err != nil {
+			return auditChange{}, aliasErr(err)
+		}
+		if err := tx.DeleteAlias(ctx, id); err != nil {
+			return auditChange{}, aliasErr(err)
+		}
+		return auditChange{
+			targetType: "alias",
+			targetID:   idString(id),
+			old:        map[string]any{"full_acct": alias.FullAcct, "mode": alias.Mode},
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StageSigningKey adds a key to a domain's key ring, the primary domain's
+// unless domain is given, in the NEXT state so it is published before it
+// starts signing. Without a seed a fresh key is generated server-side.
+func (r *Resolver) StageSigningKey(ctx context.Context, args struct {
+	Kid    string
+	Seed   *string
+	Domain *string
+}) (*SigningKeyResolver, error) {
+	if strings.TrimSpace(args.Kid) == "" {
+		return nil, errors.New("kid is required")
+	}
+	priv, err := signingKeyFromSeed(args.Seed)
+	if err != nil {
+		return nil, err
+	}
+	pub := base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))
+	seed := sql.NullString{String: r.seals.Seal(args.Kid, priv.Seed()), Valid: true}
+	domain, err := r.domainArg(args.Domain)
+	if err != nil {
+		return nil, err
+	}
+	var key db.SigningKey
+	err = r.audited(ctx, "stageSigningKey", func(tx *db.DB) (auditChange, error) {
+		if _, err := tx.GetDomain(ctx, domain); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return auditChange{}, fmt.Errorf("unknown domain %s", domain)
+			}
+			return auditChange{}, err
+		}
+		var err error
+		key, err = tx.CreateSigningKey(ctx, domain, args.Kid, pub, seed, db.SigningKeyNext)
+		if err != nil {
+			return auditChange{}, err
+		}
+		// Never record the seed.
+		return auditChange{
+			targetType: "signing_key",
+			targetID:   key.KID,
+			new:        map[string]any{"domain": key.Domain, "public_key": key.PublicKey, "state": key.State},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKeyResolver{key: key}, nil
+}
+
+// signingKeyFromSeed decodes a base64 Ed25519 seed, or generates a fresh key
+// when seed is empty.
+func signingKeyFromSeed(seed *string) (ed25519.PrivateKey, error) {
+	if seed == nil || *seed == "" {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(*seed))
+	if err != nil || len(raw) != ed25519.SeedSize {
+		return nil, errors.New("seed must be a base64-encoded 32-byte Ed25519 seed")
+	}
+	return ed25519.NewKeyFromSeed(raw), nil
+}
+
+func (r *Resolver) ActivateSigningKey(ctx context.Context, args struct{ Kid string }) (*SigningKeyResolver, error) {
+	var key db.SigningKey
+	err := r.audited(ctx, "activateSigningKey", func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetSigningKey(ctx, args.Kid)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if before.State == db.SigningKeyRevoked {
+			return auditChange{}, errors.New("revoked keys cannot be activated")
+		}
+		if !before.PrivateSeed.Valid {
+			return auditChange{}, errors.New("signing key has no private seed")
+		}
+		if _, err := r.seals.Open(before.KID, before.PrivateSeed.String); err != nil {
+			return auditChange{}, fmt.Errorf("signing key %s: %w", before.KID, err)
+		}
+		previous, err := tx.GetActiveSigningKey(ctx, before.Domain)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return auditChange{}, err
+		}
+		key, err = tx.ActivateSigningKey(ctx, args.Kid)
+		if err != nil {
+			return auditChange{}, err
+		}
+		oldValue := map[string]any{"state": before.State}
+		if previous.KID != "" && previous.KID != key.KID {
+			oldValue["retired_kid"] = previous.KID
+		}
+		return auditChange{
+			targetType: "signing_key",
+			targetID:   key.KID,
+			old:        oldValue,
+			new:        map[string]any{"state": key.State},
+		}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &InstanceInfoResolver{cfg: cfg}, nil
+	return &SigningKeyResolver{key: key}, nil
+}
+
+func (r *Resolver) RetireSigningKey(ctx context.Context, args struct{ Kid string }) (*SigningKeyResolver, error) {
+	return r.endSigningKey(ctx, "retireSigningKey", args.Kid, db.SigningKeyRetired)
+}
+
+func (r *Resolver) RevokeSigningKey(ctx context.Context, args struct{ Kid string }) (*SigningKeyResolver, error) {
+	return r.endSigningKey(ctx, "revokeSigningKey", args.Kid, db.SigningKeyRevoked)
+}
+
+func (r *Resolver) endSigningKey(ctx context.Context, mutation, kid, state string) (*SigningKeyResolver, error) {
+	var key db.SigningKey
+	err := r.audited(ctx, mutation, func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetSigningKey(ctx, kid)
+		if err != nil {
+			return auditChange{}, err
+		}
+		switch {
+		case before.State == db.SigningKeyActive:
+			return auditChange{}, errors.New("activate another key before retiring the active key")
+		case before.State == db.SigningKeyRevoked:
+			return auditChange{}, fmt.Errorf("signing key %s is revoked", kid)
+		case before.State == state:
+			return auditChange{}, fmt.Errorf("signing key %s is already %s", kid, strings.ToLower(state))
+		}
+		key, err = tx.UpdateSigningKeyState(ctx, kid, state)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "signing_key",
+			targetID:   kid,
+			old:        map[string]any{"state": before.State},
+			new:        map[string]any{"state": key.State},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKeyResolver{key: key}, nil
+}
+
+func (r *Resolver) LockInstance(ctx context.Context, args struct {
+	Reason string
+	Domain *string
+}) (*DomainResolver, error) {
+	name, err := r.domainArg(args.Domain)
+	if err != nil {
+		return nil, err
+	}
+	return r.setInstanceStatus(ctx, "lockInstance", name, "LOCKED", sql.NullString{String: args.Reason, Valid: true})
+}
+
+func (r *Resolver) UnlockInstance(ctx context.Context, args struct{ Domain *string }) (*DomainResolver, error) {
+	return r.identityCheck(ctx, "unlockInstance", args.Domain)
+}
+
+func (r *Resolver) RunIdentityCheck(ctx context.Context, args struct{ Domain *string }) (*DomainResolver, error) {
+	return r.identityCheck(ctx, "runIdentityCheck", args.Domain)
 }
 
-func (r *Resolver) UnlockInstance(ctx context.Context) (*InstanceInfoResolver, error) {
-	cfg, err := r.watchdog.CheckOnce(ctx)
+// identityCheck runs the watchdog's probe for one domain outside the
+// transaction, then stores and audits the status it produced.
+func (r *Resolver) identityCheck(ctx context.Context, mutation string, domainArg *string) (*DomainResolver, error) {
+	name, err := r.domainArg(domainArg)
 	if err != nil {
 		return nil, err
 	}
-	return &InstanceInfoResolver{cfg: cfg}, nil
+	domain, err := r.db.GetDomain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	status, reason, err := r.watchdog.Evaluate(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	return r.setInstanceStatus(ctx, mutation, name, status, reason)
 }
 
-func (r *Resolver) RunIdentityCheck(ctx context.Context) (*InstanceInfoResolver, error) {
-	cfg, err := r.watchdog.CheckOnce(ctx)
+func (r *Resolver) setInstanceStatus(ctx context.Context, mutation, name, status string, reason sql.NullString) (*DomainResolver, error) {
+	var domain db.Domain
+	err := r.audited(ctx, mutation, func(tx *db.DB) (auditChange, error) {
+		before, err := tx.GetDomain(ctx, name)
+		if err != nil {
+			return auditChange{}, err
+		}
+		domain, err = tx.UpdateDomainStatus(ctx, name, status, reason, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{
+			targetType: "domain",
+			targetID:   domain.Domain,
+			old:        map[string]any{"status": before.Status, "status_reason": optString(before.StatusReason)},
+			new:        map[string]any{"status": domain.Status, "status_reason": optString(domain.StatusReason)},
+		}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &InstanceInfoResolver{cfg: cfg}, nil
+	return &DomainResolver{db: r.db, domain: domain}, nil
 }
 
 // --- Resolvers ---
 
-type InstanceInfoResolver struct {
-	cfg db.InstanceConfig
+type SigningKeyResolver struct {
+	key db.SigningKey
 }
 
-func (r *InstanceInfoResolver) Domain() string        { return r.cfg.Domain }
-func (r *InstanceInfoResolver) Homeserver() string    { return r.cfg.Homeserver }
-func (r *InstanceInfoResolver) SigningKeyId() string  { return r.cfg.SigningKeyID }
-func (r *InstanceInfoResolver) SigningPubkey() string { return r.cfg.SigningPubkey }
-func (r *InstanceInfoResolver) Status() string        { return r.cfg.Status }
-func (r *InstanceInfoResolver) StatusReason() *string {
-	if r.cfg.StatusReason.Valid {
-		return &r.cfg.StatusReason.String
+func (r *SigningKeyResolver) Kid() string         { return r.key.KID }
+func (r *SigningKeyResolver) Domain() string      { return r.key.Domain }
+func (r *SigningKeyResolver) PublicKey() string   { return r.key.PublicKey }
+func (r *SigningKeyResolver) State() string       { return r.key.State }
+func (r *SigningKeyResolver) CreatedAt() DateTime { return DateTime{Time: r.key.CreatedAt} }
+func (r *SigningKeyResolver) ActivatedAt() *DateTime {
+	if r.key.ActivatedAt.Valid {
+		return &DateTime{Time: r.key.ActivatedAt.Time}
 	}
 	return nil
 }
-func (r *InstanceInfoResolver) LastIdentityCheckAt() *graph.Time {
-	if r.cfg.LastIdentityCheckAt.Valid {
-		return &graph.Time{Time: r.cfg.LastIdentityCheckAt.Time}
+func (r *SigningKeyResolver) RetiredAt() *DateTime {
+	if r.key.RetiredAt.Valid {
+		return &DateTime{Time: r.key.RetiredAt.Time}
 	}
 	return nil
 }
@@ -302,13 +1010,23 @@ type AccountResolver struct {
 
 func (r *AccountResolver) ID() graph.ID   { return graph.ID(fmt.Sprintf("%d", r.account.ID)) }
 func (r *AccountResolver) Handle() string { return r.account.Handle }
-func (r *AccountResolver) WalletName() *string {
-	if r.account.WalletName.Valid {
-		return &r.account.WalletName.String
+func (r *AccountResolver) WalletName(args struct{ Network string }) *string {
+	wallet := r.account.WalletFor(networkFromEnum(args.Network))
+	if wallet.Valid {
+		return &wallet.String
 	}
 	return nil
 }
-func (r *AccountResolver) CreatedAt() graph.Time { return graph.Time{Time: r.account.CreatedAt} }
+func (r *AccountResolver) CatchAllMode() string {
+	if r.account.CatchAllMode.Valid {
+		return r.account.CatchAllMode.String
+	}
+	return "INHERIT"
+}
+func (r *AccountResolver) CatchAllAddress(args struct{ Network string }) *string {
+	return optString(r.account.CatchAllFor(networkFromEnum(args.Network)))
+}
+func (r *AccountResolver) CreatedAt() DateTime { return DateTime{Time: r.account.CreatedAt} }
 func (r *AccountResolver) Aliases(ctx context.Context) ([]*AliasResolver, error) {
 	aliases, err := r.db.ListAliasesForAccount(ctx, r.account.ID)
 	if err != nil {
@@ -329,21 +1047,38 @@ func (r *AliasResolver) ID() graph.ID       { return graph.ID(fmt.Sprintf("%d",
 func (r *AliasResolver) FullAcct() string   { return r.alias.FullAcct }
 func (r *AliasResolver) AliasLabel() string { return r.alias.AliasLabel }
 func (r *AliasResolver) Mode() string       { return r.alias.Mode }
-func (r *AliasResolver) StaticAddress() *string {
-	if r.alias.StaticAddress.Valid {
-		return &r.alias.StaticAddress.String
+func (r *AliasResolver) StaticAddress(args struct{ Network string }) *string {
+	address, _ := r.alias.AddressFor(networkFromEnum(args.Network))
+	if address.Valid {
+		return &address.String
+	}
+	return nil
+}
+func (r *AliasResolver) NextSubaddrIdx(args struct{ Network string }) *int32 {
+	_, idx := r.alias.AddressFor(networkFromEnum(args.Network))
+	if idx.Valid {
+		val := int32(idx.Int64)
+		return &val
 	}
 	return nil
 }
-func (r *AliasResolver) NextSubaddrIdx() *int32 {
-	if r.alias.NextSubaddrIdx.Valid {
-		val := int32(r.alias.NextSubaddrIdx.Int64)
+func (r *AliasResolver) TtlSeconds() *int32 {
+	if r.alias.TTLSeconds.Valid {
+		val := int32(r.alias.TTLSeconds.Int64)
 		return &val
 	}
 	return nil
 }
-func (r *AliasResolver) CreatedAt() graph.Time { return graph.Time{Time: r.alias.CreatedAt} }
-func (r *AliasResolver) UpdatedAt() graph.Time { return graph.Time{Time: r.alias.UpdatedAt} }
+func (r *AliasResolver) RateLimitPerMinute() *int32 {
+	if r.alias.RateLimitPerMinute.Valid {
+		val := int32(r.alias.RateLimitPerMinute.Int64)
+		return &val
+	}
+	return nil
+}
+func (r *AliasResolver) Enabled() bool       { return r.alias.Enabled }
+func (r *AliasResolver) CreatedAt() DateTime { return DateTime{Time: r.alias.CreatedAt} }
+func (r *AliasResolver) UpdatedAt() DateTime { return DateTime{Time: r.alias.UpdatedAt} }
 
 // --- Helpers ---
 
@@ -355,16 +1090,65 @@ func parseID(id graph.ID) (int64, error) {
 	return parsed, nil
 }
 
-func acctMatchesDomain(acct, domain string) bool {
-	parts := strings.Split(acct, "$")
-	if len(parts) != 2 {
-		return false
+// networkFromEnum maps a Network enum value to the lowercase name used on the
+// wire and in the database.
+func networkFromEnum(network string) string {
+	return strings.ToLower(network)
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil || *s == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+// handleArg normalizes a handle argument and checks its local part against
+// the naming policy. A handle has no +label; those belong to aliases.
+func (r *Resolver) handleArg(handle string) (string, error) {
+	if !strings.Contains(handle, "$") {
+		return "", &argumentError{field: "handle", err: errors.New("must have the form name$domain")}
+	}
+	out, err := names.Acct(handle)
+	if err != nil {
+		return "", &argumentError{field: "handle", err: err}
+	}
+	local, _, _ := strings.Cut(out, "$")
+	if strings.Contains(local, "+") {
+		return "", &argumentError{field: "handle", err: errLabelInHandle}
+	}
+	if err := r.names.Local(local); err != nil {
+		return "", &argumentError{field: "handle", err: err}
+	}
+	return out, nil
+}
+
+// defaultAliasLabel is the label of an account's default alias, whose
+// full_acct is the bare handle.
+const defaultAliasLabel = "default"
+
+// aliasLabelArg normalizes an alias label argument and checks it against
+// the naming policy. An empty label stands for the default alias and comes
+// back as defaultAliasLabel, which the policy does not apply to.
+func (r *Resolver) aliasLabelArg(label string) (string, error) {
+	if label == "" {
+		return defaultAliasLabel, nil
+	}
+	out, err := names.Label(label)
+	if err != nil {
+		return "", &argumentError{field: "aliasLabel", err: err}
+	}
+	if out == defaultAliasLabel {
+		return out, nil
+	}
+	if err := r.names.Label(out); err != nil {
+		return "", &argumentError{field: "aliasLabel", err: err}
 	}
-	return strings.EqualFold(parts[1], domain)
+	return out, nil
 }
 
 func buildFullAcct(handle, label string) string {
-	if label == "" || label == "default" {
+	if label == defaultAliasLabel {
 		return handle
 	}
 	parts := strings.Split(handle, "$")
@@ -0,0 +1,122 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/graph-gophers/graphql-go/relay"
+
+	"github.com/kaigoh/monalias/internal/audit"
+	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/db"
+	httpx "github.com/kaigoh/monalias/internal/http"
+	"github.com/kaigoh/monalias/internal/monero"
+	"github.com/kaigoh/monalias/internal/seal"
+)
+
+// testSeals seals the signing key seeds the tests store.
+var testSeals = func() *seal.Box {
+	box, err := seal.New(make([]byte, seal.KeySize))
+	if err != nil {
+		panic(err)
+	}
+	return box
+}()
+
+type testEnv struct {
+	db      *db.DB
+	handler *relay.Handler
+	// guard bans a client after a single missed resolve.
+	guard *httpx.EnumerationGuard
+}
+
+// newTestEnv serves the admin schema over a fresh database with the
+// primary domain example.com, whose ACTIVE key is k1.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "monalias.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{Domain: "example.com", ReservedNames: []string{"admin"}}
+	guard := httpx.NewEnumerationGuard(httpx.EnumerationConfig{
+		Window:        time.Minute,
+		MinLookups:    1,
+		NotFoundRatio: 1,
+		BanDuration:   time.Hour,
+	}, httpx.NewClientIPResolver(nil, "X-Forwarded-For", 64), slog.New(slog.DiscardHandler))
+	handler, err := NewHandler(cfg, database, testSeals, monero.NewWalletSessions(nil), nil, guard, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &testEnv{db: database, handler: handler, guard: guard}
+	env.mustExec(t, `mutation { createDomain(domain: "example.com", homeserver: "https://monalias.example.com", kid: "k1") { domain } }`)
+	return env
+}
+
+// gqlError is the part of a GraphQL error the tests look at.
+type gqlError struct {
+	Message    string         `json:"message"`
+	Extensions map[string]any `json:"extensions"`
+}
+
+// exec runs query as the admin "tester" and returns its data and errors.
+func (e *testEnv) exec(t *testing.T, query string) (json.RawMessage, []gqlError) {
+	t.Helper()
+	ctx := audit.WithPrincipal(context.Background(), "tester")
+	resp := e.handler.Schema.Exec(ctx, query, "", nil)
+	raw, err := json.Marshal(resp.Errors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []gqlError
+	if err := json.Unmarshal(raw, &errs); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data, errs
+}
+
+// mustExec runs query and fails the test on any error.
+func (e *testEnv) mustExec(t *testing.T, query string) json.RawMessage {
+	t.Helper()
+	data, errs := e.exec(t, query)
+	if len(errs) > 0 {
+		t.Fatalf("%s: %v", query, errs)
+	}
+	return data
+}
+
+// auditCount returns the number of audit_log entries.
+func (e *testEnv) auditCount(t *testing.T) int {
+	t.Helper()
+	var n int
+	if err := e.db.SQL().QueryRow(`SELECT COUNT(*) FROM audit_log`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// mustFail runs a mutation that has to fail without writing to the audit
+// log, and returns its error.
+func (e *testEnv) mustFail(t *testing.T, query string) gqlError {
+	t.Helper()
+	before := e.auditCount(t)
+	data, errs := e.exec(t, query)
+	if len(errs) == 0 {
+		t.Fatalf("%s succeeded: %s", query, data)
+	}
+	if after := e.auditCount(t); after != before {
+		t.Errorf("%s: audit entries %d -> %d", query, before, after)
+	}
+	return errs[0]
+}
@@ -0,0 +1,97 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/kaigoh/monalias/internal/db"
+	"github.com/kaigoh/monalias/internal/seal"
+)
+
+func TestEndSigningKeyRejectsIllegalTransitions(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustExec(t, `mutation { stageSigningKey(kid: "k2") { kid } }`)
+	env.mustExec(t, `mutation { retireSigningKey(kid: "k2") { kid } }`)
+	env.mustExec(t, `mutation { stageSigningKey(kid: "k3") { kid } }`)
+	env.mustExec(t, `mutation { revokeSigningKey(kid: "k3") { kid } }`)
+
+	tests := []struct {
+		mutation string
+		want     string
+	}{
+		{`retireSigningKey(kid: "k1")`, "activate another key"},
+		{`revokeSigningKey(kid: "k1")`, "activate another key"},
+		{`retireSigningKey(kid: "k2")`, "already retired"},
+		{`retireSigningKey(kid: "k3")`, "is revoked"},
+		{`revokeSigningKey(kid: "k3")`, "is revoked"},
+		{`activateSigningKey(kid: "k3")`, "revoked keys cannot be activated"},
+	}
+	for _, tt := range tests {
+		err := env.mustFail(t, `mutation { `+tt.mutation+` { kid } }`)
+		if !strings.Contains(err.Message, tt.want) {
+			t.Errorf("%s: error %q; want %q", tt.mutation, err.Message, tt.want)
+		}
+	}
+
+	ctx := context.Background()
+	for kid, want := range map[string]string{"k1": "ACTIVE", "k2": "RETIRED", "k3": "REVOKED"} {
+		key, err := env.db.GetSigningKey(ctx, kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.State != want {
+			t.Errorf("%s state = %s; want %s", kid, key.State, want)
+		}
+	}
+	published, err := env.db.ListPublishedSigningKeys(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range published {
+		if key.KID == "k3" {
+			t.Error("revoked key k3 is published")
+		}
+	}
+}
+
+func TestStageSigningKeySealsSeed(t *testing.T) {
+	env := newTestEnv(t)
+	seed := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{5}, ed25519.SeedSize))
+	env.mustExec(t, `mutation { stageSigningKey(kid: "k2", seed: "`+seed+`") { kid } }`)
+
+	ctx := context.Background()
+	for _, kid := range []string{"k1", "k2"} {
+		key, err := env.db.GetSigningKey(ctx, kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !seal.IsSealed(key.PrivateSeed.String) {
+			t.Errorf("%s: stored seed %q is not sealed", kid, key.PrivateSeed.String)
+		}
+		if _, err := testSeals.Open(kid, key.PrivateSeed.String); err != nil {
+			t.Errorf("%s: %v", kid, err)
+		}
+	}
+	var n int
+	if err := env.db.SQL().QueryRow(`SELECT COUNT(*) FROM signing_keys WHERE private_seed LIKE ?`, "%"+seed+"%").Scan(&n); err != nil || n != 0 {
+		t.Errorf("plaintext seed stored in %d rows (%v)", n, err)
+	}
+
+	// A seed that does not open with the seal key is not activated.
+	other, err := seal.New(bytes.Repeat([]byte{9}, seal.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := sql.NullString{String: other.Seal("k3", bytes.Repeat([]byte{6}, ed25519.SeedSize)), Valid: true}
+	if _, err := env.db.CreateSigningKey(ctx, "example.com", "k3", "pub", wrong, db.SigningKeyNext); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.mustFail(t, `mutation { activateSigningKey(kid: "k3") { kid } }`); !strings.Contains(err.Message, "does not open") {
+		t.Errorf("activate unopenable key: %q", err.Message)
+	}
+}
@@ -2,17 +2,23 @@ package httpx
 
 import (
 	"crypto/subtle"
+	"log/slog"
 	"net/http"
 
+	"github.com/kaigoh/monalias/internal/audit"
 	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/db"
+	"github.com/kaigoh/monalias/internal/metrics"
 	"github.com/kaigoh/monalias/internal/ui"
 )
 
-func AdminHandler(cfg config.Config, gqlHandler http.Handler) http.Handler {
+func AdminHandler(cfg config.Config, database *db.DB, gqlHandler http.Handler, logger *slog.Logger) http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/graphql", basicAuth(cfg, gqlHandler))
+	mux.Handle("/audit-log.jsonl", basicAuth(cfg, auditExportHandler(database, logger)))
+	mux.Handle("/metrics", basicAuth(cfg, metrics.Handler()))
 	mux.Handle("/", basicAuth(cfg, ui.Handler()))
-	return mux
+	return requestID(mux)
 }
 
 func basicAuth(cfg config.Config, next http.Handler) http.Handler {
@@ -23,7 +29,7 @@ func basicAuth(cfg config.Config, next http.Handler) http.Handler {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(audit.WithPrincipal(r.Context(), user)))
 	})
 }
 
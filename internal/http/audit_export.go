@@ -0,0 +1,96 @@
+package httpx
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/db"
+)
+
+type auditExportEntry struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Principal  string          `json:"principal"`
+	Mutation   string          `json:"mutation"`
+	TargetType *string         `json:"target_type"`
+	TargetID   *string         `json:"target_id"`
+	OldValue   json.RawMessage `json:"old_value"`
+	NewValue   json.RawMessage `json:"new_value"`
+}
+
+// auditExportHandler streams the audit log as JSON lines, oldest first. It
+// accepts the same filters as the auditLog query as query parameters:
+// principal, mutation, target_type, target_id, and RFC 3339 since/until.
+func auditExportHandler(database *db.DB, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+			return
+		}
+		q := r.URL.Query()
+		filter := db.AuditFilter{
+			Principal:  q.Get("principal"),
+			Mutation:   q.Get("mutation"),
+			TargetType: q.Get("target_type"),
+			TargetID:   q.Get("target_id"),
+		}
+		var err error
+		if filter.Since, err = parseTimeParam(q.Get("since")); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_since")
+			return
+		}
+		if filter.Until, err = parseTimeParam(q.Get("until")); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_until")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="monalias-audit-log.jsonl"`)
+		enc := json.NewEncoder(w)
+		err = database.EachAuditEntry(r.Context(), filter, func(e db.AuditEntry) error {
+			return enc.Encode(auditExportEntry{
+				ID:         e.ID,
+				CreatedAt:  e.CreatedAt.UTC(),
+				Principal:  e.Principal,
+				Mutation:   e.Mutation,
+				TargetType: nullableString(e.TargetType),
+				TargetID:   nullableString(e.TargetID),
+				OldValue:   rawJSON(e.OldValue),
+				NewValue:   rawJSON(e.NewValue),
+			})
+		})
+		if err != nil {
+			// Headers are gone by now; all we can do is cut the stream short.
+			logger.ErrorContext(r.Context(), "audit export failed", "err", err)
+		}
+	})
+}
+
+func parseTimeParam(v string) (sql.NullTime, error) {
+	if v == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+func nullableString(s sql.NullString) *string {
+	if s.Valid {
+		return &s.String
+	}
+	return nil
+}
+
+// rawJSON embeds a stored JSON snapshot as-is rather than as a quoted string.
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s.String)
+}
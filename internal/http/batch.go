@@ -0,0 +1,93 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/metrics"
+)
+
+// maxBatchBodySize bounds the resolve-batch request body; even
+// MONALIAS_BATCH_MAX pairs of long accts fit well within it.
+const maxBatchBodySize = 1 << 20
+
+type batchRequest struct {
+	Items []resolveRequest `json:"items"`
+}
+
+type batchResponse struct {
+	Results []batchItem `json:"results"`
+}
+
+// batchItem carries what the single resolve endpoint would have answered for
+// one pair: its status, its JSON body as response, and the key_id and
+// signature it would have sent as headers.
+type batchItem struct {
+	Acct      string      `json:"acct"`
+	Network   string      `json:"network"`
+	Status    int         `json:"status"`
+	Response  interface{} `json:"response"`
+	KeyID     string      `json:"key_id,omitempty"`
+	Signature string      `json:"signature,omitempty"`
+}
+
+// handleResolveBatch resolves up to cfg.BatchMax pairs in one request. The
+// client is charged one rate limit token per pair, so a batch costs what the
+// same lookups would have cost one by one, and every pair counts towards
+// enumeration detection.
+func (s *PublicService) handleResolveBatch(limiter *IPRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req batchRequest
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodySize)).Decode(&req)
+		if err != nil || len(req.Items) == 0 || len(req.Items) > s.cfg.BatchMax {
+			// A refused batch resolves nothing, so it costs what one bad
+			// resolve would.
+			if limiter != nil && !limiter.allowN(r, 1) {
+				writeRateLimited(w)
+				return
+			}
+			metrics.ObserveResolve(metrics.OutcomeBadRequest, "", 0)
+			if err == nil && len(req.Items) > s.cfg.BatchMax {
+				writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "batch_too_large", "max_items": s.cfg.BatchMax})
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "bad_request")
+			return
+		}
+		if limiter != nil && !limiter.allowN(r, len(req.Items)) {
+			writeRateLimited(w)
+			return
+		}
+
+		ctx := r.Context()
+		out := batchResponse{Results: make([]batchItem, 0, len(req.Items))}
+		for _, item := range req.Items {
+			start := time.Now()
+			// Every pair gets the answer a single resolve would, so a
+			// locked domain is reported per item too.
+			res := s.resolve(ctx, item)
+			metrics.ObserveResolve(res.outcome, item.Network, time.Since(start))
+			reportOutcome(ctx, res.outcome)
+
+			out.Results = append(out.Results, batchItem{
+				Acct:      item.Acct,
+				Network:   item.Network,
+				Status:    res.status,
+				Response:  res.body,
+				KeyID:     res.kid,
+				Signature: res.sig,
+			})
+		}
+
+		// Items expire at different times, so the batch as a whole is not
+		// cacheable; clients cache per item using expires_at.
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, out)
+	}
+}
@@ -0,0 +1,280 @@
+package httpx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/db"
+)
+
+// newCatchAllEnv serves example.org with a mainnet domain catch-all and
+// returns bob's account there.
+func newCatchAllEnv(t *testing.T) (*testEnv, db.Account) {
+	t.Helper()
+	env := newTestEnv(t, false)
+	env.addDomain(t, "example.org", "https://monalias.example.org", "org1")
+	ctx := context.Background()
+	if _, err := env.db.UpdateDomainCatchAll(ctx, "example.org", "mainnet", sql.NullString{String: testAddress, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := env.db.CreateAccount(ctx, "bob$example.org", sql.NullString{}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.CreateAlias(ctx, bob.ID, "bob$example.org", "default", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+	return env, bob
+}
+
+func setCatchAllMode(t *testing.T, env *testEnv, account db.Account, mode string) {
+	t.Helper()
+	if _, err := env.db.UpdateAccountCatchAllMode(context.Background(), account.ID, sql.NullString{String: mode, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func resolvedKind(body map[string]interface{}) interface{} {
+	meta, _ := body["meta"].(map[string]interface{})
+	return meta["resolved_kind"]
+}
+
+func TestAccountWithoutModeFollowsDomainCatchAll(t *testing.T) {
+	env, _ := newCatchAllEnv(t)
+
+	resp, body := env.resolveAcct(t, "bob+rent$example.org", "mainnet")
+	if resp.StatusCode != http.StatusOK || body["address"] != testAddress || resolvedKind(body) != "CATCH_ALL" {
+		t.Errorf("got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestAccountCatchAllOff(t *testing.T) {
+	env, bob := newCatchAllEnv(t)
+	setCatchAllMode(t, env, bob, db.CatchAllOff)
+
+	if resp, body := env.resolveAcct(t, "bob+rent$example.org", "mainnet"); resp.StatusCode != http.StatusNotFound || body["error"] != "alias_not_found" {
+		t.Errorf("bob+rent: got %d %v", resp.StatusCode, body)
+	}
+	if resp, body := env.resolveAcct(t, "alice$example.org", "mainnet"); resp.StatusCode != http.StatusOK || resolvedKind(body) != "CATCH_ALL" {
+		t.Errorf("alice: got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestAccountCatchAllDefaultAlias(t *testing.T) {
+	env, bob := newCatchAllEnv(t)
+	setCatchAllMode(t, env, bob, db.CatchAllDefaultAlias)
+
+	resp, body := env.resolveAcct(t, "bob+rent$example.org", "mainnet")
+	if resp.StatusCode != http.StatusOK || body["address"] != testAddress || resolvedKind(body) != "DEFAULT_ALIAS" {
+		t.Fatalf("got %d %v", resp.StatusCode, body)
+	}
+	if meta := body["meta"].(map[string]interface{}); meta["alias"] != "default" || meta["display_name"] != "bob" {
+		t.Errorf("meta = %v", meta)
+	}
+
+	// A disabled default alias leaves nothing to fall back to.
+	alias, err := env.db.GetAliasByFullAcct(context.Background(), "bob$example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.SetAliasEnabled(context.Background(), alias.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, acct := range []string{"bob+rent$example.org", "bob$example.org"} {
+		if resp, body := env.resolveAcct(t, acct, "mainnet"); resp.StatusCode != http.StatusNotFound || body["error"] != "alias_not_found" {
+			t.Errorf("%s with default alias disabled: got %d %v", acct, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestAccountCatchAllAddress(t *testing.T) {
+	env, bob := newCatchAllEnv(t)
+	setCatchAllMode(t, env, bob, db.CatchAllAddress)
+	if _, err := env.db.UpdateAccountCatchAll(context.Background(), bob.ID, "stagenet", sql.NullString{String: testStagenetAddress, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := env.resolveAcct(t, "bob+rent$example.org", "stagenet")
+	if resp.StatusCode != http.StatusOK || body["address"] != testStagenetAddress || resolvedKind(body) != "ACCOUNT_CATCH_ALL" {
+		t.Fatalf("got %d %v", resp.StatusCode, body)
+	}
+	if meta := body["meta"].(map[string]interface{}); meta["display_name"] != "bob (catch-all)" {
+		t.Errorf("meta = %v", meta)
+	}
+	// The account's rule wins over the domain's mainnet catch-all.
+	if resp, body := env.resolveAcct(t, "bob+rent$example.org", "mainnet"); resp.StatusCode != http.StatusNotFound || body["error"] != "network_not_supported" {
+		t.Errorf("mainnet: got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestAccountCatchAllProvision(t *testing.T) {
+	env := newTestEnv(t, true)
+	ctx := context.Background()
+	bob, err := env.db.CreateAccount(ctx, "bob$example.com", sql.NullString{String: "bob", Valid: true}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.CreateAlias(ctx, bob.ID, "bob$example.com", "default", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+	setCatchAllMode(t, env, bob, db.CatchAllProvision)
+
+	resp, body := env.resolveAcct(t, "bob+coffee$example.com", "mainnet")
+	if resp.StatusCode != http.StatusOK || resolvedKind(body) != "PROVISIONED" {
+		t.Fatalf("first resolve: got %d %v", resp.StatusCode, body)
+	}
+	if labels := env.wallet.createdLabels(); len(labels) != 1 || labels[0] != "coffee" {
+		t.Errorf("create_address labels = %v", labels)
+	}
+	alias, err := env.db.GetAliasByFullAcct(ctx, "bob+coffee$example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alias.AliasLabel != "coffee" || alias.Mode != "DYNAMIC_SUBADDRESS" {
+		t.Errorf("provisioned alias = %+v", alias)
+	}
+
+	if resp, body := env.resolveAcct(t, "bob+coffee$example.com", "mainnet"); resp.StatusCode != http.StatusOK || resolvedKind(body) != "NORMAL" {
+		t.Errorf("second resolve: got %d %v", resp.StatusCode, body)
+	}
+
+	// Labels unfit for an alias, reserved ones included, and networks
+	// without a wallet, fall back to the default alias.
+	for _, acct := range []string{"bob+Not.Fit$example.com", "bob+admin$example.com"} {
+		if resp, body := env.resolveAcct(t, acct, "mainnet"); resp.StatusCode != http.StatusOK || resolvedKind(body) != "DEFAULT_ALIAS" {
+			t.Errorf("%s: got %d %v", acct, resp.StatusCode, body)
+		}
+		if _, err := env.db.GetAliasByFullAcct(ctx, acct); err == nil {
+			t.Errorf("alias provisioned for %s", acct)
+		}
+	}
+}
+
+// newProvisionEnv serves bob$example.com, with a default alias, in
+// PROVISION mode with the given provisioning cap and rate.
+func newProvisionEnv(t *testing.T, maxPerAccount, ratePerMinute int) (*testEnv, db.Account) {
+	t.Helper()
+	env := newTestEnvConfig(t, true, config.Config{
+		Domain:                 "example.com",
+		ResolveTTL:             5 * time.Minute,
+		ProvisionMaxPerAccount: maxPerAccount,
+		ProvisionRatePerMinute: ratePerMinute,
+	})
+	ctx := context.Background()
+	bob, err := env.db.CreateAccount(ctx, "bob$example.com", sql.NullString{String: "bob", Valid: true}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.CreateAlias(ctx, bob.ID, "bob$example.com", "default", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+	setCatchAllMode(t, env, bob, db.CatchAllProvision)
+	return env, bob
+}
+
+// countAliases returns the number of aliases stored for full_acct.
+func countAliases(t *testing.T, env *testEnv, fullAcct string) int {
+	t.Helper()
+	var n int
+	if err := env.db.SQL().QueryRow(`SELECT COUNT(*) FROM aliases WHERE full_acct = ?`, fullAcct).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestAccountCatchAllProvisionCap(t *testing.T) {
+	env, bob := newProvisionEnv(t, 2, 0)
+	// Aliases an admin creates do not count against the cap.
+	if _, err := env.db.CreateAlias(context.Background(), bob.ID, "bob+manual$example.com", "manual", "DYNAMIC_SUBADDRESS", sql.NullString{}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, acct := range []string{"bob+a$example.com", "bob+b$example.com"} {
+		if resp, body := env.resolveAcct(t, acct, "mainnet"); resp.StatusCode != http.StatusOK || resolvedKind(body) != "PROVISIONED" {
+			t.Fatalf("%s: got %d %v", acct, resp.StatusCode, body)
+		}
+	}
+	resp, body := env.resolveAcct(t, "bob+c$example.com", "mainnet")
+	if resp.StatusCode != http.StatusOK || resolvedKind(body) != "DEFAULT_ALIAS" {
+		t.Errorf("over the cap: got %d %v", resp.StatusCode, body)
+	}
+	if n := countAliases(t, env, "bob+c$example.com"); n != 0 {
+		t.Errorf("%d aliases provisioned over the cap", n)
+	}
+	if resp, body := env.resolveAcct(t, "bob+a$example.com", "mainnet"); resp.StatusCode != http.StatusOK || resolvedKind(body) != "NORMAL" {
+		t.Errorf("provisioned alias at the cap: got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestAccountCatchAllProvisionRateLimit(t *testing.T) {
+	env, _ := newProvisionEnv(t, 100, 2)
+
+	for _, acct := range []string{"bob+a$example.com", "bob+b$example.com"} {
+		if resp, body := env.resolveAcct(t, acct, "mainnet"); resp.StatusCode != http.StatusOK || resolvedKind(body) != "PROVISIONED" {
+			t.Fatalf("%s: got %d %v", acct, resp.StatusCode, body)
+		}
+	}
+	resp, body := env.resolveAcct(t, "bob+c$example.com", "mainnet")
+	if resp.StatusCode != http.StatusOK || resolvedKind(body) != "DEFAULT_ALIAS" {
+		t.Errorf("over the rate: got %d %v", resp.StatusCode, body)
+	}
+	if n := countAliases(t, env, "bob+c$example.com"); n != 0 {
+		t.Errorf("%d aliases provisioned over the rate", n)
+	}
+}
+
+func TestAccountCatchAllProvisionConcurrentFirstResolves(t *testing.T) {
+	env, _ := newProvisionEnv(t, 1, 0)
+	const n = 8
+
+	type result struct {
+		status int
+		kind   interface{}
+		err    error
+	}
+	results := make([]result, n)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"acct":"bob+coffee$example.com","network":"mainnet"}`
+			resp, err := http.Post(env.srv.URL+"/_monalias/resolve", "application/json", strings.NewReader(body))
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			defer resp.Body.Close()
+			var out map[string]interface{}
+			results[i].err = json.NewDecoder(resp.Body).Decode(&out)
+			results[i].status, results[i].kind = resp.StatusCode, resolvedKind(out)
+		}()
+	}
+	wg.Wait()
+
+	// Every resolve is answered by the one alias: the one that created it
+	// or lost the race to it as PROVISIONED, later ones as NORMAL. With a
+	// cap of one, a loser counted as a second provisioned alias would fall
+	// back to DEFAULT_ALIAS.
+	for i, r := range results {
+		if r.err != nil {
+			t.Fatalf("resolve %d: %v", i, r.err)
+		}
+		if r.status != http.StatusOK || (r.kind != "PROVISIONED" && r.kind != "NORMAL") {
+			t.Errorf("resolve %d: got %d %v", i, r.status, r.kind)
+		}
+	}
+	if got := countAliases(t, env, "bob+coffee$example.com"); got != 1 {
+		t.Errorf("%d aliases for bob+coffee; want 1", got)
+	}
+	if labels := env.wallet.createdLabels(); len(labels) != n {
+		t.Errorf("%d subaddresses allocated for %d resolves", len(labels), n)
+	}
+}
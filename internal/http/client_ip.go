@@ -0,0 +1,151 @@
+package httpx
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPResolver works out which client a request came from. The
+// forwarding header is only believed when the peer is a trusted proxy; the
+// chain is then walked from the right and the first hop that is not a
+// trusted proxy is the client. Only the one header the proxies set is read:
+// the other arrives as the client sent it. IPv6 clients are grouped by
+// prefix, since a single host usually controls a whole /64.
+type ClientIPResolver struct {
+	trusted    []netip.Prefix
+	header     string
+	ipv6Prefix int
+}
+
+// NewClientIPResolver reads the chain from header, "X-Forwarded-For" or the
+// RFC 7239 "Forwarded".
+func NewClientIPResolver(trusted []netip.Prefix, header string, ipv6Prefix int) *ClientIPResolver {
+	return &ClientIPResolver{trusted: trusted, header: http.CanonicalHeaderKey(header), ipv6Prefix: ipv6Prefix}
+}
+
+// ClientIP returns the client address for r, or the zero Addr when even the
+// peer address cannot be parsed.
+func (c *ClientIPResolver) ClientIP(r *http.Request) netip.Addr {
+	peer := parseHop(r.RemoteAddr)
+	if !peer.IsValid() || !c.isTrusted(peer) {
+		return peer
+	}
+
+	var hops []string
+	if c.header == "Forwarded" {
+		hops = forwardedFor(r.Header.Values("Forwarded"))
+	} else {
+		for _, v := range r.Header.Values(c.header) {
+			for _, hop := range strings.Split(v, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr := parseHop(hops[i])
+		if !addr.IsValid() {
+			// "unknown", an obfuscated identifier or garbage: nothing left
+			// of it can be believed, so charge the proxy that sent it.
+			return client
+		}
+		client = addr
+		if !c.isTrusted(addr) {
+			return client
+		}
+	}
+	return client
+}
+
+// Key returns the rate limiting bucket for r: the client address for IPv4,
+// the client's IPv6 prefix otherwise.
+func (c *ClientIPResolver) Key(r *http.Request) string {
+	addr := c.ClientIP(r)
+	if !addr.IsValid() {
+		return r.RemoteAddr
+	}
+	return c.keyFor(addr)
+}
+
+func (c *ClientIPResolver) keyFor(addr netip.Addr) string {
+	if addr.Is6() && c.ipv6Prefix > 0 && c.ipv6Prefix < 128 {
+		return netip.PrefixFrom(addr, c.ipv6Prefix).Masked().String()
+	}
+	return addr.String()
+}
+
+// networkKey returns the /24 (IPv4) or /64 (IPv6) network addr belongs to.
+func networkKey(addr netip.Addr) string {
+	bits := 24
+	if addr.Is6() {
+		bits = 64
+	}
+	return netip.PrefixFrom(addr, bits).Masked().String()
+}
+
+func (c *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range c.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded header
+// values, in order. Elements without one yield "" so they still count as an
+// unparseable hop.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range splitQuoted(v, ',') {
+			hop := ""
+			for _, pair := range splitQuoted(element, ';') {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// splitQuoted splits s on sep, ignoring separators inside double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseHop parses an address as it appears in RemoteAddr, X-Forwarded-For or
+// a Forwarded for= value: bare, with a port, or bracketed IPv6 with or
+// without a port.
+func parseHop(s string) netip.Addr {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap().WithZone("")
+}
@@ -0,0 +1,185 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+	resolvers := map[string]*ClientIPResolver{
+		"X-Forwarded-For": NewClientIPResolver(trusted, "X-Forwarded-For", 64),
+		"Forwarded":       NewClientIPResolver(trusted, "Forwarded", 64),
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		header  string // the header the proxies set; X-Forwarded-For if empty
+		headers map[string][]string
+		wantIP  string
+		wantKey string
+	}{
+		{
+			name:    "direct client",
+			remote:  "203.0.113.7:5555",
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+		{
+			name:    "untrusted peer headers ignored",
+			remote:  "203.0.113.7:5555",
+			headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+		{
+			name:    "trusted proxy XFF",
+			remote:  "10.0.0.2:443",
+			headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			wantIP:  "198.51.100.1",
+			wantKey: "198.51.100.1",
+		},
+		{
+			name:    "spoofed leftmost entry skipped",
+			remote:  "10.0.0.2:443",
+			headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1, 10.0.0.9"}},
+			wantIP:  "198.51.100.1",
+			wantKey: "198.51.100.1",
+		},
+		{
+			name:   "XFF split across header lines",
+			remote: "10.0.0.2:443",
+			headers: map[string][]string{"X-Forwarded-For": {
+				"1.2.3.4", "198.51.100.1, 10.0.0.9",
+			}},
+			wantIP:  "198.51.100.1",
+			wantKey: "198.51.100.1",
+		},
+		{
+			name:    "all hops trusted",
+			remote:  "10.0.0.2:443",
+			headers: map[string][]string{"X-Forwarded-For": {"10.1.1.1, 10.0.0.9"}},
+			wantIP:  "10.1.1.1",
+			wantKey: "10.1.1.1",
+		},
+		{
+			name:    "garbage hop stops the walk",
+			remote:  "10.0.0.2:443",
+			headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1, nonsense, 10.0.0.9"}},
+			wantIP:  "10.0.0.9",
+			wantKey: "10.0.0.9",
+		},
+		{
+			name:   "client's Forwarded ignored behind an XFF proxy",
+			remote: "10.0.0.2:443",
+			headers: map[string][]string{
+				"Forwarded":       {`for=192.0.2.60;proto=https;by=10.0.0.2`},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			wantIP:  "198.51.100.1",
+			wantKey: "198.51.100.1",
+		},
+		{
+			name:    "lone Forwarded ignored behind an XFF proxy",
+			remote:  "10.0.0.2:443",
+			headers: map[string][]string{"Forwarded": {`for=192.0.2.60`}},
+			wantIP:  "10.0.0.2",
+			wantKey: "10.0.0.2",
+		},
+		{
+			name:   "Forwarded proxy",
+			remote: "10.0.0.2:443",
+			header: "Forwarded",
+			headers: map[string][]string{
+				"Forwarded": {`for=192.0.2.60;proto=https;by=10.0.0.2`},
+			},
+			wantIP:  "192.0.2.60",
+			wantKey: "192.0.2.60",
+		},
+		{
+			name:   "client's XFF ignored behind a Forwarded proxy",
+			remote: "10.0.0.2:443",
+			header: "Forwarded",
+			headers: map[string][]string{
+				"Forwarded":       {`for=192.0.2.60`},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			wantIP:  "192.0.2.60",
+			wantKey: "192.0.2.60",
+		},
+		{
+			name:   "Forwarded quoted IPv6 with port",
+			remote: "10.0.0.2:443",
+			header: "Forwarded",
+			headers: map[string][]string{"Forwarded": {
+				`for="[2001:db8:cafe:1::17]:4711", for=10.0.0.9`,
+			}},
+			wantIP:  "2001:db8:cafe:1::17",
+			wantKey: "2001:db8:cafe:1::/64",
+		},
+		{
+			name:    "Forwarded unknown stops the walk",
+			remote:  "10.0.0.2:443",
+			header:  "Forwarded",
+			headers: map[string][]string{"Forwarded": {`for=198.51.100.1, for=unknown`}},
+			wantIP:  "10.0.0.2",
+			wantKey: "10.0.0.2",
+		},
+		{
+			name:    "Forwarded element without for",
+			remote:  "10.0.0.2:443",
+			header:  "Forwarded",
+			headers: map[string][]string{"Forwarded": {`for=198.51.100.1, proto=https`}},
+			wantIP:  "10.0.0.2",
+			wantKey: "10.0.0.2",
+		},
+		{
+			name:    "IPv6 peer bucketed by prefix",
+			remote:  "[2001:db8:1:2:aaaa::1]:5555",
+			wantIP:  "2001:db8:1:2:aaaa::1",
+			wantKey: "2001:db8:1:2::/64",
+		},
+		{
+			name:    "IPv4-mapped peer",
+			remote:  "[::ffff:203.0.113.7]:5555",
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+		{
+			name:    "trusted IPv6 proxy",
+			remote:  "[fd00::1]:443",
+			headers: map[string][]string{"X-Forwarded-For": {"203.0.113.7:1234"}},
+			wantIP:  "203.0.113.7",
+			wantKey: "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == "" {
+				header = "X-Forwarded-For"
+			}
+			resolver := resolvers[header]
+			r := httptest.NewRequest(http.MethodPost, "/_monalias/resolve", nil)
+			r.RemoteAddr = tt.remote
+			for k, vs := range tt.headers {
+				for _, v := range vs {
+					r.Header.Add(k, v)
+				}
+			}
+			if got := resolver.ClientIP(r).String(); got != tt.wantIP {
+				t.Errorf("ClientIP = %s, want %s", got, tt.wantIP)
+			}
+			if got := resolver.Key(r); got != tt.wantKey {
+				t.Errorf("Key = %s, want %s", got, tt.wantKey)
+			}
+		})
+	}
+}
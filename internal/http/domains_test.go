@@ -0,0 +1,180 @@
+package httpx
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+func newDomainsEnv(t *testing.T) (*testEnv, ed25519.PublicKey) {
+	t.Helper()
+	env := newTestEnv(t, false)
+	pub := env.addDomain(t, "example.org", "https://monalias.example.org", "org1")
+	ctx := context.Background()
+	for _, handle := range []string{"bob$example.com", "bob$example.org"} {
+		account, err := env.db.CreateAccount(ctx, handle, sql.NullString{}, sql.NullString{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.db.CreateAlias(ctx, account.ID, handle, "default", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return env, pub
+}
+
+func TestWellKnownSelectsDomainByHost(t *testing.T) {
+	env, _ := newDomainsEnv(t)
+
+	tests := []struct {
+		host       string
+		status     int
+		homeserver string
+		kid        string
+	}{
+		{"example.com", http.StatusOK, "https://monalias.example.com", "k1"},
+		{"EXAMPLE.org:443", http.StatusOK, "https://monalias.example.org", "org1"},
+		{"monalias.example.org", http.StatusOK, "https://monalias.example.org", "org1"},
+		{"example.net", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, env.srv.URL+"/.well-known/monalias", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = tt.host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			Homeserver string `json:"homeserver"`
+			Error      string `json:"error"`
+			Keys       []struct {
+				Kid string `json:"kid"`
+			} `json:"keys"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&doc)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.host, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			if doc.Error != "unknown_domain" {
+				t.Errorf("%s: error = %q", tt.host, doc.Error)
+			}
+			continue
+		}
+		if doc.Homeserver != tt.homeserver || len(doc.Keys) != 1 || doc.Keys[0].Kid != tt.kid {
+			t.Errorf("%s: got %+v", tt.host, doc)
+		}
+	}
+}
+
+func TestResolveSignsWithTheAcctDomainKey(t *testing.T) {
+	env, orgPub := newDomainsEnv(t)
+
+	resp, body := env.resolveAcct(t, "bob$example.org", "mainnet")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d: %v", resp.StatusCode, body)
+	}
+	kid := resp.Header.Get(protocol.HeaderKeyID)
+	if kid != "org1" {
+		t.Fatalf("signed with %q, want org1", kid)
+	}
+	canonical := protocol.ResolveCanonical("bob$example.org", testAddress, "mainnet", body["expires_at"].(string), kid)
+	if !protocol.Verify(orgPub, canonical, resp.Header.Get(protocol.HeaderSignature)) {
+		t.Error("signature does not verify against the example.org key")
+	}
+
+	if resp, body := env.resolveAcct(t, "bob$example.net", "mainnet"); resp.StatusCode != http.StatusNotFound || body["error"] != "alias_not_found" {
+		t.Errorf("unknown domain: got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestLockedDomainDoesNotAffectOthers(t *testing.T) {
+	env, _ := newDomainsEnv(t)
+	ctx := context.Background()
+
+	reason := sql.NullString{String: "identity_mismatch", Valid: true}
+	if _, err := env.db.UpdateDomainStatus(ctx, "example.org", "LOCKED", reason, sql.NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := env.resolveAcct(t, "bob$example.org", "mainnet")
+	if resp.StatusCode != http.StatusServiceUnavailable || body["error"] != "instance_locked" || body["reason"] != "identity_mismatch" {
+		t.Errorf("locked domain: got %d %v", resp.StatusCode, body)
+	}
+	if resp, body := env.resolveAcct(t, "bob$example.com", "mainnet"); resp.StatusCode != http.StatusOK {
+		t.Errorf("other domain: got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestCatchAllIsPerDomain(t *testing.T) {
+	env, _ := newDomainsEnv(t)
+	ctx := context.Background()
+
+	if _, err := env.db.UpdateDomainCatchAll(ctx, "example.org", "stagenet", sql.NullString{String: testStagenetAddress, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := env.resolveAcct(t, "alice$example.org", "stagenet")
+	if resp.StatusCode != http.StatusOK || body["address"] != testStagenetAddress {
+		t.Fatalf("catch-all: got %d %v", resp.StatusCode, body)
+	}
+	meta := body["meta"].(map[string]interface{})
+	if meta["resolved_kind"] != "CATCH_ALL" || meta["display_name"] != "example.org (catch-all)" {
+		t.Errorf("meta = %v", meta)
+	}
+	if resp, body := env.resolveAcct(t, "alice$example.org", "mainnet"); resp.StatusCode != http.StatusNotFound || body["error"] != "network_not_supported" {
+		t.Errorf("catch-all on other network: got %d %v", resp.StatusCode, body)
+	}
+	if resp, body := env.resolveAcct(t, "alice$example.com", "stagenet"); resp.StatusCode != http.StatusNotFound || body["error"] != "alias_not_found" {
+		t.Errorf("domain without catch-all: got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestResolveNormalizesAcct(t *testing.T) {
+	env, orgPub := newDomainsEnv(t)
+	env.addDomain(t, "xn--bcher-kva.example", "https://monalias.example.org", "idn1")
+
+	for _, acct := range []string{"Bob$Example.ORG", "BOB$example.org"} {
+		resp, body := env.resolveAcct(t, acct, "mainnet")
+		if resp.StatusCode != http.StatusOK || body["address"] != testAddress {
+			t.Fatalf("%s: got %d %v", acct, resp.StatusCode, body)
+		}
+		// The signature covers acct as the client sent it.
+		canonical := protocol.ResolveCanonical(acct, testAddress, "mainnet", body["expires_at"].(string), "org1")
+		if !protocol.Verify(orgPub, canonical, resp.Header.Get(protocol.HeaderSignature)) {
+			t.Errorf("%s: signature does not verify over the acct as sent", acct)
+		}
+	}
+
+	// Unicode and punycode spellings of a domain are the same domain.
+	dave, err := env.db.CreateAccount(context.Background(), "dave$xn--bcher-kva.example", sql.NullString{}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.CreateAlias(context.Background(), dave.ID, dave.Handle, "default", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, body := env.resolveAcct(t, "dave$Bücher.example", "mainnet"); resp.StatusCode != http.StatusOK || resp.Header.Get(protocol.HeaderKeyID) != "idn1" {
+		t.Errorf("unicode domain: got %d %v", resp.StatusCode, body)
+	}
+
+	// An acct that cannot be normalized does not fall through to the
+	// catch-all.
+	if _, err := env.db.UpdateDomainCatchAll(context.Background(), "example.org", "mainnet", sql.NullString{String: testAddress, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, body := env.resolveAcct(t, "pаypal$example.org", "mainnet"); resp.StatusCode != http.StatusNotFound || body["error"] != "alias_not_found" {
+		t.Errorf("confusable acct: got %d %v", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,274 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/metrics"
+)
+
+const (
+	BanScopeClient  = "CLIENT"
+	BanScopeNetwork = "NETWORK"
+
+	// networkLookupFactor scales the lookup threshold for a whole /24 or
+	// /64, which legitimately carries many clients.
+	networkLookupFactor = 5
+)
+
+// EnumerationConfig tunes enumeration detection. MinLookups of zero
+// disables it.
+type EnumerationConfig struct {
+	Window        time.Duration
+	MinLookups    int
+	NotFoundRatio float64
+	BanDuration   time.Duration
+}
+
+// Ban is a client or network temporarily refused for probing aliases.
+type Ban struct {
+	Key      string
+	Scope    string
+	Since    time.Time
+	Until    time.Time
+	Lookups  int
+	NotFound int
+}
+
+type lookupStats struct {
+	start    time.Time
+	lookups  int
+	notFound int
+}
+
+// EnumerationGuard watches resolve outcomes per client and per /24 or /64
+// network. Once at least MinLookups resolves in a window (five times that
+// for a network) have missed at the NotFoundRatio or above, the client or
+// network is refused with 429 for BanDuration. Bans live in memory, like
+// the IPRateLimiter buckets, and are listed and cleared through the admin
+// API.
+type EnumerationGuard struct {
+	cfg     EnumerationConfig
+	clients *ClientIPResolver
+	log     *slog.Logger
+	now     func() time.Time
+
+	mu    sync.Mutex
+	stats map[string]*lookupStats
+	bans  map[string]Ban
+}
+
+func NewEnumerationGuard(cfg EnumerationConfig, clients *ClientIPResolver, logger *slog.Logger) *EnumerationGuard {
+	g := &EnumerationGuard{
+		cfg:     cfg,
+		clients: clients,
+		log:     logger,
+		now:     time.Now,
+		stats:   make(map[string]*lookupStats),
+		bans:    make(map[string]Ban),
+	}
+	go g.cleanupLoop()
+	return g
+}
+
+func (g *EnumerationGuard) enabled() bool {
+	return g != nil && g.cfg.MinLookups > 0
+}
+
+// Middleware refuses banned clients and records the outcome the resolve
+// handler reports for everyone else.
+func (g *EnumerationGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client, network := g.keys(r)
+		if ban, ok := g.banned(client, network); ok {
+			metrics.ObserveResolve(metrics.OutcomeRateLimited, "", 0)
+			retry := int(ban.Until.Sub(g.now()).Seconds()) + 1
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", fmt.Sprint(retry))
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = fmt.Fprintf(w, `{"error":"rate_limited","retry_after_seconds":%d}`, retry)
+			return
+		}
+
+		rec := &outcomeRecorder{}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), outcomeKey{}, rec)))
+		for _, outcome := range rec.outcomes {
+			g.observe(r.Context(), client, network, outcome)
+		}
+	})
+}
+
+// keys returns the bucket for the client and for its network. The network
+// key is empty when it would be the same bucket as the client, as for IPv6
+// clients already grouped by /64.
+func (g *EnumerationGuard) keys(r *http.Request) (string, string) {
+	addr := g.clients.ClientIP(r)
+	if !addr.IsValid() {
+		return r.RemoteAddr, ""
+	}
+	client, network := g.clients.keyFor(addr), networkKey(addr)
+	if network == client {
+		network = ""
+	}
+	return client, network
+}
+
+func (g *EnumerationGuard) banned(keys ...string) (Ban, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	for _, key := range keys {
+		if ban, ok := g.bans[key]; ok && now.Before(ban.Until) {
+			return ban, true
+		}
+	}
+	return Ban{}, false
+}
+
+func (g *EnumerationGuard) observe(ctx context.Context, client, network, outcome string) {
+	var miss bool
+	switch outcome {
+	case metrics.OutcomeNormal, metrics.OutcomeDefaultAlias, metrics.OutcomeProvisioned:
+		// The account exists and one of its aliases answered.
+	case metrics.OutcomeNotFound, metrics.OutcomeCatchAll:
+		// A catch-all address is as much of a miss as a 404: the response
+		// says the alias does not exist.
+		miss = true
+	default:
+		// network_not_supported included: a wallet on the other network
+		// polling a known alias is no scanner.
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.count(ctx, client, BanScopeClient, g.cfg.MinLookups, miss)
+	if network != "" {
+		g.count(ctx, network, BanScopeNetwork, g.cfg.MinLookups*networkLookupFactor, miss)
+	}
+}
+
+// count must be called with g.mu held.
+func (g *EnumerationGuard) count(ctx context.Context, key, scope string, minLookups int, miss bool) {
+	now := g.now()
+	st, ok := g.stats[key]
+	if !ok || now.Sub(st.start) > g.cfg.Window {
+		st = &lookupStats{start: now}
+		g.stats[key] = st
+	}
+	st.lookups++
+	if miss {
+		st.notFound++
+	}
+	if st.lookups < minLookups || float64(st.notFound) < g.cfg.NotFoundRatio*float64(st.lookups) {
+		return
+	}
+
+	ban := Ban{
+		Key:      key,
+		Scope:    scope,
+		Since:    now,
+		Until:    now.Add(g.cfg.BanDuration),
+		Lookups:  st.lookups,
+		NotFound: st.notFound,
+	}
+	g.bans[key] = ban
+	delete(g.stats, key)
+	g.log.WarnContext(ctx, "alias enumeration suspected; banning",
+		"key", key, "scope", scope, "lookups", ban.Lookups, "not_found", ban.NotFound, "until", ban.Until)
+}
+
+// Bans lists the bans in force, soonest to expire first.
+func (g *EnumerationGuard) Bans() []Ban {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	out := make([]Ban, 0, len(g.bans))
+	for _, ban := range g.bans {
+		if now.Before(ban.Until) {
+			out = append(out, ban)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out
+}
+
+// ActiveBan returns the ban in force on key, if any.
+func (g *EnumerationGuard) ActiveBan(key string) (Ban, bool) {
+	if g == nil {
+		return Ban{}, false
+	}
+	return g.banned(key)
+}
+
+// ClearBan lifts the ban on key and forgets its lookup history. It reports
+// the ban that was lifted, if any.
+func (g *EnumerationGuard) ClearBan(key string) (Ban, bool) {
+	if g == nil {
+		return Ban{}, false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ban, ok := g.bans[key]
+	if ok && !g.now().Before(ban.Until) {
+		ok = false
+	}
+	delete(g.bans, key)
+	delete(g.stats, key)
+	return ban, ok
+}
+
+// Len returns the number of bans in force.
+func (g *EnumerationGuard) Len() int {
+	return len(g.Bans())
+}
+
+func (g *EnumerationGuard) cleanupLoop() {
+	for {
+		time.Sleep(2 * time.Minute)
+		g.cleanup()
+	}
+}
+
+func (g *EnumerationGuard) cleanup() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	for key, ban := range g.bans {
+		if !now.Before(ban.Until) {
+			delete(g.bans, key)
+		}
+	}
+	for key, st := range g.stats {
+		if now.Sub(st.start) > g.cfg.Window {
+			delete(g.stats, key)
+		}
+	}
+}
+
+type outcomeKey struct{}
+
+type outcomeRecorder struct {
+	outcomes []string
+}
+
+// reportOutcome hands a resolve outcome to the EnumerationGuard wrapping the
+// handler, if there is one. A batch reports one outcome per item.
+func reportOutcome(ctx context.Context, outcome string) {
+	if rec, ok := ctx.Value(outcomeKey{}).(*outcomeRecorder); ok {
+		rec.outcomes = append(rec.outcomes, outcome)
+	}
+}
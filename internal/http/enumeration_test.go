@@ -0,0 +1,207 @@
+package httpx
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/metrics"
+)
+
+type guardEnv struct {
+	guard   *EnumerationGuard
+	handler http.Handler
+	now     time.Time
+	outcome string
+}
+
+func newGuardEnv(t *testing.T) *guardEnv {
+	t.Helper()
+	env := &guardEnv{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	env.guard = NewEnumerationGuard(EnumerationConfig{
+		Window:        10 * time.Minute,
+		MinLookups:    10,
+		NotFoundRatio: 0.5,
+		BanDuration:   30 * time.Minute,
+	}, NewClientIPResolver(nil, "X-Forwarded-For", 64), slog.New(slog.DiscardHandler))
+	env.guard.now = func() time.Time { return env.now }
+	env.handler = env.guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reportOutcome(r.Context(), env.outcome)
+		w.WriteHeader(http.StatusOK)
+	}))
+	return env
+}
+
+func (e *guardEnv) resolve(remote, outcome string) int {
+	e.outcome = outcome
+	r := httptest.NewRequest(http.MethodPost, "/_monalias/resolve", nil)
+	r.RemoteAddr = remote
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestEnumerationGuardBansScanningClient(t *testing.T) {
+	env := newGuardEnv(t)
+	const scanner = "203.0.113.7:1000"
+
+	for i := 0; i < 9; i++ {
+		if code := env.resolve(scanner, metrics.OutcomeNotFound); code != http.StatusOK {
+			t.Fatalf("lookup %d: got %d before reaching the threshold", i, code)
+		}
+	}
+	env.resolve(scanner, metrics.OutcomeCatchAll)
+	if code := env.resolve(scanner, metrics.OutcomeNormal); code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want 429 once banned", code)
+	}
+
+	bans := env.guard.Bans()
+	if len(bans) != 1 || bans[0].Key != "203.0.113.7" || bans[0].Scope != BanScopeClient {
+		t.Fatalf("bans = %+v", bans)
+	}
+	if bans[0].Lookups != 10 || bans[0].NotFound != 10 {
+		t.Errorf("ban counts = %d/%d, want 10/10", bans[0].NotFound, bans[0].Lookups)
+	}
+
+	// Another client on the same /24 is unaffected.
+	if code := env.resolve("203.0.113.8:1000", metrics.OutcomeNormal); code != http.StatusOK {
+		t.Errorf("neighbour got %d", code)
+	}
+
+	env.now = env.now.Add(31 * time.Minute)
+	if code := env.resolve(scanner, metrics.OutcomeNormal); code != http.StatusOK {
+		t.Errorf("got %d after the ban expired", code)
+	}
+	if bans := env.guard.Bans(); len(bans) != 0 {
+		t.Errorf("expired bans still listed: %+v", bans)
+	}
+}
+
+func TestEnumerationGuardIgnoresMostlyHits(t *testing.T) {
+	env := newGuardEnv(t)
+	for i := 0; i < 100; i++ {
+		outcome := metrics.OutcomeNormal
+		if i%3 == 0 {
+			outcome = metrics.OutcomeNotFound
+		}
+		if code := env.resolve("198.51.100.1:1000", outcome); code != http.StatusOK {
+			t.Fatalf("lookup %d: got %d", i, code)
+		}
+	}
+}
+
+func TestEnumerationGuardCountsAccountAliasesAsHits(t *testing.T) {
+	env := newGuardEnv(t)
+	const client = "198.51.100.1:1000"
+
+	// Nine misses among twenty lookups stay under the ratio only if the
+	// default alias and provisioned answers count as hits.
+	for i := 0; i < 11; i++ {
+		outcome := metrics.OutcomeDefaultAlias
+		if i%2 == 0 {
+			outcome = metrics.OutcomeProvisioned
+		}
+		env.resolve(client, outcome)
+	}
+	for i := 0; i < 9; i++ {
+		if code := env.resolve(client, metrics.OutcomeNotFound); code != http.StatusOK {
+			t.Fatalf("miss %d: got %d", i, code)
+		}
+	}
+	if bans := env.guard.Bans(); len(bans) != 0 {
+		t.Errorf("bans = %+v", bans)
+	}
+}
+
+// TestEnumerationGuardIgnoresUnsupportedNetwork checks that a stagenet
+// wallet polling a mainnet-only alias is not taken for a scanner.
+func TestEnumerationGuardIgnoresUnsupportedNetwork(t *testing.T) {
+	env := newGuardEnv(t)
+	for i := 0; i < 100; i++ {
+		if code := env.resolve("198.51.100.1:1000", metrics.OutcomeNetworkUnsupported); code != http.StatusOK {
+			t.Fatalf("lookup %d: got %d", i, code)
+		}
+	}
+	// Nor does it dilute misses: nine of them stay under MinLookups.
+	for i := 0; i < 9; i++ {
+		env.resolve("198.51.100.1:1000", metrics.OutcomeNotFound)
+	}
+	if bans := env.guard.Bans(); len(bans) != 0 {
+		t.Errorf("bans = %+v", bans)
+	}
+}
+
+func TestEnumerationGuardWindowResets(t *testing.T) {
+	env := newGuardEnv(t)
+	for i := 0; i < 9; i++ {
+		env.resolve("198.51.100.1:1000", metrics.OutcomeNotFound)
+	}
+	env.now = env.now.Add(11 * time.Minute)
+	for i := 0; i < 9; i++ {
+		if code := env.resolve("198.51.100.1:1000", metrics.OutcomeNotFound); code != http.StatusOK {
+			t.Fatalf("lookup %d in the new window: got %d", i, code)
+		}
+	}
+}
+
+func TestEnumerationGuardBansNetwork(t *testing.T) {
+	env := newGuardEnv(t)
+
+	// 50 misses spread over 25 addresses: no client reaches its own
+	// threshold, but the /24 does.
+	for i := 0; i < 50; i++ {
+		env.resolve("192.0.2."+strconv.Itoa(10+i%25)+":1000", metrics.OutcomeNotFound)
+	}
+	if code := env.resolve("192.0.2.200:1000", metrics.OutcomeNormal); code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want the /24 banned", code)
+	}
+	bans := env.guard.Bans()
+	if len(bans) != 1 || bans[0].Key != "192.0.2.0/24" || bans[0].Scope != BanScopeNetwork {
+		t.Fatalf("bans = %+v", bans)
+	}
+
+	if _, ok := env.guard.ClearBan("192.0.2.0/24"); !ok {
+		t.Fatal("ClearBan reported no ban")
+	}
+	if code := env.resolve("192.0.2.200:1000", metrics.OutcomeNormal); code != http.StatusOK {
+		t.Errorf("got %d after clearing the ban", code)
+	}
+	if _, ok := env.guard.ClearBan("192.0.2.0/24"); ok {
+		t.Error("second ClearBan reported a ban")
+	}
+}
+
+func TestEnumerationGuardIPv6SharesPrefix(t *testing.T) {
+	env := newGuardEnv(t)
+	for i := 0; i < 10; i++ {
+		env.resolve("[2001:db8:1:2::"+strconv.Itoa(i+1)+"]:1000", metrics.OutcomeNotFound)
+	}
+	if code := env.resolve("[2001:db8:1:2::ffff]:1000", metrics.OutcomeNormal); code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want the /64 banned", code)
+	}
+	bans := env.guard.Bans()
+	if len(bans) != 1 || bans[0].Key != "2001:db8:1:2::/64" || bans[0].Scope != BanScopeClient {
+		t.Fatalf("bans = %+v", bans)
+	}
+}
+
+func TestEnumerationGuardCountsBatchItems(t *testing.T) {
+	env := newGuardEnv(t)
+	batch := env.guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 10; i++ {
+			reportOutcome(r.Context(), metrics.OutcomeNotFound)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/_monalias/resolve-batch", nil)
+	r.RemoteAddr = "203.0.113.7:1000"
+	batch.ServeHTTP(httptest.NewRecorder(), r)
+
+	if code := env.resolve("203.0.113.7:1000", metrics.OutcomeNormal); code != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want 429 after a batch of ten misses", code)
+	}
+}
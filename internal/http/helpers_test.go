@@ -0,0 +1,248 @@
+package httpx
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/db"
+	"github.com/kaigoh/monalias/internal/monero"
+	"github.com/kaigoh/monalias/internal/seal"
+)
+
+// Valid addresses for the aliases and catch-alls the tests store.
+const (
+	testAddress         = "888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H"
+	testStagenetAddress = "54gqcJZAtgzBFnQWEQHec3RoWfmoHqL4H8sASqdQMGshfqdpG1fzT5ddCpz9y4C2MwQkB41MhTjz5q5CHFKgHgd1Dgsh5Ur"
+)
+
+// stubWalletRPC answers get_version, open_wallet and create_address like
+// monero-wallet-rpc, or fails every call with a 500 while down is set.
+// create_address hands out testAddress at increasing indexes, or with
+// distinct set the next of stubSubaddresses.
+type stubWalletRPC struct {
+	down     atomic.Bool
+	distinct atomic.Bool
+	calls    atomic.Int32
+
+	mu     sync.Mutex
+	labels []string
+}
+
+func (s *stubWalletRPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.calls.Add(1)
+	if s.down.Load() {
+		http.Error(w, "wallet rpc down", http.StatusInternalServerError)
+		return
+	}
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Label string `json:"label"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var result interface{}
+	switch req.Method {
+	case "get_version":
+		result = map[string]interface{}{"version": 1<<16 | 26}
+	case "open_wallet":
+		result = map[string]interface{}{}
+	case "create_address":
+		s.mu.Lock()
+		s.labels = append(s.labels, req.Params.Label)
+		idx := len(s.labels)
+		s.mu.Unlock()
+		addr := testAddress
+		if s.distinct.Load() {
+			addr = stubSubaddress(idx)
+		}
+		result = map[string]interface{}{"address": addr, "address_index": idx}
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.ID,
+		"result":  result,
+	})
+}
+
+// stubSubaddresses are valid mainnet subaddresses the stub hands out, in
+// order from index 1, while distinct is set.
+var stubSubaddresses = []string{
+	"82VT4msYTPd111111111111111111111111111111111113CUsUpv9u11111111111111111111111111111111113WSXEk",
+	"82XeYeMNNYX111111111111111111111111111111111115PxjxeqJo11111111111111111111111111111111111ncmga",
+	"82Zr2WqCHhR111111111111111111111111111111111117bScSUkTh11111111111111111111111111111111115twnV6",
+	"82c3WPK2CrK111111111111111111111111111111111119nvUvJfcb111111111111111111111111111111111143a7Ts",
+	"82eEzFnr81D11111111111111111111111111111111111BzQMQ8amV11111111111111111111111111111111114BZpAc",
+	"82gSU8Gg3A711111111111111111111111111111111111EBtDsxVvP11111111111111111111111111111111112CBcAK",
+	"82idwzkVxK111111111111111111111111111111111111GPN6MnR5H11111111111111111111111111111111115PVyxE",
+	"82kqRsEKsTu11111111111111111111111111111111111JaqxqcLEB11111111111111111111111111111111111UhrUY",
+}
+
+// stubSubaddress returns the subaddress the stub hands out at idx.
+func stubSubaddress(idx int) string {
+	return stubSubaddresses[idx-1]
+}
+
+// createdLabels returns the labels create_address was called with.
+func (s *stubWalletRPC) createdLabels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.labels...)
+}
+
+// testSeals seals the signing key seeds the tests store.
+var testSeals = func() *seal.Box {
+	box, err := seal.New(make([]byte, seal.KeySize))
+	if err != nil {
+		panic(err)
+	}
+	return box
+}()
+
+// testEnv is a public service over a fresh database serving example.com,
+// with a stub wallet-rpc when one was asked for.
+type testEnv struct {
+	db     *db.DB
+	wallet *stubWalletRPC
+	srv    *httptest.Server
+}
+
+// newTestEnv starts a public service with a 5 minute resolve TTL and
+// "admin" reserved.
+func newTestEnv(t *testing.T, withWallet bool) *testEnv {
+	t.Helper()
+	return newTestEnvConfig(t, withWallet, config.Config{
+		Domain:                 "example.com",
+		ResolveTTL:             5 * time.Minute,
+		ReservedNames:          []string{"admin"},
+		ProvisionMaxPerAccount: 100,
+	})
+}
+
+// newTestEnvConfig is newTestEnv with the public service run under cfg.
+func newTestEnvConfig(t *testing.T, withWallet bool, cfg config.Config) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "monalias.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{db: database}
+	env.addDomain(t, "example.com", "https://monalias.example.com", "k1")
+	logger := slog.New(slog.DiscardHandler)
+	var rpc *monero.WalletRPC
+	if withWallet {
+		env.wallet = &stubWalletRPC{}
+		walletSrv := httptest.NewServer(env.wallet)
+		t.Cleanup(walletSrv.Close)
+		rpc = monero.NewWalletRPC(walletSrv.URL, "", "", logger)
+	}
+
+	svc := NewPublicService(cfg, database, testSeals, monero.NewWalletSessions(rpc), logger)
+	env.srv = httptest.NewServer(svc.Handler(nil, nil))
+	t.Cleanup(env.srv.Close)
+	return env
+}
+
+// addDomain serves domain from the instance with a fresh active key kid and
+// returns its public key.
+func (e *testEnv) addDomain(t *testing.T, domain, homeserver, kid string) ed25519.PublicKey {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := e.db.CreateDomain(ctx, domain, homeserver); err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := sql.NullString{String: testSeals.Seal(kid, priv.Seed()), Valid: true}
+	if _, err := e.db.CreateSigningKey(ctx, domain, kid, base64.StdEncoding.EncodeToString(pub), seed, db.SigningKeyNext); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.db.ActivateSigningKey(ctx, kid); err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+// get fetches path from the public service and returns the response with
+// its body.
+func (e *testEnv) get(t *testing.T, path string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get(e.srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+// resolveAcct posts a resolve for acct on network and returns the response
+// with its decoded body.
+func (e *testEnv) resolveAcct(t *testing.T, acct, network string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	body := `{"acct":"` + acct + `","network":"` + network + `"}`
+	resp, err := http.Post(e.srv.URL+"/_monalias/resolve", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+	return resp, out
+}
+
+// newStaticEnv serves bob+tips$example.com as a static mainnet alias.
+func newStaticEnv(t *testing.T) *testEnv {
+	t.Helper()
+	env := newTestEnv(t, false)
+	ctx := context.Background()
+	account, err := env.db.CreateAccount(ctx, "bob$example.com", sql.NullString{}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.CreateAlias(ctx, account.ID, "bob+tips$example.com", "tips", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
@@ -0,0 +1,102 @@
+package httpx
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/metrics"
+)
+
+// resolveCount returns monalias_resolve_requests_total for outcome and
+// network.
+func resolveCount(t *testing.T, outcome, network string) float64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "monalias_resolve_requests_total" {
+			continue
+		}
+	series:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				want := outcome
+				if l.GetName() == "network" {
+					want = network
+				}
+				if l.GetValue() != want {
+					continue series
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestResolveMetrics(t *testing.T) {
+	env := newStaticEnv(t)
+
+	tests := []struct {
+		acct, network     string
+		outcome, labelled string
+	}{
+		{"bob+tips$example.com", "mainnet", metrics.OutcomeNormal, "mainnet"},
+		{"bob+nope$example.com", "mainnet", metrics.OutcomeNotFound, "mainnet"},
+		{"bob+tips$example.com", "stagenet", metrics.OutcomeNetworkUnsupported, "stagenet"},
+		{"bob+tips$example.com", "testnet", metrics.OutcomeBadRequest, "unknown"},
+	}
+	for _, tt := range tests {
+		before := resolveCount(t, tt.outcome, tt.labelled)
+		env.resolveAcct(t, tt.acct, tt.network)
+		if got := resolveCount(t, tt.outcome, tt.labelled); got != before+1 {
+			t.Errorf("%s on %s: outcome=%q network=%q went from %v to %v; want one more",
+				tt.acct, tt.network, tt.outcome, tt.labelled, before, got)
+		}
+	}
+}
+
+func TestMetricsServedOnlyOnAdmin(t *testing.T) {
+	env := newTestEnv(t, false)
+	if resp, _ := env.get(t, "/metrics"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("public listener served /metrics with %d", resp.StatusCode)
+	}
+
+	cfg := config.Config{AdminUser: "admin", AdminPassword: "secret"}
+	admin := httptest.NewServer(AdminHandler(cfg, env.db, http.NotFoundHandler(), slog.New(slog.DiscardHandler)))
+	t.Cleanup(admin.Close)
+
+	resp, err := http.Get(admin.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("admin /metrics without credentials: %d", resp.StatusCode)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, admin.URL+"/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("admin", "secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body strings.Builder
+	if _, err := io.Copy(&body, resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body.String(), "monalias_resolve_requests_total") {
+		t.Errorf("admin /metrics: %d\n%s", resp.StatusCode, body.String())
+	}
+}
@@ -4,49 +4,80 @@ import (
 	"context"
 	"crypto/ed25519"
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/kaigoh/monalias/internal/config"
 	"github.com/kaigoh/monalias/internal/db"
+	"github.com/kaigoh/monalias/internal/logging"
+	"github.com/kaigoh/monalias/internal/metrics"
 	"github.com/kaigoh/monalias/internal/monero"
+	"github.com/kaigoh/monalias/internal/monero/address"
+	"github.com/kaigoh/monalias/internal/names"
+	"github.com/kaigoh/monalias/internal/seal"
+	"github.com/kaigoh/monalias/pkg/protocol"
 )
 
 type PublicService struct {
-	cfg        config.Config
-	db         *db.DB
-	signer     ed25519.PrivateKey
-	walletRPC  *monero.WalletRPC
-	catchAll   string
-	signingKID string
+	cfg     config.Config
+	db      *db.DB
+	seals   *seal.Box
+	wallets *monero.WalletSessions
+	names   *names.Policy
+	log     *slog.Logger
+
+	aliasLimits *aliasRateLimiter
+	// provisionLimits limits, per account handle, the aliases PROVISION
+	// resolves create.
+	provisionLimits *aliasRateLimiter
 }
 
-func NewPublicService(cfg config.Config, database *db.DB, signer ed25519.PrivateKey, walletRPC *monero.WalletRPC) *PublicService {
+func NewPublicService(cfg config.Config, database *db.DB, seals *seal.Box, wallets *monero.WalletSessions, logger *slog.Logger) *PublicService {
 	return &PublicService{
-		cfg:        cfg,
-		db:         database,
-		signer:     signer,
-		walletRPC:  walletRPC,
-		catchAll:   cfg.CatchAllAddress,
-		signingKID: cfg.SigningKeyID,
+		cfg:     cfg,
+		db:      database,
+		seals:   seals,
+		wallets: wallets,
+		names:   names.NewPolicy(cfg.ReservedNames),
+		log:     logger,
+
+		aliasLimits:     newAliasRateLimiter(),
+		provisionLimits: newAliasRateLimiter(),
 	}
 }
 
-func (s *PublicService) Handler(limiter *IPRateLimiter) http.Handler {
+// Handler builds the public mux. limiter and guard are optional; banned
+// clients are refused before they are charged against the rate limiter.
+func (s *PublicService) Handler(limiter *IPRateLimiter, guard *EnumerationGuard) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/.well-known/monalias", s.handleWellKnown)
-	if limiter != nil {
-		mux.Handle("/_monalias/resolve", limiter.Middleware(http.HandlerFunc(s.handleResolve)))
-	} else {
-		mux.HandleFunc("/_monalias/resolve", s.handleResolve)
+	limited := func(h http.Handler) http.Handler {
+		if limiter != nil {
+			h = limiter.Middleware(h)
+		}
+		if guard != nil {
+			h = guard.Middleware(h)
+		}
+		return h
 	}
+	mux.Handle("/_monalias/resolve", limited(http.HandlerFunc(s.handleResolve)))
+	mux.Handle("/_monalias/qr", limited(http.HandlerFunc(s.handleQR)))
+	// The batch handler charges the limiter itself, once per pair.
+	var batch http.Handler = s.handleResolveBatch(limiter)
+	if guard != nil {
+		batch = guard.Middleware(batch)
+	}
+	mux.Handle("/_monalias/resolve-batch", batch)
 	mux.HandleFunc("/healthz", s.handleHealth)
-	return mux
+	mux.HandleFunc("/readyz", s.handleReady)
+	return requestID(mux)
 }
 
 func (s *PublicService) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -57,31 +88,96 @@ func (s *PublicService) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 func (s *PublicService) handleWellKnown(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	cfg, err := s.db.GetInstanceConfig(ctx)
+	domain, found, err := s.wellKnownDomain(ctx, r.Host)
+	if err != nil {
+		s.log.ErrorContext(ctx, "well-known: load domains", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	if !found {
+		writeJSONError(w, http.StatusNotFound, "unknown_domain")
+		return
+	}
+	published, err := s.db.ListPublishedSigningKeys(ctx, domain.Domain)
 	if err != nil {
+		s.log.ErrorContext(ctx, "well-known: list signing keys", "err", err)
 		writeJSONError(w, http.StatusInternalServerError, "server_error")
 		return
 	}
 
+	keys := make([]map[string]string, 0, len(published))
+	for _, key := range published {
+		keys = append(keys, map[string]string{
+			"kid":        key.KID,
+			"alg":        "Ed25519",
+			"public_key": key.PublicKey,
+			"use":        "sig",
+			"status":     strings.ToLower(key.State),
+		})
+	}
+
 	resp := map[string]interface{}{
-		"homeserver": cfg.Homeserver,
+		"homeserver": domain.Homeserver,
 		"version":    "0.1",
-		"keys": []map[string]string{
-			{
-				"kid":        cfg.SigningKeyID,
-				"alg":        "Ed25519",
-				"public_key": cfg.SigningPubkey,
-				"use":        "sig",
-			},
-		},
+		"keys":       keys,
 	}
 
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// wellKnownDomain picks the domain whose document is served for a request to
+// host. The well-known document normally lives on the domain itself, but it
+// may also be requested from a homeserver directly, and a single-domain
+// instance answers on any host as it always has.
+func (s *PublicService) wellKnownDomain(ctx context.Context, host string) (db.Domain, bool, error) {
+	host = strings.ToLower(hostWithoutPort(host))
+	if ascii, err := names.Domain(host); err == nil {
+		host = ascii
+	}
+	domains, err := s.db.ListDomains(ctx)
+	if err != nil {
+		return db.Domain{}, false, err
+	}
+	for _, d := range domains {
+		if d.Domain == host {
+			return d, true, nil
+		}
+	}
+	var match []db.Domain
+	for _, d := range domains {
+		if u, err := url.Parse(d.Homeserver); err == nil && strings.EqualFold(u.Hostname(), host) {
+			match = append(match, d)
+		}
+	}
+	if len(match) == 1 {
+		return match[0], true, nil
+	}
+	if len(domains) == 1 {
+		return domains[0], true, nil
+	}
+	return db.Domain{}, false, nil
+}
+
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
 type resolveRequest struct {
 	Acct    string `json:"acct"`
 	Network string `json:"network"`
+	protocol.Payment
+
+	// acct is Acct normalized, as aliases are stored. Lookups use it, while
+	// Acct is signed as the client sent it.
+	acct string
+	// reuse answers a dynamic alias with the subaddress it handed out last
+	// instead of a fresh one, and provisions no aliases. The QR endpoint
+	// sets it: its GETs come from crawlers, link previews and prefetches as
+	// much as from payers.
+	reuse bool
 }
 
 type resolveResponse struct {
@@ -89,6 +185,9 @@ type resolveResponse struct {
 	Network   string      `json:"network"`
 	Meta      resolveMeta `json:"meta"`
 	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	// URI is the monero: payment URI, set when the request carried a
+	// payment.
+	URI string `json:"uri,omitempty"`
 }
 
 type resolveMeta struct {
@@ -98,154 +197,468 @@ type resolveMeta struct {
 }
 
 func (s *PublicService) handleResolve(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	outcome, network := s.serveResolve(w, r)
+	metrics.ObserveResolve(outcome, network, time.Since(start))
+	reportOutcome(r.Context(), outcome)
+}
+
+// serveResolve answers one resolve request and reports its outcome and the
+// requested network for metrics.
+func (s *PublicService) serveResolve(w http.ResponseWriter, r *http.Request) (string, string) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
+		return metrics.OutcomeBadRequest, ""
 	}
 
-	ctx := r.Context()
-	instCfg, err := s.db.GetInstanceConfig(ctx)
+	var req resolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request")
+		return metrics.OutcomeBadRequest, ""
+	}
+
+	res := s.resolve(r.Context(), req)
+	res.write(w)
+	return res.outcome, req.Network
+}
+
+// resolveDomain loads the domain acct belongs to and its signing key. When
+// the domain may not answer, because it is not served here, it is locked or
+// its key cannot be loaded, ok is false and res is the answer to send
+// instead. Only that domain is affected; the others keep resolving.
+func (s *PublicService) resolveDomain(ctx context.Context, acct string) (domain db.Domain, key signingKey, res resolveResult, ok bool) {
+	name, found := acctDomain(acct)
+	if !found {
+		return db.Domain{}, signingKey{}, errorResult(http.StatusNotFound, "alias_not_found", metrics.OutcomeNotFound), false
+	}
+	domain, err := s.db.GetDomain(ctx, name)
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "server_error")
-		return
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.Domain{}, signingKey{}, errorResult(http.StatusNotFound, "alias_not_found", metrics.OutcomeNotFound), false
+		}
+		s.log.ErrorContext(ctx, "resolve: load domain", "domain", name, "err", err)
+		return db.Domain{}, signingKey{}, errorResult(http.StatusInternalServerError, "server_error", metrics.OutcomeError), false
 	}
-	if instCfg.Status == "LOCKED" {
-		writeJSONErrorWithReason(w, http.StatusServiceUnavailable, "instance_locked", instCfg.StatusReason)
-		return
+	if domain.Status == "LOCKED" {
+		res = errorResult(http.StatusServiceUnavailable, "instance_locked", metrics.OutcomeLocked)
+		if domain.StatusReason.Valid {
+			res.body = map[string]interface{}{"error": "instance_locked", "reason": domain.StatusReason.String}
+		}
+		return db.Domain{}, signingKey{}, res, false
+	}
+	key, err = s.activeSigningKey(ctx, domain.Domain)
+	if err != nil {
+		s.log.ErrorContext(ctx, "resolve: load signing key", "domain", domain.Domain, "err", err)
+		return db.Domain{}, signingKey{}, errorResult(http.StatusInternalServerError, "server_error", metrics.OutcomeError), false
 	}
+	return domain, key, resolveResult{}, true
+}
 
-	var req resolveRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "bad_request")
-		return
+// resolveResult is the answer to one acct/network pair before it is written
+// out, either as a whole response or as one item of a batch.
+type resolveResult struct {
+	status  int
+	body    interface{}
+	outcome string
+
+	// kid and sig are set for signed answers.
+	kid string
+	sig string
+	// ttl is the cache lifetime of a successful answer.
+	ttl time.Duration
+	// retryAfter is set, in whole seconds, for alias_rate_limited.
+	retryAfter int
+}
+
+func (res resolveResult) write(w http.ResponseWriter) {
+	if res.kid != "" {
+		w.Header().Set(protocol.HeaderKeyID, res.kid)
+		w.Header().Set(protocol.HeaderSignature, res.sig)
+	}
+	if res.status == http.StatusOK {
+		w.Header().Set("Cache-Control", cacheControl(res.ttl))
 	}
+	if res.retryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(res.retryAfter))
+	}
+	writeJSON(w, res.status, res.body)
+}
+
+// resolve answers one acct/network pair, signing with the key of the acct's
+// domain.
+func (s *PublicService) resolve(ctx context.Context, req resolveRequest) resolveResult {
 	if req.Acct == "" || req.Network == "" {
-		writeJSONError(w, http.StatusBadRequest, "bad_request")
-		return
+		return errorResult(http.StatusBadRequest, "bad_request", metrics.OutcomeBadRequest)
 	}
 	if req.Network != "mainnet" && req.Network != "stagenet" {
-		writeJSONError(w, http.StatusBadRequest, "invalid_network")
-		return
+		return errorResult(http.StatusBadRequest, "invalid_network", metrics.OutcomeBadRequest)
 	}
-	if !acctMatchesDomain(req.Acct, s.cfg.Domain) {
-		writeJSONError(w, http.StatusNotFound, "alias_not_found")
-		return
+	payment, err := req.Payment.Normalize()
+	if err != nil {
+		var perr *protocol.PaymentError
+		errors.As(err, &perr)
+		return errorResult(http.StatusBadRequest, "invalid_"+perr.Field, metrics.OutcomeBadRequest)
+	}
+	req.Payment = payment
+	req.acct, err = names.Acct(req.Acct)
+	if err != nil {
+		// No alias is stored under an acct that does not normalize.
+		return errorResult(http.StatusNotFound, "alias_not_found", metrics.OutcomeNotFound)
+	}
+	domain, key, res, ok := s.resolveDomain(ctx, req.acct)
+	if !ok {
+		return res
 	}
 
-	alias, err := s.db.GetAliasByFullAcct(ctx, req.Acct)
+	alias, err := s.db.GetAliasByFullAcct(ctx, req.acct)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			s.handleCatchAll(w, req)
-			return
+			return s.catchAllResult(ctx, domain, key, req)
 		}
-		writeJSONError(w, http.StatusInternalServerError, "server_error")
-		return
+		s.log.ErrorContext(ctx, "resolve: look up alias", logging.Acct(req.Acct), "err", err)
+		return errorResult(http.StatusInternalServerError, "server_error", metrics.OutcomeError)
+	}
+	if !alias.Enabled {
+		return s.catchAllResult(ctx, domain, key, req)
+	}
+	return s.aliasResult(ctx, key, req, alias, "NORMAL", metrics.OutcomeNormal)
+}
+
+// aliasResult answers req with alias's address, reporting kind as
+// meta.resolved_kind.
+func (s *PublicService) aliasResult(ctx context.Context, key signingKey, req resolveRequest, alias db.Alias, kind, outcome string) resolveResult {
+	if ok, retry := s.aliasLimits.allow(alias.FullAcct, s.aliasRateLimit(alias)); !ok {
+		return signedRetryResult(key, req, "alias_rate_limited", retry)
 	}
 
-	address, aliasLabel, resolvedKind, err := s.resolveAlias(ctx, alias)
+	addr, err := s.resolveAlias(ctx, alias, req.Network, req.reuse)
+	if err == nil {
+		err = checkAddressNetwork(addr, req.Network)
+	}
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "server_error")
-		return
+		if errors.Is(err, errNetworkNotSupported) {
+			return signedErrorResult(key, req, http.StatusNotFound, "network_not_supported", metrics.OutcomeNetworkUnsupported)
+		}
+		s.log.ErrorContext(ctx, "resolve failed", logging.Acct(req.Acct), "network", req.Network, "alias_id", alias.ID, "mode", alias.Mode, "err", err)
+		return errorResult(http.StatusInternalServerError, "server_error", metrics.OutcomeError)
 	}
 
+	label := alias.AliasLabel
 	resp := resolveResponse{
-		Address: address,
+		Address: addr,
 		Network: req.Network,
 		Meta: resolveMeta{
-			Alias:        aliasLabel,
-			ResolvedKind: resolvedKind,
+			Alias:        &label,
+			ResolvedKind: kind,
 		},
 	}
 
-	if display := displayNameFromAcct(req.Acct); display != "" {
+	if display := displayNameFromAcct(req.acct); display != "" {
 		resp.Meta.DisplayName = &display
 	}
 
-	s.signResolveResponse(w, req, resp)
-	writeJSON(w, http.StatusOK, resp)
+	return resolvedResult(key, req, resp, s.aliasTTL(alias), outcome)
 }
 
-func (s *PublicService) resolveAlias(ctx context.Context, alias db.Alias) (string, *string, string, error) {
-	label := alias.AliasLabel
-	resolvedKind := "NORMAL"
+// errNetworkNotSupported means the alias has no address or wallet configured
+// for the requested network.
+var errNetworkNotSupported = errors.New("network not supported")
 
+// resolveAlias returns the address to serve for alias on network. With
+// reuse, a dynamic alias serves its last issued subaddress, and allocates
+// one only if it has never been issued any.
+func (s *PublicService) resolveAlias(ctx context.Context, alias db.Alias, network string, reuse bool) (string, error) {
 	if alias.Mode == "STATIC_ADDRESS" {
-		if !alias.StaticAddress.Valid || alias.StaticAddress.String == "" {
-			return "", nil, "", errors.New("static address missing")
+		static, _ := alias.AddressFor(network)
+		if !static.Valid || static.String == "" {
+			return "", errNetworkNotSupported
 		}
-		return alias.StaticAddress.String, &label, resolvedKind, nil
+		return static.String, nil
 	}
 
 	if alias.Mode == "DYNAMIC_SUBADDRESS" {
-		if alias.StaticAddress.Valid && alias.StaticAddress.String != "" {
-			return alias.StaticAddress.String, &label, resolvedKind, nil
-		}
-		if !alias.NextSubaddrIdx.Valid {
-			return "", nil, "", errors.New("dynamic alias missing index")
-		}
-		if s.walletRPC == nil || !s.walletRPC.Enabled() {
-			return "", nil, "", errors.New("wallet rpc not configured")
+		if !s.wallets.Enabled() {
+			return "", errors.New("wallet rpc not configured")
 		}
 		acct, err := s.db.GetAccount(ctx, alias.AccountID)
 		if err != nil {
-			return "", nil, "", err
+			return "", err
 		}
-		if !acct.WalletName.Valid || acct.WalletName.String == "" {
-			return "", nil, "", errors.New("wallet name missing")
+		wallet := acct.WalletFor(network)
+		if !wallet.Valid || wallet.String == "" {
+			return "", errNetworkNotSupported
 		}
-		if err := s.walletRPC.OpenWallet(ctx, acct.WalletName.String); err != nil {
-			return "", nil, "", err
+		if last, _ := alias.AddressFor(network); reuse && last.Valid && last.String != "" {
+			return last.String, nil
 		}
-		addr, err := s.walletRPC.GetAddress(ctx, alias.NextSubaddrIdx.Int64)
+
+		// Every resolve hands out a fresh subaddress so payers can't be linked
+		// on-chain. The index is persisted while the wallet session is held,
+		// so it advances in the same order the wallet allocated addresses.
+		var addr string
+		err = s.wallets.With(ctx, wallet.String, func(rpc *monero.WalletRPC) error {
+			created, idx, err := rpc.CreateAddress(ctx, alias.AliasLabel)
+			if err != nil {
+				return err
+			}
+			if _, err := s.db.AdvanceAliasSubaddress(ctx, alias.ID, network, created, idx); err != nil {
+				return err
+			}
+			addr = created
+			return nil
+		})
 		if err != nil {
-			return "", nil, "", err
+			return "", err
 		}
-		return addr, &label, resolvedKind, nil
+		return addr, nil
 	}
 
-	return "", nil, "", errors.New("unknown alias mode")
+	return "", errors.New("unknown alias mode")
 }
 
-func (s *PublicService) handleCatchAll(w http.ResponseWriter, req resolveRequest) {
-	if s.catchAll == "" {
-		writeJSONError(w, http.StatusNotFound, "alias_not_found")
-		return
+// checkAddressNetwork refuses to serve an address that does not decode as a
+// Monero address on the requested network. A well-formed address for another
+// network is reported as errNetworkNotSupported.
+func checkAddressNetwork(addr, network string) error {
+	if _, err := address.Validate(addr, network); err != nil {
+		if errors.Is(err, address.ErrWrongNetwork) {
+			return errNetworkNotSupported
+		}
+		return err
+	}
+	return nil
+}
+
+// catchAllResult answers an acct without an enabled alias by the most
+// specific catch-all rule: the catch-all mode of the account the acct
+// belongs to, when it has one, and otherwise the domain's catch-all.
+// meta.resolved_kind reports which rule answered.
+func (s *PublicService) catchAllResult(ctx context.Context, domain db.Domain, key signingKey, req resolveRequest) resolveResult {
+	account, err := s.db.GetAccountByHandle(ctx, acctHandle(req.acct))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		s.log.ErrorContext(ctx, "resolve: look up account", logging.Acct(req.Acct), "err", err)
+		return errorResult(http.StatusInternalServerError, "server_error", metrics.OutcomeError)
+	case account.CatchAllMode.Valid:
+		return s.accountCatchAllResult(ctx, account, key, req)
+	}
+
+	display := fmt.Sprintf("%s (catch-all)", domain.Domain)
+	return catchAllAddressResult(key, req, domain.CatchAllAddress, domain.CatchAllStagenetAddress, display, "CATCH_ALL", s.cfg.ResolveTTL)
+}
+
+// accountCatchAllResult applies the account's own catch-all mode, which
+// overrides the domain's.
+func (s *PublicService) accountCatchAllResult(ctx context.Context, account db.Account, key signingKey, req resolveRequest) resolveResult {
+	switch account.CatchAllMode.String {
+	case db.CatchAllDefaultAlias, db.CatchAllProvision:
+		if account.CatchAllMode.String == db.CatchAllProvision {
+			if res, ok := s.provisionAlias(ctx, account, key, req); ok {
+				return res
+			}
+		}
+		alias, err := s.db.GetAliasByFullAcct(ctx, account.Handle)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.log.ErrorContext(ctx, "resolve: look up default alias", logging.Acct(req.Acct), "err", err)
+			return errorResult(http.StatusInternalServerError, "server_error", metrics.OutcomeError)
+		}
+		// Without an enabled default alias there is nothing to fall back
+		// to.
+		if err != nil || !alias.Enabled || alias.FullAcct == req.acct {
+			return errorResult(http.StatusNotFound, "alias_not_found", metrics.OutcomeNotFound)
+		}
+		return s.aliasResult(ctx, key, req, alias, "DEFAULT_ALIAS", metrics.OutcomeDefaultAlias)
+	case db.CatchAllAddress:
+		display := fmt.Sprintf("%s (catch-all)", displayNameFromAcct(account.Handle))
+		return catchAllAddressResult(key, req, account.CatchAllAddress, account.CatchAllStagenetAddress, display, "ACCOUNT_CATCH_ALL", s.cfg.ResolveTTL)
+	}
+	return errorResult(http.StatusNotFound, "alias_not_found", metrics.OutcomeNotFound)
+}
+
+// maxProvisionedLabelLen bounds the labels PROVISION accounts create aliases
+// for.
+const maxProvisionedLabelLen = 32
+
+var errProvisionRateLimited = errors.New("account is provisioning aliases too fast")
+
+// provisionAlias creates a dynamic alias for the +label of req.acct and
+// answers with the first subaddress allocated for it. It declines, leaving
+// the answer to the default alias, when req.reuse is set, the acct has no
+// label fit for an alias, the alias exists but is disabled, the account has
+// no wallet on the requested network, or it has reached its cap or rate of
+// provisioned aliases.
+func (s *PublicService) provisionAlias(ctx context.Context, account db.Account, key signingKey, req resolveRequest) (resolveResult, bool) {
+	label, ok := acctLabel(req.acct)
+	if req.reuse || !ok || !s.provisionableLabel(label) || !s.wallets.Enabled() {
+		return resolveResult{}, false
+	}
+	if wallet := account.WalletFor(req.Network); !wallet.Valid || wallet.String == "" {
+		return resolveResult{}, false
+	}
+
+	var alias db.Alias
+	var err error
+	if ok, _ := s.provisionLimits.allow(account.Handle, int64(s.cfg.ProvisionRatePerMinute)); !ok {
+		err = errProvisionRateLimited
+	} else {
+		alias, err = s.db.CreateProvisionedAlias(ctx, account.ID, req.acct, label, s.cfg.ProvisionMaxPerAccount)
+	}
+	if err != nil {
+		// A concurrent resolve may have provisioned the alias first;
+		// otherwise it exists disabled, or the account may not have
+		// another one yet.
+		existing, getErr := s.db.GetAliasByFullAcct(ctx, req.acct)
+		if getErr == nil && existing.Enabled {
+			return s.aliasResult(ctx, key, req, existing, "PROVISIONED", metrics.OutcomeProvisioned), true
+		}
+		switch {
+		case getErr == nil:
+		case errors.Is(err, db.ErrProvisionCap), errors.Is(err, errProvisionRateLimited):
+			s.log.WarnContext(ctx, "resolve: alias not provisioned", logging.Acct(req.Acct), "account_id", account.ID, "reason", err)
+		default:
+			s.log.ErrorContext(ctx, "resolve: provision alias", logging.Acct(req.Acct), "err", err)
+		}
+		return resolveResult{}, false
+	}
+	s.log.InfoContext(ctx, "provisioned alias", logging.Acct(req.Acct), "alias_id", alias.ID, "account_id", account.ID)
+	return s.aliasResult(ctx, key, req, alias, "PROVISIONED", metrics.OutcomeProvisioned), true
+}
+
+// provisionableLabel reports whether label may name an alias created by a
+// resolve: one the naming policy allows, made only of lowercase letters,
+// digits, '-' and '_', and at most maxProvisionedLabelLen long.
+func (s *PublicService) provisionableLabel(label string) bool {
+	if len(label) > maxProvisionedLabelLen || s.names.Label(label) != nil {
+		return false
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// catchAllAddressResult serves a catch-all address set per network. When
+// only the other network has one, the answer is a signed
+// network_not_supported; when neither has, alias_not_found.
+func catchAllAddressResult(key signingKey, req resolveRequest, mainnet, stagenet sql.NullString, display, kind string, ttl time.Duration) resolveResult {
+	addr := mainnet.String
+	if req.Network == db.NetworkStagenet {
+		addr = stagenet.String
+	}
+	if addr == "" {
+		if mainnet.String != "" || stagenet.String != "" {
+			return signedErrorResult(key, req, http.StatusNotFound, "network_not_supported", metrics.OutcomeNetworkUnsupported)
+		}
+		return errorResult(http.StatusNotFound, "alias_not_found", metrics.OutcomeNotFound)
 	}
 
 	resp := resolveResponse{
-		Address: s.catchAll,
+		Address: addr,
 		Network: req.Network,
 		Meta: resolveMeta{
-			ResolvedKind: "CATCH_ALL",
+			DisplayName:  &display,
+			ResolvedKind: kind,
 		},
 	}
+	return resolvedResult(key, req, resp, ttl, metrics.OutcomeCatchAll)
+}
 
-	if display := fmt.Sprintf("%s (catch-all)", s.cfg.Domain); display != "" {
-		resp.Meta.DisplayName = &display
+// aliasRateLimit returns the resolves per minute allowed for alias; 0 means
+// unlimited.
+func (s *PublicService) aliasRateLimit(alias db.Alias) int64 {
+	if alias.RateLimitPerMinute.Valid {
+		return alias.RateLimitPerMinute.Int64
+	}
+	return int64(s.cfg.AliasRatePerMinute)
+}
+
+func (s *PublicService) aliasTTL(alias db.Alias) time.Duration {
+	if alias.TTLSeconds.Valid {
+		return time.Duration(alias.TTLSeconds.Int64) * time.Second
 	}
+	return s.cfg.ResolveTTL
+}
 
-	s.signResolveResponse(w, req, resp)
-	writeJSON(w, http.StatusOK, resp)
+// cacheControl returns the Cache-Control header for an answer that expires
+// after ttl.
+func cacheControl(ttl time.Duration) string {
+	if ttl < time.Second {
+		return "no-store"
+	}
+	return fmt.Sprintf("private, max-age=%d", int64(ttl/time.Second))
+}
+
+type signingKey struct {
+	kid  string
+	priv ed25519.PrivateKey
+}
+
+// activeSigningKey loads the domain's key currently marked ACTIVE in
+// signing_keys.
+func (s *PublicService) activeSigningKey(ctx context.Context, domain string) (signingKey, error) {
+	key, err := s.db.GetActiveSigningKey(ctx, domain)
+	if err != nil {
+		return signingKey{}, err
+	}
+	if !key.PrivateSeed.Valid {
+		return signingKey{}, fmt.Errorf("signing key %s has no private seed", key.KID)
+	}
+	seed, err := s.seals.Open(key.KID, key.PrivateSeed.String)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("signing key %s: %w", key.KID, err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return signingKey{}, fmt.Errorf("signing key %s has an invalid private seed", key.KID)
+	}
+	return signingKey{kid: key.KID, priv: ed25519.NewKeyFromSeed(seed)}, nil
 }
 
-func (s *PublicService) signResolveResponse(w http.ResponseWriter, req resolveRequest, resp resolveResponse) {
-	expires := ""
-	if resp.ExpiresAt != nil {
-		expires = resp.ExpiresAt.UTC().Format(time.RFC3339)
+// resolvedResult stamps expires_at on resp, adds the payment URI when one
+// was requested, and signs it. expires_at is truncated to whole seconds so
+// the JSON body and the signed canonical string carry the same value.
+func resolvedResult(key signingKey, req resolveRequest, resp resolveResponse, ttl time.Duration, outcome string) resolveResult {
+	expires := time.Now().UTC().Add(ttl).Truncate(time.Second)
+	resp.ExpiresAt = &expires
+
+	if !req.Payment.IsZero() {
+		resp.URI = protocol.PaymentURI(resp.Address, req.Payment)
 	}
+	canonical := protocol.SuccessCanonical(req.Acct, resp.Address, req.Network, protocol.FormatExpiresAt(expires), key.kid, resp.URI)
+	return resolveResult{
+		status:  http.StatusOK,
+		body:    resp,
+		outcome: outcome,
+		kid:     key.kid,
+		sig:     protocol.Sign(key.priv, canonical),
+		ttl:     ttl,
+	}
+}
 
-	canonical := strings.Join([]string{
-		"MONALIAS_RESOLVE",
-		req.Acct,
-		resp.Address,
-		req.Network,
-		expires,
-		s.signingKID,
-	}, "\n")
+func errorResult(status int, code, outcome string) resolveResult {
+	return resolveResult{status: status, body: map[string]interface{}{"error": code}, outcome: outcome}
+}
+
+// signedErrorResult is an error that is specific to the requested acct and
+// network, signed so clients can tell it apart from a forged or
+// proxy-generated error.
+func signedErrorResult(key signingKey, req resolveRequest, status int, code, outcome string) resolveResult {
+	res := errorResult(status, code, outcome)
+	res.kid = key.kid
+	res.sig = protocol.Sign(key.priv, protocol.ErrorCanonical(req.Acct, req.Network, code, key.kid))
+	return res
+}
 
-	sig := ed25519.Sign(s.signer, []byte(canonical))
-	w.Header().Set("X-Monalias-Key-Id", s.signingKID)
-	w.Header().Set("X-Monalias-Sig", base64.StdEncoding.EncodeToString(sig))
+// signedRetryResult is a signed 429 carrying retry_after_seconds, rounding
+// retry up to whole seconds.
+func signedRetryResult(key signingKey, req resolveRequest, code string, retry time.Duration) resolveResult {
+	secs := int((retry + time.Second - 1) / time.Second)
+	res := signedErrorResult(key, req, http.StatusTooManyRequests, code, metrics.OutcomeAliasRateLimited)
+	res.body = map[string]interface{}{"error": code, "retry_after_seconds": secs}
+	res.retryAfter = secs
+	return res
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
@@ -258,20 +671,28 @@ func writeJSONError(w http.ResponseWriter, status int, code string) {
 	writeJSON(w, status, map[string]interface{}{"error": code})
 }
 
-func writeJSONErrorWithReason(w http.ResponseWriter, status int, code string, reason sql.NullString) {
-	payload := map[string]interface{}{"error": code}
-	if reason.Valid {
-		payload["reason"] = reason.String
+// acctDomain returns the domain part of acct.
+func acctDomain(acct string) (string, bool) {
+	parts := strings.Split(acct, "$")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", false
 	}
-	writeJSON(w, status, payload)
+	return parts[1], true
 }
 
-func acctMatchesDomain(acct, domain string) bool {
-	parts := strings.Split(acct, "$")
-	if len(parts) != 2 {
-		return false
-	}
-	return strings.EqualFold(parts[1], domain)
+// acctHandle returns the handle of the account acct belongs to: acct without
+// its +label.
+func acctHandle(acct string) string {
+	local, domain, _ := strings.Cut(acct, "$")
+	local, _, _ = strings.Cut(local, "+")
+	return local + "$" + domain
+}
+
+// acctLabel returns the +label of acct, if it has one.
+func acctLabel(acct string) (string, bool) {
+	local, _, _ := strings.Cut(acct, "$")
+	_, label, ok := strings.Cut(local, "+")
+	return label, ok
 }
 
 func displayNameFromAcct(acct string) string {
@@ -0,0 +1,124 @@
+package httpx
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"github.com/kaigoh/monalias/internal/metrics"
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+)
+
+func (s *PublicService) handleQR(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	outcome, network := s.serveQR(w, r)
+	metrics.ObserveResolve(outcome, network, time.Since(start))
+	reportOutcome(r.Context(), outcome)
+}
+
+// serveQR resolves the pair in the query string like /_monalias/resolve and
+// renders the resulting monero: URI as a PNG or SVG QR code. The image is
+// for display only: it carries no signature, so integrators that need to
+// verify the address use the resolve endpoint. A GET must not use up wallet
+// subaddresses, so dynamic aliases show the subaddress they issued last.
+func (s *PublicService) serveQR(w http.ResponseWriter, r *http.Request) (string, string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return metrics.OutcomeBadRequest, ""
+	}
+
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_format")
+		return metrics.OutcomeBadRequest, ""
+	}
+	size := defaultQRSize
+	if v := q.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			writeJSONError(w, http.StatusBadRequest, "invalid_size")
+			return metrics.OutcomeBadRequest, ""
+		}
+		size = n
+	}
+
+	ctx := r.Context()
+	req := resolveRequest{
+		Acct:    q.Get("acct"),
+		Network: q.Get("network"),
+		Payment: protocol.Payment{
+			Amount:        q.Get("amount"),
+			TxDescription: q.Get("tx_description"),
+			RecipientName: q.Get("recipient_name"),
+		},
+		reuse: true,
+	}
+	res := s.resolve(ctx, req)
+	if res.status != http.StatusOK {
+		res.write(w)
+		return res.outcome, req.Network
+	}
+
+	resp := res.body.(resolveResponse)
+	uri := resp.URI
+	if uri == "" {
+		uri = protocol.PaymentURI(resp.Address, protocol.Payment{})
+	}
+	code, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		s.log.ErrorContext(ctx, "qr: encode", "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "server_error")
+		return metrics.OutcomeError, req.Network
+	}
+
+	var body []byte
+	contentType := "image/svg+xml"
+	if format == "png" {
+		contentType = "image/png"
+		if body, err = code.PNG(size); err != nil {
+			s.log.ErrorContext(ctx, "qr: render png", "err", err)
+			writeJSONError(w, http.StatusInternalServerError, "server_error")
+			return metrics.OutcomeError, req.Network
+		}
+	} else {
+		body = qrSVG(code.Bitmap(), size)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", cacheControl(res.ttl))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+	return res.outcome, req.Network
+}
+
+// qrSVG draws a QR bitmap, quiet zone included, as one path of unit squares
+// scaled to size pixels.
+func qrSVG(bitmap [][]bool, size int) []byte {
+	n := len(bitmap)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.Bytes()
+}
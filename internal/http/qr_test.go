@@ -0,0 +1,148 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kaigoh/monalias/internal/db"
+)
+
+func TestQRPNG(t *testing.T) {
+	env := newStaticEnv(t)
+
+	resp, body := env.get(t, "/_monalias/qr?acct=bob%2Btips%24example.com&network=mainnet&amount=1.5&size=128")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d: %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("content type = %q", ct)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "private, max-age=300" {
+		t.Errorf("cache control = %q", cc)
+	}
+	img, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 128 || b.Dy() != 128 {
+		t.Errorf("image is %dx%d, want 128x128", b.Dx(), b.Dy())
+	}
+}
+
+func TestQRSVG(t *testing.T) {
+	env := newStaticEnv(t)
+
+	resp, body := env.get(t, "/_monalias/qr?acct=bob%2Btips%24example.com&network=mainnet&format=svg")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d: %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("content type = %q", ct)
+	}
+	if !bytes.HasPrefix(body, []byte("<svg ")) || !strings.Contains(string(body), `width="256"`) {
+		t.Errorf("unexpected svg: %.100s", body)
+	}
+}
+
+func TestQRErrors(t *testing.T) {
+	env := newStaticEnv(t)
+
+	tests := []struct {
+		query  string
+		status int
+		code   string
+	}{
+		{"acct=alice%24example.com&network=mainnet", http.StatusNotFound, "alias_not_found"},
+		{"acct=bob%2Btips%24example.com&network=stagenet", http.StatusNotFound, "network_not_supported"},
+		{"acct=bob%2Btips%24example.com&network=mainnet&amount=abc", http.StatusBadRequest, "invalid_amount"},
+		{"acct=bob%2Btips%24example.com&network=mainnet&format=gif", http.StatusBadRequest, "invalid_format"},
+		{"acct=bob%2Btips%24example.com&network=mainnet&size=5000", http.StatusBadRequest, "invalid_size"},
+	}
+	for _, tt := range tests {
+		resp, body := env.get(t, "/_monalias/qr?"+tt.query)
+		var out struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(body, &out)
+		if resp.StatusCode != tt.status || out.Error != tt.code {
+			t.Errorf("%s: got %d %q, want %d %q", tt.query, resp.StatusCode, out.Error, tt.status, tt.code)
+		}
+	}
+}
+
+// TestQRDoesNotRotateDynamicAlias checks that QR GETs, which crawlers and
+// link previews make too, show a dynamic alias's last subaddress instead of
+// asking the wallet for a new one.
+func TestQRDoesNotRotateDynamicAlias(t *testing.T) {
+	env := newTestEnv(t, true)
+	ctx := context.Background()
+	account, err := env.db.CreateAccount(ctx, "bob$example.com", sql.NullString{String: "bob", Valid: true}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := sql.NullString{String: testAddress, Valid: true}
+	alias, err := env.db.CreateAlias(ctx, account.ID, "bob+coffee$example.com", "coffee", "DYNAMIC_SUBADDRESS", issued, sql.NullInt64{Int64: 4, Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		resp, body := env.get(t, "/_monalias/qr?acct=bob%2Bcoffee%24example.com&network=mainnet")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got %d: %s", resp.StatusCode, body)
+		}
+	}
+	if labels := env.wallet.createdLabels(); len(labels) != 0 {
+		t.Errorf("QR GETs called create_address for %q", labels)
+	}
+	got, err := env.db.GetAliasByID(ctx, alias.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.NextSubaddrIdx.Int64 != 4 {
+		t.Errorf("next_subaddr_idx = %d after QR GETs; want 4", got.NextSubaddrIdx.Int64)
+	}
+
+	// The resolve endpoint still rotates.
+	if resp, body := env.resolveAcct(t, "bob+coffee$example.com", "mainnet"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("resolve: got %d: %v", resp.StatusCode, body)
+	}
+	if labels := env.wallet.createdLabels(); len(labels) != 1 {
+		t.Errorf("resolve called create_address %d times; want 1", len(labels))
+	}
+}
+
+// TestQRDoesNotProvision checks that a QR GET for an unknown label of a
+// PROVISION account creates no alias.
+func TestQRDoesNotProvision(t *testing.T) {
+	env := newTestEnv(t, true)
+	ctx := context.Background()
+	bob, err := env.db.CreateAccount(ctx, "bob$example.com", sql.NullString{String: "bob", Valid: true}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.CreateAlias(ctx, bob.ID, "bob$example.com", "default", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.UpdateAccountCatchAllMode(ctx, bob.ID, sql.NullString{String: db.CatchAllProvision, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := env.get(t, "/_monalias/qr?acct=bob%2Bnew%24example.com&network=mainnet")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d: %s", resp.StatusCode, body)
+	}
+	if labels := env.wallet.createdLabels(); len(labels) != 0 {
+		t.Errorf("QR GET called create_address for %q", labels)
+	}
+	if _, err := env.db.GetAliasByFullAcct(ctx, "bob+new$example.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("QR GET provisioned an alias: %v", err)
+	}
+}
@@ -1,12 +1,13 @@
 package httpx
 
 import (
-	"net"
 	"net/http"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
+
+	"github.com/kaigoh/monalias/internal/metrics"
 )
 
 type ipLimiter struct {
@@ -15,17 +16,21 @@ type ipLimiter struct {
 }
 
 type IPRateLimiter struct {
-	rps   rate.Limit
-	burst int
-	mu    sync.Mutex
-	ips   map[string]*ipLimiter
+	rps     rate.Limit
+	burst   int
+	clients *ClientIPResolver
+	mu      sync.Mutex
+	ips     map[string]*ipLimiter
 }
 
-func NewIPRateLimiter(rps float64, burst int) *IPRateLimiter {
+// NewIPRateLimiter limits each client, as identified by clients, to rps
+// requests per second with the given burst.
+func NewIPRateLimiter(rps float64, burst int, clients *ClientIPResolver) *IPRateLimiter {
 	l := &IPRateLimiter{
-		rps:   rate.Limit(rps),
-		burst: burst,
-		ips:   make(map[string]*ipLimiter),
+		rps:     rate.Limit(rps),
+		burst:   burst,
+		clients: clients,
+		ips:     make(map[string]*ipLimiter),
 	}
 
 	go l.cleanupLoop()
@@ -66,28 +71,113 @@ func (l *IPRateLimiter) cleanup() {
 
 func (l *IPRateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := clientIP(r)
-		limiter := l.getLimiter(ip)
+		limiter := l.getLimiter(l.clients.Key(r))
 		if !limiter.Allow() {
-			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("Retry-After", "30")
-			w.WriteHeader(http.StatusTooManyRequests)
-			_, _ = w.Write([]byte(`{"error":"rate_limited","retry_after_seconds":30}`))
+			writeRateLimited(w)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// allowN charges r's client n requests. A client may spend at most its
+// burst at once; whatever a larger charge exceeds that by is taken as debt
+// the bucket has to refill before the client's next request.
+func (l *IPRateLimiter) allowN(r *http.Request, n int) bool {
+	limiter := l.getLimiter(l.clients.Key(r))
+	now := time.Now()
+	first := min(n, l.burst)
+	if !limiter.AllowN(now, first) {
+		return false
+	}
+	for rest := n - first; rest > 0; rest -= l.burst {
+		limiter.ReserveN(now, min(rest, l.burst))
+	}
+	return true
+}
+
+func writeRateLimited(w http.ResponseWriter) {
+	metrics.ObserveResolve(metrics.OutcomeRateLimited, "", 0)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "30")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, _ = w.Write([]byte(`{"error":"rate_limited","retry_after_seconds":30}`))
+}
+
+// Len returns the number of clients currently tracked.
+func (l *IPRateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.ips)
+}
+
 func (l *IPRateLimiter) Allow(ip string) bool {
 	limiter := l.getLimiter(ip)
 	return limiter.Allow()
 }
 
-func clientIP(r *http.Request) string {
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+type aliasLimiter struct {
+	perMinute int64
+	limiter   *rate.Limiter
+	lastSeen  time.Time
+}
+
+// aliasRateLimiter caps resolves per full_acct, so a rotating subaddress
+// alias cannot be drained by resolving it in a loop from many addresses.
+// Each alias gets a bucket of perMinute tokens that refills over a minute;
+// the bucket is rebuilt when the alias's limit changes.
+type aliasRateLimiter struct {
+	mu      sync.Mutex
+	aliases map[string]*aliasLimiter
+}
+
+func newAliasRateLimiter() *aliasRateLimiter {
+	l := &aliasRateLimiter{aliases: make(map[string]*aliasLimiter)}
+	go l.cleanupLoop()
+	return l
+}
+
+// allow takes a token for acct. When the bucket is empty it reports how long
+// until the next token.
+func (l *aliasRateLimiter) allow(acct string, perMinute int64) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	entry, ok := l.aliases[acct]
+	if !ok || entry.perMinute != perMinute {
+		entry = &aliasLimiter{
+			perMinute: perMinute,
+			limiter:   rate.NewLimiter(rate.Limit(float64(perMinute)/60), int(perMinute)),
+		}
+		l.aliases[acct] = entry
+	}
+	entry.lastSeen = time.Now()
+	l.mu.Unlock()
+
+	res := entry.limiter.Reserve()
+	if delay := res.Delay(); delay > 0 {
+		res.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
+func (l *aliasRateLimiter) cleanupLoop() {
+	for {
+		time.Sleep(2 * time.Minute)
+		l.cleanup()
+	}
+}
+
+func (l *aliasRateLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for acct, entry := range l.aliases {
+		if time.Since(entry.lastSeen) > 10*time.Minute {
+			delete(l.aliases, acct)
+		}
 	}
-	return host
 }
@@ -0,0 +1,148 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/db"
+)
+
+const readyCheckTimeout = 3 * time.Second
+
+type readyResponse struct {
+	Status     string                    `json:"status"`
+	Components map[string]readyComponent `json:"components"`
+}
+
+// readyComponent reports one dependency. Status is "ok", "disabled" (not
+// configured, which does not affect readiness), "degraded" (working but
+// worth a look) or "fail". Detail never carries raw errors, since the
+// endpoint is public; those go to the log.
+type readyComponent struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// handleReady reports whether the instance can serve resolves: the database
+// answers, wallet-rpc answers (when configured), and at least one domain is
+// not LOCKED and has an active signing key that loads. It returns 503 when
+// any component fails. /healthz stays a pure liveness check.
+func (s *PublicService) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+
+	resp := readyResponse{
+		Status: "ready",
+		Components: map[string]readyComponent{
+			"database":    s.checkDatabase(ctx),
+			"wallet_rpc":  s.checkWalletRPC(ctx),
+			"identity":    s.checkIdentity(ctx),
+			"signing_key": s.checkSigningKey(ctx),
+		},
+	}
+	status := http.StatusOK
+	for _, c := range resp.Components {
+		if c.Status == "fail" {
+			resp.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, resp)
+}
+
+func (s *PublicService) checkDatabase(ctx context.Context) readyComponent {
+	if err := s.db.Ping(ctx); err != nil {
+		s.log.WarnContext(ctx, "readiness: database ping failed", "err", err)
+		return readyComponent{Status: "fail", Detail: "unreachable"}
+	}
+	return readyComponent{Status: "ok"}
+}
+
+func (s *PublicService) checkWalletRPC(ctx context.Context) readyComponent {
+	if !s.wallets.Enabled() {
+		return readyComponent{Status: "disabled"}
+	}
+	version, err := s.wallets.Version(ctx)
+	if err != nil {
+		s.log.WarnContext(ctx, "readiness: wallet rpc get_version failed", "err", err)
+		return readyComponent{Status: "fail", Detail: "unreachable"}
+	}
+	return readyComponent{Status: "ok", Detail: fmt.Sprintf("version %d.%d", version>>16, version&0xffff)}
+}
+
+// checkIdentity fails only when every domain is LOCKED, since the others
+// still resolve; a locked or DEGRADED domain next to healthy ones makes the
+// component degraded.
+func (s *PublicService) checkIdentity(ctx context.Context) readyComponent {
+	domains, err := s.db.ListDomains(ctx)
+	if err != nil || len(domains) == 0 {
+		s.log.WarnContext(ctx, "readiness: load domains failed", "err", err)
+		return readyComponent{Status: "fail", Detail: "unknown"}
+	}
+	var locked, degraded int
+	details := make([]string, 0, len(domains))
+	for _, d := range domains {
+		detail := d.Status
+		if d.StatusReason.Valid {
+			detail += ": " + d.StatusReason.String
+		}
+		details = append(details, domainDetail(domains, d, detail))
+		switch d.Status {
+		case "OK":
+		case "LOCKED":
+			locked++
+		default:
+			// DEGRADED still serves resolves; the watchdog just could not
+			// confirm the well-known document.
+			degraded++
+		}
+	}
+	return readyComponent{Status: readyStatus(len(domains), locked, degraded), Detail: strings.Join(details, "; ")}
+}
+
+func (s *PublicService) checkSigningKey(ctx context.Context) readyComponent {
+	domains, err := s.db.ListDomains(ctx)
+	if err != nil || len(domains) == 0 {
+		s.log.WarnContext(ctx, "readiness: load domains failed", "err", err)
+		return readyComponent{Status: "fail", Detail: "not loaded"}
+	}
+	var failed int
+	details := make([]string, 0, len(domains))
+	for _, d := range domains {
+		key, err := s.activeSigningKey(ctx, d.Domain)
+		if err != nil {
+			s.log.WarnContext(ctx, "readiness: load signing key failed", "domain", d.Domain, "err", err)
+			failed++
+			details = append(details, domainDetail(domains, d, "not loaded"))
+			continue
+		}
+		details = append(details, domainDetail(domains, d, key.kid))
+	}
+	return readyComponent{Status: readyStatus(len(domains), failed, 0), Detail: strings.Join(details, "; ")}
+}
+
+// domainDetail prefixes detail with the domain's name when the instance
+// serves more than one.
+func domainDetail(domains []db.Domain, d db.Domain, detail string) string {
+	if len(domains) == 1 {
+		return detail
+	}
+	return d.Domain + " " + detail
+}
+
+// readyStatus rates a per-domain component: it fails only when all of total
+// domains failed.
+func readyStatus(total, failed, degraded int) string {
+	switch {
+	case failed == total:
+		return "fail"
+	case failed > 0 || degraded > 0:
+		return "degraded"
+	}
+	return "ok"
+}
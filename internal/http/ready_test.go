@@ -0,0 +1,151 @@
+package httpx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func (e *testEnv) ready(t *testing.T) (int, readyResponse) {
+	t.Helper()
+	resp, body := e.get(t, "/readyz")
+	var out readyResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return resp.StatusCode, out
+}
+
+func wantComponent(t *testing.T, out readyResponse, name, status string) {
+	t.Helper()
+	if got := out.Components[name].Status; got != status {
+		t.Errorf("%s status = %q, want %q (%+v)", name, got, status, out.Components)
+	}
+}
+
+func TestReadyzAllHealthy(t *testing.T) {
+	env := newTestEnv(t, true)
+
+	code, out := env.ready(t)
+	if code != http.StatusOK || out.Status != "ready" {
+		t.Fatalf("got %d %q, want 200 ready (%+v)", code, out.Status, out.Components)
+	}
+	wantComponent(t, out, "database", "ok")
+	wantComponent(t, out, "wallet_rpc", "ok")
+	wantComponent(t, out, "identity", "ok")
+	wantComponent(t, out, "signing_key", "ok")
+	if got := out.Components["wallet_rpc"].Detail; got != "version 1.26" {
+		t.Errorf("wallet_rpc detail = %q", got)
+	}
+	if got := out.Components["signing_key"].Detail; got != "k1" {
+		t.Errorf("signing_key detail = %q", got)
+	}
+}
+
+func TestReadyzWalletRPCDown(t *testing.T) {
+	env := newTestEnv(t, true)
+	env.wallet.down.Store(true)
+
+	code, out := env.ready(t)
+	if code != http.StatusServiceUnavailable || out.Status != "not_ready" {
+		t.Fatalf("got %d %q, want 503 not_ready", code, out.Status)
+	}
+	wantComponent(t, out, "wallet_rpc", "fail")
+	wantComponent(t, out, "database", "ok")
+}
+
+func TestReadyzWalletRPCNotConfigured(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	code, out := env.ready(t)
+	if code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+	wantComponent(t, out, "wallet_rpc", "disabled")
+}
+
+func TestReadyzInstanceStatus(t *testing.T) {
+	env := newTestEnv(t, true)
+	ctx := context.Background()
+
+	reason := sql.NullString{String: "well_known_unreachable", Valid: true}
+	if _, err := env.db.UpdateDomainStatus(ctx, "example.com", "DEGRADED", reason, sql.NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+	code, out := env.ready(t)
+	if code != http.StatusOK {
+		t.Fatalf("DEGRADED: got %d, want 200", code)
+	}
+	wantComponent(t, out, "identity", "degraded")
+
+	reason = sql.NullString{String: "identity_mismatch", Valid: true}
+	if _, err := env.db.UpdateDomainStatus(ctx, "example.com", "LOCKED", reason, sql.NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+	code, out = env.ready(t)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("LOCKED: got %d, want 503", code)
+	}
+	wantComponent(t, out, "identity", "fail")
+	if got := out.Components["identity"].Detail; got != "LOCKED: identity_mismatch" {
+		t.Errorf("identity detail = %q", got)
+	}
+}
+
+func TestReadyzOneDomainLocked(t *testing.T) {
+	env := newTestEnv(t, true)
+	env.addDomain(t, "example.org", "https://monalias.example.org", "k2")
+	ctx := context.Background()
+
+	reason := sql.NullString{String: "identity_mismatch", Valid: true}
+	if _, err := env.db.UpdateDomainStatus(ctx, "example.org", "LOCKED", reason, sql.NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+	code, out := env.ready(t)
+	if code != http.StatusOK || out.Status != "ready" {
+		t.Fatalf("got %d %q, want 200 ready (%+v)", code, out.Status, out.Components)
+	}
+	wantComponent(t, out, "identity", "degraded")
+	if got := out.Components["identity"].Detail; got != "example.com OK; example.org LOCKED: identity_mismatch" {
+		t.Errorf("identity detail = %q", got)
+	}
+	if got := out.Components["signing_key"].Detail; got != "example.com k1; example.org k2" {
+		t.Errorf("signing_key detail = %q", got)
+	}
+
+	if _, err := env.db.UpdateDomainStatus(ctx, "example.com", "LOCKED", reason, sql.NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := env.ready(t); code != http.StatusServiceUnavailable {
+		t.Fatalf("all LOCKED: got %d, want 503", code)
+	}
+}
+
+func TestReadyzDatabaseClosed(t *testing.T) {
+	env := newTestEnv(t, true)
+	env.db.Close()
+
+	code, out := env.ready(t)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503", code)
+	}
+	wantComponent(t, out, "database", "fail")
+	wantComponent(t, out, "signing_key", "fail")
+	wantComponent(t, out, "wallet_rpc", "ok")
+}
+
+func TestHealthzIsLivenessOnly(t *testing.T) {
+	env := newTestEnv(t, true)
+	env.wallet.down.Store(true)
+	env.db.Close()
+
+	resp, body := env.get(t, "/healthz")
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("got %d %q, want 200 ok", resp.StatusCode, body)
+	}
+	if n := env.wallet.calls.Load(); n != 0 {
+		t.Errorf("healthz called wallet-rpc %d times", n)
+	}
+}
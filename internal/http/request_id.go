@@ -0,0 +1,38 @@
+package httpx
+
+import (
+	"net/http"
+
+	"github.com/kaigoh/monalias/internal/logging"
+)
+
+const headerRequestID = "X-Request-Id"
+
+// requestID tags every request with an ID, stored in the context for logging
+// and echoed in the X-Request-Id response header. A well-formed ID supplied
+// by the caller (or a proxy in front of us) is kept; anything else is
+// replaced with a fresh one.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerRequestID)
+		if !validRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(headerRequestID, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kaigoh/monalias/internal/logging"
+)
+
+var generatedRequestID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func TestRequestIDHeader(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	tests := []struct {
+		name string
+		sent string
+		keep bool
+	}{
+		{"missing", "", false},
+		{"well-formed", "req-42_a.B", true},
+		{"longest", strings.Repeat("a", 64), true},
+		{"oversized", strings.Repeat("a", 65), false},
+		{"space", "req 42", false},
+		{"header injection", "req-42\"}", false},
+		{"non-ascii", "réq-42", false},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, env.srv.URL+"/healthz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.sent != "" {
+			req.Header.Set(headerRequestID, tt.sent)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		got := resp.Header.Get(headerRequestID)
+		if tt.keep {
+			if got != tt.sent {
+				t.Errorf("%s: X-Request-Id = %q; want %q echoed", tt.name, got, tt.sent)
+			}
+			continue
+		}
+		if !generatedRequestID.MatchString(got) {
+			t.Errorf("%s: X-Request-Id = %q; want a generated ID", tt.name, got)
+		}
+	}
+
+	// Each request without a usable ID gets its own.
+	first, _ := env.get(t, "/healthz")
+	second, _ := env.get(t, "/healthz")
+	if a, b := first.Header.Get(headerRequestID), second.Header.Get(headerRequestID); a == b {
+		t.Errorf("two requests were both given %q", a)
+	}
+}
+
+func TestRequestIDReachesLogs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, logging.FormatJSON, slog.LevelInfo, nil)
+	h := requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "handled")
+	}))
+
+	for _, sent := range []string{"req-42", "bad id"} {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(headerRequestID, sent)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var line map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatalf("decode %s: %v", buf.Bytes(), err)
+		}
+		want := rec.Header().Get(headerRequestID)
+		if line["request_id"] != want {
+			t.Errorf("sent %q: logged request_id %v; want %q", sent, line["request_id"], want)
+		}
+		if sent == "bad id" && strings.Contains(buf.String(), sent) {
+			t.Errorf("rejected ID reached the log: %s", buf.Bytes())
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package httpx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+// TestConcurrentDynamicResolves fires parallel resolves at one dynamic
+// alias. Each must get its own subaddress, and the stored index must end
+// up past the last one the wallet handed out. Run it with -race.
+func TestConcurrentDynamicResolves(t *testing.T) {
+	env := newTestEnv(t, true)
+	env.wallet.distinct.Store(true)
+	ctx := context.Background()
+	bob, err := env.db.CreateAccount(ctx, "bob$example.com", sql.NullString{String: "bob", Valid: true}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias, err := env.db.CreateAlias(ctx, bob.ID, "bob+coffee$example.com", "coffee", "DYNAMIC_SUBADDRESS", sql.NullString{}, sql.NullInt64{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := len(stubSubaddresses)
+	addrs := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs[i], errs[i] = postResolve(env.srv.URL, "bob+coffee$example.com", "mainnet")
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("resolve %d: %v", i, err)
+		}
+		if seen[addrs[i]] {
+			t.Errorf("subaddress %s handed out twice", addrs[i])
+		}
+		seen[addrs[i]] = true
+	}
+	for idx := 1; idx <= n; idx++ {
+		if !seen[stubSubaddress(idx)] {
+			t.Errorf("subaddress %d was not handed out", idx)
+		}
+	}
+
+	// wallet-rpc allocates from index 1, so after n resolves the last
+	// issued index is n and the next one to expect is n+1.
+	got, err := env.db.GetAliasByFullAcct(ctx, alias.FullAcct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.NextSubaddrIdx.Valid || got.NextSubaddrIdx.Int64 != int64(n+1) {
+		t.Errorf("next_subaddr_idx = %+v; want %d", got.NextSubaddrIdx, n+1)
+	}
+	if got.StaticAddress.String != stubSubaddress(n) {
+		t.Errorf("stored address = %s; want the last one issued, %s", got.StaticAddress.String, stubSubaddress(n))
+	}
+}
+
+// postResolve resolves acct on network and returns the address served. It
+// does not touch t, so goroutines can call it.
+func postResolve(base, acct, network string) (string, error) {
+	body := `{"acct":"` + acct + `","network":"` + network + `"}`
+	resp, err := http.Post(base+"/_monalias/resolve", "application/json", strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || out.Address == "" {
+		return "", fmt.Errorf("got %d with address %q", resp.StatusCode, out.Address)
+	}
+	return out.Address, nil
+}
+
+func TestDisabledAliasIsNotFound(t *testing.T) {
+	env := newStaticEnv(t)
+	ctx := context.Background()
+	alias, err := env.db.GetAliasByFullAcct(ctx, "bob+tips$example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.db.SetAliasEnabled(ctx, alias.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := env.resolveAcct(t, "bob+tips$example.com", "mainnet")
+	if resp.StatusCode != http.StatusNotFound || body["error"] != "alias_not_found" {
+		t.Errorf("disabled: got %d %v", resp.StatusCode, body)
+	}
+
+	if _, err := env.db.SetAliasEnabled(ctx, alias.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	resp, body = env.resolveAcct(t, "bob+tips$example.com", "mainnet")
+	if resp.StatusCode != http.StatusOK || body["address"] != testAddress {
+		t.Errorf("re-enabled: got %d %v", resp.StatusCode, body)
+	}
+}
+
+// TestNetworkNotSupported separates an alias that exists only on the other
+// network from one that does not exist. Only the first answer is signed.
+func TestNetworkNotSupported(t *testing.T) {
+	env := newTestEnv(t, true)
+	pub := env.addDomain(t, "example.org", "https://monalias.example.org", "org1")
+	ctx := context.Background()
+	bob, err := env.db.CreateAccount(ctx, "bob$example.org", sql.NullString{String: "bob", Valid: true}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.CreateAlias(ctx, bob.ID, "bob$example.org", "default", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.CreateAlias(ctx, bob.ID, "bob+coffee$example.org", "coffee", "DYNAMIC_SUBADDRESS", sql.NullString{}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		acct, network string
+		code          string
+		signed        bool
+	}{
+		{"bob$example.org", "stagenet", "network_not_supported", true},
+		{"bob+coffee$example.org", "stagenet", "network_not_supported", true},
+		{"bob+nope$example.org", "stagenet", "alias_not_found", false},
+		{"bob+nope$example.org", "mainnet", "alias_not_found", false},
+	}
+	for _, tt := range tests {
+		resp, body := env.resolveAcct(t, tt.acct, tt.network)
+		if resp.StatusCode != http.StatusNotFound || body["error"] != tt.code {
+			t.Errorf("%s on %s: got %d %v; want 404 %s", tt.acct, tt.network, resp.StatusCode, body, tt.code)
+			continue
+		}
+		sig := resp.Header.Get(protocol.HeaderSignature)
+		if !tt.signed {
+			if sig != "" {
+				t.Errorf("%s on %s: %s is signed", tt.acct, tt.network, tt.code)
+			}
+			continue
+		}
+		canonical := protocol.ErrorCanonical(tt.acct, tt.network, tt.code, "org1")
+		if !protocol.Verify(pub, canonical, sig) {
+			t.Errorf("%s on %s: %s is not signed", tt.acct, tt.network, tt.code)
+		}
+	}
+	if labels := env.wallet.createdLabels(); len(labels) != 0 {
+		t.Errorf("wallet created addresses %v for an unsupported network", labels)
+	}
+
+	if resp, body := env.resolveAcct(t, "bob$example.org", "mainnet"); resp.StatusCode != http.StatusOK || body["address"] != testAddress {
+		t.Errorf("mainnet: got %d %v", resp.StatusCode, body)
+	}
+}
+
+// TestResolveTTL checks that expires_at and Cache-Control both follow the
+// instance TTL, or the alias's own TTL when it has one.
+func TestResolveTTL(t *testing.T) {
+	env := newStaticEnv(t)
+	ctx := context.Background()
+	alias, err := env.db.GetAliasByFullAcct(ctx, "bob+tips$example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ttl          sql.NullInt64
+		want         time.Duration
+		cacheControl string
+	}{
+		{sql.NullInt64{}, 5 * time.Minute, "private, max-age=300"},
+		{sql.NullInt64{Int64: 60, Valid: true}, time.Minute, "private, max-age=60"},
+		{sql.NullInt64{Int64: 0, Valid: true}, 0, "no-store"},
+	}
+	for _, tt := range tests {
+		if _, err := env.db.UpdateAliasTTL(ctx, alias.ID, tt.ttl); err != nil {
+			t.Fatal(err)
+		}
+		before := time.Now().Truncate(time.Second)
+		resp, body := env.resolveAcct(t, "bob+tips$example.com", "mainnet")
+		after := time.Now()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("ttl %v: got %d %v", tt.ttl, resp.StatusCode, body)
+		}
+		raw, _ := body["expires_at"].(string)
+		expires, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			t.Fatalf("ttl %v: expires_at %q: %v", tt.ttl, raw, err)
+		}
+		if expires.Before(before.Add(tt.want)) || expires.After(after.Add(tt.want)) {
+			t.Errorf("ttl %v: expires_at %s is not %v after the resolve", tt.ttl, raw, tt.want)
+		}
+		if cc := resp.Header.Get("Cache-Control"); cc != tt.cacheControl {
+			t.Errorf("ttl %v: Cache-Control = %q; want %q", tt.ttl, cc, tt.cacheControl)
+		}
+	}
+}
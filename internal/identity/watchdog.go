@@ -6,23 +6,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/kaigoh/monalias/internal/config"
 	"github.com/kaigoh/monalias/internal/db"
 )
 
 type Watchdog struct {
-	cfg    config.Config
 	db     *db.DB
 	client *http.Client
+	log    *slog.Logger
 }
 
-func New(cfg config.Config, database *db.DB) *Watchdog {
+func New(database *db.DB, logger *slog.Logger) *Watchdog {
 	return &Watchdog{
-		cfg: cfg,
 		db:  database,
+		log: logger,
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
@@ -38,11 +38,33 @@ func (w *Watchdog) Run(ctx context.Context, interval time.Duration) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			_, _ = w.CheckOnce(ctx)
+			w.runCheck(ctx)
 		}
 	}
 }
 
+// runCheck checks every domain in turn. A domain that fails its check is
+// marked on its own; the others keep their status.
+func (w *Watchdog) runCheck(ctx context.Context) {
+	domains, err := w.db.ListDomains(ctx)
+	if err != nil {
+		w.log.ErrorContext(ctx, "identity check failed", "err", err)
+		return
+	}
+	for _, domain := range domains {
+		current, err := w.CheckOnce(ctx, domain)
+		if err != nil {
+			w.log.ErrorContext(ctx, "identity check failed", "domain", domain.Domain, "err", err)
+			continue
+		}
+		if current.Status != "OK" {
+			w.log.WarnContext(ctx, "identity check", "domain", current.Domain, "status", current.Status, "reason", current.StatusReason.String)
+			continue
+		}
+		w.log.DebugContext(ctx, "identity check", "domain", current.Domain, "status", current.Status)
+	}
+}
+
 type wellKnown struct {
 	Homeserver string `json:"homeserver"`
 	Version    string `json:"version"`
@@ -54,42 +76,57 @@ type wellKnown struct {
 	} `json:"keys"`
 }
 
-func (w *Watchdog) CheckOnce(ctx context.Context) (db.InstanceConfig, error) {
-	cfg, err := w.db.GetInstanceConfig(ctx)
+// CheckOnce evaluates domain and stores the resulting status.
+func (w *Watchdog) CheckOnce(ctx context.Context, domain db.Domain) (db.Domain, error) {
+	status, reason, err := w.Evaluate(ctx, domain)
 	if err != nil {
-		return cfg, err
+		return db.Domain{}, err
 	}
+	return w.markStatus(ctx, domain.Domain, status, reason)
+}
 
-	wellKnownURL := fmt.Sprintf("https://%s/.well-known/monalias", w.cfg.Domain)
+// Evaluate fetches the domain's well-known document and returns the domain
+// status it implies, without persisting anything.
+func (w *Watchdog) Evaluate(ctx context.Context, domain db.Domain) (string, sql.NullString, error) {
+	wellKnownURL := fmt.Sprintf("https://%s/.well-known/monalias", domain.Domain)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnownURL, nil)
 	if err != nil {
-		return cfg, err
+		return "", sql.NullString{}, err
 	}
 
 	resp, err := w.client.Do(req)
 	if err != nil {
-		return w.markStatus(ctx, "DEGRADED", sql.NullString{String: "well_known_unreachable", Valid: true})
+		w.log.WarnContext(ctx, "well-known fetch failed", "url", wellKnownURL, "err", err)
+		return "DEGRADED", sql.NullString{String: "well_known_unreachable", Valid: true}, nil
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return w.markStatus(ctx, "DEGRADED", sql.NullString{String: "well_known_unreachable", Valid: true})
+		w.log.WarnContext(ctx, "well-known fetch failed", "url", wellKnownURL, "status", resp.StatusCode)
+		return "DEGRADED", sql.NullString{String: "well_known_unreachable", Valid: true}, nil
 	}
 
 	var wk wellKnown
 	if err := json.NewDecoder(resp.Body).Decode(&wk); err != nil {
-		return w.markStatus(ctx, "DEGRADED", sql.NullString{String: "well_known_unreachable", Valid: true})
+		w.log.WarnContext(ctx, "well-known document invalid", "url", wellKnownURL, "err", err)
+		return "DEGRADED", sql.NullString{String: "well_known_unreachable", Valid: true}, nil
 	}
 
-	if wk.Homeserver != w.cfg.PublicBaseURL {
-		return w.markStatus(ctx, "LOCKED", sql.NullString{String: "identity_mismatch", Valid: true})
+	if wk.Homeserver != domain.Homeserver {
+		w.log.WarnContext(ctx, "well-known homeserver mismatch", "domain", domain.Domain, "published", wk.Homeserver, "expected", domain.Homeserver)
+		return "LOCKED", sql.NullString{String: "identity_mismatch", Valid: true}, nil
 	}
 
-	if !keyMatches(wk.Keys, cfg.SigningKeyID, cfg.SigningPubkey) {
-		return w.markStatus(ctx, "LOCKED", sql.NullString{String: "identity_mismatch", Valid: true})
+	active, err := w.db.GetActiveSigningKey(ctx, domain.Domain)
+	if err != nil {
+		return "", sql.NullString{}, err
+	}
+	if !keyMatches(wk.Keys, active.KID, active.PublicKey) {
+		w.log.WarnContext(ctx, "well-known does not publish the active signing key", "domain", domain.Domain, "kid", active.KID)
+		return "LOCKED", sql.NullString{String: "identity_mismatch", Valid: true}, nil
 	}
 
-	return w.markStatus(ctx, "OK", sql.NullString{Valid: false})
+	return "OK", sql.NullString{Valid: false}, nil
 }
 
 func keyMatches(keys []struct {
@@ -106,17 +143,15 @@ func keyMatches(keys []struct {
 	return false
 }
 
-func (w *Watchdog) markStatus(ctx context.Context, status string, reason sql.NullString) (db.InstanceConfig, error) {
-	cfg, err := w.db.UpdateInstanceStatus(ctx, status, reason, sql.NullTime{Time: time.Now().UTC(), Valid: true})
-	if err != nil {
-		return cfg, err
-	}
-	return cfg, nil
+func (w *Watchdog) markStatus(ctx context.Context, domain, status string, reason sql.NullString) (db.Domain, error) {
+	return w.db.UpdateDomainStatus(ctx, domain, status, reason, sql.NullTime{Time: time.Now().UTC(), Valid: true})
 }
 
-func ValidateConfig(cfg db.InstanceConfig) error {
-	if cfg.Domain == "" || cfg.Homeserver == "" || cfg.SigningKeyID == "" || cfg.SigningPubkey == "" {
-		return errors.New("instance config incomplete")
+// ValidateDomain reports whether the domain has everything needed to serve
+// resolves.
+func ValidateDomain(d db.Domain) error {
+	if d.Domain == "" || d.Homeserver == "" || !d.SigningKeyID.Valid {
+		return errors.New("domain config incomplete")
 	}
 	return nil
 }
@@ -0,0 +1,132 @@
+// Package logging builds the service's slog logger and carries per-request
+// IDs through contexts so every log line for a request can be correlated.
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseFormat validates a MONALIAS_LOG_FORMAT value.
+func ParseFormat(s string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(s)); f {
+	case FormatText, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q (want text or json)", s)
+	}
+}
+
+// ParseLevel validates a MONALIAS_LOG_LEVEL value (debug, info, warn, error).
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// New returns a logger writing to w in the given format. Records logged with
+// a context carrying a request ID get a request_id attribute. Acct
+// attributes are written as their HMAC under acctKey; without a key, a
+// random one is used, so digests only match within one run.
+func New(w io.Writer, format string, level slog.Level, acctKey []byte) *slog.Logger {
+	if len(acctKey) == 0 {
+		acctKey = make([]byte, 32)
+		_, _ = rand.Read(acctKey)
+	}
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() != slog.KindAny {
+				return a
+			}
+			if acct, ok := a.Value.Any().(acctName); ok {
+				a.Value = slog.StringValue(acctDigest(acctKey, string(acct)))
+			}
+			return a
+		},
+	}
+	var h slog.Handler
+	if format == FormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random 128-bit hex request ID.
+func NewRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Acct returns an acct_hash attribute so log lines for the same Monalias ID
+// can be correlated without writing the ID itself to the logs. The logger
+// from New writes it as a keyed digest.
+func Acct(acct string) slog.Attr {
+	return slog.Any("acct_hash", acctName(strings.ToLower(acct)))
+}
+
+// acctName is the lowercased Monalias ID of an Acct attribute. Handlers
+// other than New's, which know no key, write it as "redacted".
+type acctName string
+
+func (acctName) MarshalText() ([]byte, error) {
+	return []byte("redacted"), nil
+}
+
+// acctDigest is the first 16 hex characters of the HMAC-SHA256 of acct
+// under key. Unlike a plain hash, it cannot be reversed by hashing a list of
+// likely IDs without the key.
+func acctDigest(key []byte, acct string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(acct))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// loggedAcctHash logs acct through a JSON logger keyed with key and returns
+// the acct_hash it wrote.
+func loggedAcctHash(t *testing.T, key []byte, acct string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	New(&buf, FormatJSON, slog.LevelInfo, key).Info("resolve", Acct(acct))
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decode %s: %v", buf.Bytes(), err)
+	}
+	if strings.Contains(buf.String(), "alice") {
+		t.Errorf("log line holds the acct: %s", buf.Bytes())
+	}
+	hash, _ := line["acct_hash"].(string)
+	return hash
+}
+
+func TestAcctDigest(t *testing.T) {
+	key1 := []byte("0123456789abcdef")
+	key2 := []byte("fedcba9876543210")
+
+	hash := loggedAcctHash(t, key1, "alice$example.com")
+	if len(hash) != 16 {
+		t.Fatalf("acct_hash = %q; want 16 hex characters", hash)
+	}
+	if again := loggedAcctHash(t, key1, "Alice$Example.com"); again != hash {
+		t.Errorf("same acct, same key: %s != %s", again, hash)
+	}
+	if other := loggedAcctHash(t, key2, "alice$example.com"); other == hash {
+		t.Errorf("same acct under different keys gave the same digest %s", hash)
+	}
+	if other := loggedAcctHash(t, key1, "bob$example.com"); other == hash {
+		t.Errorf("different accts gave the same digest %s", hash)
+	}
+
+	// A handler that does not know the key does not write the acct.
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("resolve", Acct("alice$example.com"))
+	if !strings.Contains(buf.String(), "acct_hash=redacted") {
+		t.Errorf("plain handler wrote %s", buf.Bytes())
+	}
+}
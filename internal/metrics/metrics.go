@@ -0,0 +1,181 @@
+// Package metrics holds the Prometheus collectors exported on the admin
+// listener's /metrics endpoint.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Resolve outcomes.
+const (
+	OutcomeNormal = "normal"
+	// OutcomeCatchAll is an unknown alias answered with a catch-all
+	// address; OutcomeDefaultAlias and OutcomeProvisioned are ones answered
+	// by the account's default alias or by an alias created for them.
+	OutcomeCatchAll     = "catch_all"
+	OutcomeDefaultAlias = "default_alias"
+	OutcomeProvisioned  = "provisioned"
+	OutcomeNotFound     = "not_found"
+	// OutcomeNetworkUnsupported is an answer that exists only for the other
+	// network.
+	OutcomeNetworkUnsupported = "network_unsupported"
+	OutcomeLocked             = "locked"
+	OutcomeRateLimited        = "rate_limited"
+	// OutcomeAliasRateLimited is a resolve refused by the alias's own limit.
+	OutcomeAliasRateLimited = "alias_rate_limited"
+	OutcomeBadRequest       = "bad_request"
+	OutcomeError            = "error"
+)
+
+// Registry is what /metrics serves. It is separate from the default
+// registry so only collectors registered here are exposed.
+var Registry = prometheus.NewRegistry()
+
+var (
+	resolveRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "monalias",
+		Name:      "resolve_requests_total",
+		Help:      "Resolve requests by outcome and network.",
+	}, []string{"outcome", "network"})
+
+	resolveDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "monalias",
+		Name:      "resolve_duration_seconds",
+		Help:      "Time spent handling resolve requests, by outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"outcome"})
+
+	walletRPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "monalias",
+		Name:      "wallet_rpc_duration_seconds",
+		Help:      "monero-wallet-rpc call latency by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	walletRPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "monalias",
+		Name:      "wallet_rpc_errors_total",
+		Help:      "Failed monero-wallet-rpc calls by method.",
+	}, []string{"method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		resolveRequests,
+		resolveDuration,
+		walletRPCDuration,
+		walletRPCErrors,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveResolve records one resolve request. Networks other than mainnet
+// and stagenet are folded into "unknown" to keep label cardinality bounded.
+func ObserveResolve(outcome, network string, elapsed time.Duration) {
+	switch network {
+	case "mainnet", "stagenet":
+	default:
+		network = "unknown"
+	}
+	resolveRequests.WithLabelValues(outcome, network).Inc()
+	if outcome != OutcomeRateLimited {
+		resolveDuration.WithLabelValues(outcome).Observe(elapsed.Seconds())
+	}
+}
+
+// ObserveWalletRPC records one wallet-rpc call.
+func ObserveWalletRPC(method string, elapsed time.Duration, err error) {
+	walletRPCDuration.WithLabelValues(method).Observe(elapsed.Seconds())
+	if err != nil {
+		walletRPCErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// DomainStatus is the stored status of one served domain and when the
+// identity watchdog last checked it.
+type DomainStatus struct {
+	Domain    string
+	Status    string
+	LastCheck time.Time
+}
+
+// InstanceStatus reports the status of every served domain.
+type InstanceStatus func(ctx context.Context) ([]DomainStatus, error)
+
+// RegisterInstanceStatus exports the watchdog's view of each domain, read at
+// scrape time: one monalias_instance_status series per domain and status with
+// the current one set to 1, and the age of the domain's last identity check.
+func RegisterInstanceStatus(fn InstanceStatus) {
+	Registry.MustRegister(&instanceCollector{fetch: fn})
+}
+
+// RegisterRateLimiter exports the number of clients the IP rate limiter is
+// tracking.
+func RegisterRateLimiter(size func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "monalias",
+		Name:      "rate_limiter_clients",
+		Help:      "Clients currently tracked by the IP rate limiter.",
+	}, func() float64 { return float64(size()) }))
+}
+
+// RegisterEnumerationBans exports the number of clients and networks banned
+// for alias enumeration.
+func RegisterEnumerationBans(count func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "monalias",
+		Name:      "enumeration_bans",
+		Help:      "Clients and networks currently banned for alias enumeration.",
+	}, func() float64 { return float64(count()) }))
+}
+
+var (
+	instanceStatusDesc = prometheus.NewDesc("monalias_instance_status",
+		"Current status of each domain; the series for the active status is 1.", []string{"domain", "status"}, nil)
+	identityCheckAgeDesc = prometheus.NewDesc("monalias_identity_check_age_seconds",
+		"Seconds since the identity watchdog last checked the domain's well-known document.", []string{"domain"}, nil)
+)
+
+var instanceStatuses = []string{"OK", "DEGRADED", "LOCKED"}
+
+type instanceCollector struct {
+	fetch InstanceStatus
+}
+
+func (c *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- instanceStatusDesc
+	ch <- identityCheckAgeDesc
+}
+
+func (c *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	domains, err := c.fetch(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(instanceStatusDesc, err)
+		return
+	}
+	for _, d := range domains {
+		for _, s := range instanceStatuses {
+			val := 0.0
+			if s == d.Status {
+				val = 1
+			}
+			ch <- prometheus.MustNewConstMetric(instanceStatusDesc, prometheus.GaugeValue, val, d.Domain, s)
+		}
+		if !d.LastCheck.IsZero() {
+			ch <- prometheus.MustNewConstMetric(identityCheckAgeDesc, prometheus.GaugeValue, time.Since(d.LastCheck).Seconds(), d.Domain)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package address decodes Monero addresses natively: base58 decoding,
+// Keccak checksum verification, and network/type detection from the prefix.
+package address
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	Mainnet  = "mainnet"
+	Stagenet = "stagenet"
+	Testnet  = "testnet"
+)
+
+type Type string
+
+const (
+	Standard   Type = "standard"
+	Subaddress Type = "subaddress"
+	Integrated Type = "integrated"
+)
+
+var (
+	ErrInvalid      = errors.New("invalid monero address")
+	ErrChecksum     = errors.New("monero address checksum mismatch")
+	ErrWrongNetwork = errors.New("monero address is for a different network")
+)
+
+const (
+	keySize       = 32
+	paymentIDSize = 8
+	checksumSize  = 4
+)
+
+type prefixInfo struct {
+	network string
+	kind    Type
+}
+
+var prefixes = map[uint64]prefixInfo{
+	18: {Mainnet, Standard},
+	19: {Mainnet, Integrated},
+	42: {Mainnet, Subaddress},
+	24: {Stagenet, Standard},
+	25: {Stagenet, Integrated},
+	36: {Stagenet, Subaddress},
+	53: {Testnet, Standard},
+	54: {Testnet, Integrated},
+	63: {Testnet, Subaddress},
+}
+
+type Address struct {
+	Network        string
+	Type           Type
+	PublicSpendKey [keySize]byte
+	PublicViewKey  [keySize]byte
+	// PaymentID is set for integrated addresses only.
+	PaymentID []byte
+}
+
+// Decode parses a base58 Monero address and verifies its checksum.
+func Decode(s string) (Address, error) {
+	raw, err := decodeBase58(s)
+	if err != nil {
+		return Address{}, ErrInvalid
+	}
+
+	prefix, n := binary.Uvarint(raw)
+	if n <= 0 {
+		return Address{}, ErrInvalid
+	}
+	info, ok := prefixes[prefix]
+	if !ok {
+		return Address{}, ErrInvalid
+	}
+
+	bodySize := 2 * keySize
+	if info.kind == Integrated {
+		bodySize += paymentIDSize
+	}
+	if len(raw) != n+bodySize+checksumSize {
+		return Address{}, ErrInvalid
+	}
+
+	payload := raw[:len(raw)-checksumSize]
+	h := sha3.NewLegacyKeccak256()
+	h.Write(payload)
+	if !bytes.Equal(h.Sum(nil)[:checksumSize], raw[len(raw)-checksumSize:]) {
+		return Address{}, ErrChecksum
+	}
+
+	addr := Address{Network: info.network, Type: info.kind}
+	body := raw[n:]
+	copy(addr.PublicSpendKey[:], body[:keySize])
+	copy(addr.PublicViewKey[:], body[keySize:2*keySize])
+	if info.kind == Integrated {
+		addr.PaymentID = append([]byte(nil), body[2*keySize:2*keySize+paymentIDSize]...)
+	}
+	return addr, nil
+}
+
+// Validate decodes s and checks that it belongs to network.
+func Validate(s, network string) (Address, error) {
+	addr, err := Decode(s)
+	if err != nil {
+		return addr, err
+	}
+	if addr.Network != network {
+		return addr, fmt.Errorf("%w: %s address used for %s", ErrWrongNetwork, addr.Network, network)
+	}
+	return addr, nil
+}
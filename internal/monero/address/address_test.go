@@ -0,0 +1,166 @@
+package address
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Real addresses, as Monero wallets produce them.
+const (
+	mainnetStandard   = "44AFFq5kSiGBoZ4NMDwYtN18obc8AemS33DBLWs3H7otXft3XjrpDtQGv7SqSsaBYBb98uNbr2VBBEt7f2wfn3RVGQBEP3A"
+	mainnetSubaddress = "888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H"
+	mainnetIntegrated = "4GdoN7NCTi8a5gZug7PrwZNKjvHFmKeV11L6pNJPgj5QNEHsN6eeX3DaAQFwZ1ufD4LYCZKArktt113W7QjWvQ7CWDXrwM8yCGgEdhV3Wt"
+	stagenetStandard  = "55LTR8KniP4LQGJSPtbYDacR7dz8RBFnsfAKMaMuwUNYX6aQbBcovzDPyrQF9KXF9tVU6Xk3K8no1BywnJX6GvZX8yJsXvt"
+	stagenetSub       = "7BnERTpvL5MbCLtj5n9No7J5oE5hHiB3tVCK5cjSvCsYWD2WRJLFuWeKTLiXo5QJqt2ZwUaLy2Vh1Ad51K7FNgqcHgjW85o"
+	testnetStandard   = "9wviCeWe2D8XS82k2ovp5EUYLzBt9pYNW2LXUFsZiv8S3Mt21FZ5qQaAroko1enzw3eGr9qC7X1D7Geoo2RrAotYPwq9Gm8"
+)
+
+// encodeBase58 is the inverse of decodeBase58.
+func encodeBase58(data []byte) string {
+	var sb strings.Builder
+	for len(data) > 0 {
+		size := min(len(data), fullBlockSize)
+		var num uint64
+		for _, b := range data[:size] {
+			num = num<<8 | uint64(b)
+		}
+		block := make([]byte, encodedBlockSizes[size])
+		for i := len(block) - 1; i >= 0; i-- {
+			block[i] = alphabet[num%58]
+			num /= 58
+		}
+		sb.Write(block)
+		data = data[size:]
+	}
+	return sb.String()
+}
+
+// encode builds an address from a prefix and body, with a valid checksum.
+func encode(prefix uint64, body []byte) string {
+	raw := binary.AppendUvarint(nil, prefix)
+	raw = append(raw, body...)
+	h := sha3.NewLegacyKeccak256()
+	h.Write(raw)
+	return encodeBase58(h.Sum(raw)[:len(raw)+checksumSize])
+}
+
+// reencode returns the keys, and payment ID, of addr under prefix.
+func reencode(t *testing.T, addr string, prefix uint64, paymentID []byte) string {
+	t.Helper()
+	a, err := Decode(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := append(append(a.PublicSpendKey[:], a.PublicViewKey[:]...), paymentID...)
+	return encode(prefix, body)
+}
+
+func TestEncodeMatchesKnownAddresses(t *testing.T) {
+	for _, addr := range []string{mainnetStandard, mainnetSubaddress, mainnetIntegrated, stagenetStandard, stagenetSub, testnetStandard} {
+		raw, err := decodeBase58(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := encodeBase58(raw); got != addr {
+			t.Errorf("encodeBase58(decodeBase58(%s)) = %s", addr, got)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	paymentID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	// The remaining address types, built from the keys of the real ones.
+	stagenetIntegrated := reencode(t, stagenetStandard, 25, paymentID)
+	testnetSubaddress := reencode(t, testnetStandard, 63, nil)
+	testnetIntegrated := reencode(t, testnetStandard, 54, paymentID)
+
+	// Flip the last character for one that still decodes.
+	badChecksum := mainnetStandard[:len(mainnetStandard)-1] + "B"
+
+	tests := []struct {
+		name    string
+		addr    string
+		network string
+		kind    Type
+		err     error
+	}{
+		{"mainnet standard", mainnetStandard, Mainnet, Standard, nil},
+		{"mainnet subaddress", mainnetSubaddress, Mainnet, Subaddress, nil},
+		{"mainnet integrated", mainnetIntegrated, Mainnet, Integrated, nil},
+		{"stagenet standard", stagenetStandard, Stagenet, Standard, nil},
+		{"stagenet subaddress", stagenetSub, Stagenet, Subaddress, nil},
+		{"stagenet integrated", stagenetIntegrated, Stagenet, Integrated, nil},
+		{"testnet standard", testnetStandard, Testnet, Standard, nil},
+		{"testnet subaddress", testnetSubaddress, Testnet, Subaddress, nil},
+		{"testnet integrated", testnetIntegrated, Testnet, Integrated, nil},
+
+		{"bad checksum", badChecksum, "", "", ErrChecksum},
+		{"standard with a payment ID", reencode(t, mainnetStandard, 18, paymentID), "", "", ErrInvalid},
+		{"integrated without a payment ID", reencode(t, mainnetStandard, 19, nil), "", "", ErrInvalid},
+		{"short body", encode(18, make([]byte, 63)), "", "", ErrInvalid},
+		{"truncated", mainnetStandard[:len(mainnetStandard)-11], "", "", ErrInvalid},
+		{"invalid base58 character", "0" + mainnetStandard[1:], "", "", ErrInvalid},
+		{"unknown prefix", reencode(t, mainnetStandard, 17, nil), "", "", ErrInvalid},
+		{"empty", "", "", "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := Decode(tt.addr)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Decode(%s) err = %v; want %v", tt.addr, err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if a.Network != tt.network || a.Type != tt.kind {
+				t.Errorf("Decode(%s) = %s %s; want %s %s", tt.addr, a.Network, a.Type, tt.network, tt.kind)
+			}
+			if (a.Type == Integrated) != (a.PaymentID != nil) {
+				t.Errorf("%s address has payment ID %x", a.Type, a.PaymentID)
+			}
+		})
+	}
+}
+
+func TestDecodeKeepsKeys(t *testing.T) {
+	std, err := Decode(testnetStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	integrated, err := Decode(reencode(t, testnetStandard, 54, []byte{1, 2, 3, 4, 5, 6, 7, 8}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if integrated.PublicSpendKey != std.PublicSpendKey || integrated.PublicViewKey != std.PublicViewKey {
+		t.Error("integrated address lost the keys it was built from")
+	}
+	if string(integrated.PaymentID) != "\x01\x02\x03\x04\x05\x06\x07\x08" {
+		t.Errorf("payment ID = %x", integrated.PaymentID)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		err     error
+	}{
+		{mainnetStandard, Mainnet, nil},
+		{mainnetSubaddress, Mainnet, nil},
+		{stagenetStandard, Stagenet, nil},
+		{testnetStandard, Testnet, nil},
+		{stagenetStandard, Mainnet, ErrWrongNetwork},
+		{testnetStandard, Stagenet, ErrWrongNetwork},
+		{mainnetIntegrated, Stagenet, ErrWrongNetwork},
+		{"not an address", Mainnet, ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := Validate(tt.addr, tt.network); !errors.Is(err, tt.err) {
+			t.Errorf("Validate(%s, %s) err = %v; want %v", tt.addr, tt.network, err, tt.err)
+		}
+	}
+}
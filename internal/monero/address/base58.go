@@ -0,0 +1,83 @@
+package address
+
+import (
+	"errors"
+	"math/bits"
+	"strings"
+)
+
+// Monero's base58 differs from Bitcoin's: data is split into 8-byte blocks
+// that each encode to exactly 11 characters, with a shorter final block.
+
+const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+const (
+	fullBlockSize        = 8
+	fullEncodedBlockSize = 11
+)
+
+// encodedBlockSizes[n] is the encoded length of an n-byte block.
+var encodedBlockSizes = []int{0, 2, 3, 5, 6, 7, 9, 10, 11}
+
+var errInvalidBase58 = errors.New("invalid base58")
+
+func decodeBase58(s string) ([]byte, error) {
+	fullBlocks := len(s) / fullEncodedBlockSize
+	lastEncoded := len(s) % fullEncodedBlockSize
+	lastSize := -1
+	for size, encoded := range encodedBlockSizes {
+		if encoded == lastEncoded {
+			lastSize = size
+			break
+		}
+	}
+	if lastSize < 0 {
+		return nil, errInvalidBase58
+	}
+
+	out := make([]byte, 0, fullBlocks*fullBlockSize+lastSize)
+	for i := 0; i < fullBlocks; i++ {
+		block, err := decodeBlock(s[i*fullEncodedBlockSize:(i+1)*fullEncodedBlockSize], fullBlockSize)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+	}
+	if lastEncoded > 0 {
+		block, err := decodeBlock(s[fullBlocks*fullEncodedBlockSize:], lastSize)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+	}
+	return out, nil
+}
+
+func decodeBlock(s string, size int) ([]byte, error) {
+	var num uint64
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(alphabet, s[i])
+		if digit < 0 {
+			return nil, errInvalidBase58
+		}
+		hi, lo := bits.Mul64(num, 58)
+		if hi != 0 {
+			return nil, errInvalidBase58
+		}
+		var carry uint64
+		num, carry = bits.Add64(lo, uint64(digit), 0)
+		if carry != 0 {
+			return nil, errInvalidBase58
+		}
+	}
+	if size < fullBlockSize && num>>(8*size) != 0 {
+		return nil, errInvalidBase58
+	}
+
+	out := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		out[i] = byte(num)
+		num >>= 8
+	}
+	return out, nil
+}
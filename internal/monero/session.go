@@ -0,0 +1,86 @@
+package monero
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// WalletSessions owns the wallet that monero-wallet-rpc currently has open.
+// The RPC server only holds one wallet at a time, so every operation runs
+// under a single lock: open the requested wallet (skipped when it is already
+// open), run the calls, release.
+type WalletSessions struct {
+	rpc     *WalletRPC
+	mu      sync.Mutex
+	current string
+}
+
+func NewWalletSessions(rpc *WalletRPC) *WalletSessions {
+	return &WalletSessions{rpc: rpc}
+}
+
+func (s *WalletSessions) Enabled() bool {
+	return s != nil && s.rpc.Enabled()
+}
+
+// With runs fn with the named wallet open. No other session operation can
+// switch wallets until fn returns.
+func (s *WalletSessions) With(ctx context.Context, wallet string, fn func(rpc *WalletRPC) error) error {
+	if !s.Enabled() {
+		return errors.New("wallet rpc not configured")
+	}
+	if wallet == "" {
+		return errors.New("wallet name missing")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current != wallet {
+		s.current = ""
+		if err := s.rpc.OpenWallet(ctx, wallet); err != nil {
+			return err
+		}
+		s.current = wallet
+	}
+
+	if err := fn(s.rpc); err != nil {
+		// The RPC server may have dropped the wallet; reopen next time.
+		s.current = ""
+		return err
+	}
+	return nil
+}
+
+// CreateAddress allocates a new subaddress in the named wallet.
+func (s *WalletSessions) CreateAddress(ctx context.Context, wallet, label string) (string, int64, error) {
+	var addr string
+	var idx int64
+	err := s.With(ctx, wallet, func(rpc *WalletRPC) error {
+		var err error
+		addr, idx, err = rpc.CreateAddress(ctx, label)
+		return err
+	})
+	return addr, idx, err
+}
+
+// GetAddress looks up the subaddress at index in the named wallet.
+func (s *WalletSessions) GetAddress(ctx context.Context, wallet string, index int64) (string, error) {
+	var addr string
+	err := s.With(ctx, wallet, func(rpc *WalletRPC) error {
+		var err error
+		addr, err = rpc.GetAddress(ctx, index)
+		return err
+	})
+	return addr, err
+}
+
+// Version asks monero-wallet-rpc for its RPC version. It needs no open
+// wallet, so it runs without taking the session lock.
+func (s *WalletSessions) Version(ctx context.Context) (uint64, error) {
+	if !s.Enabled() {
+		return 0, errors.New("wallet rpc not configured")
+	}
+	return s.rpc.GetVersion(ctx)
+}
@@ -0,0 +1,140 @@
+package monero
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWalletRPC mimics monero-wallet-rpc closely enough for session tests:
+// one open wallet at a time, and create_address answers from whichever
+// wallet is currently open.
+type fakeWalletRPC struct {
+	mu      sync.Mutex
+	current string
+	opens   int
+	next    map[string]uint64
+}
+
+func (f *fakeWalletRPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     uint64          `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "open_wallet":
+		var params struct {
+			Filename string `json:"filename"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		f.mu.Lock()
+		f.current = params.Filename
+		f.opens++
+		f.mu.Unlock()
+		result = map[string]interface{}{}
+	case "create_address":
+		// Widen the window between reading the open wallet and answering,
+		// so an unserialized caller would observe another account's wallet.
+		f.mu.Lock()
+		wallet := f.current
+		f.mu.Unlock()
+		time.Sleep(time.Millisecond)
+		f.mu.Lock()
+		idx := f.next[wallet]
+		f.next[wallet] = idx + 1
+		f.mu.Unlock()
+		result = map[string]interface{}{
+			"address":       fmt.Sprintf("%s/%d", wallet, idx),
+			"address_index": idx,
+		}
+	default:
+		http.Error(w, "unknown method", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.ID,
+		"result":  result,
+	})
+}
+
+func newFakeSessions(t *testing.T) (*WalletSessions, *fakeWalletRPC) {
+	t.Helper()
+	fake := &fakeWalletRPC{next: make(map[string]uint64)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return NewWalletSessions(NewWalletRPC(srv.URL, "", "", slog.New(slog.DiscardHandler))), fake
+}
+
+func TestWalletSessionsConcurrentAccounts(t *testing.T) {
+	sessions, _ := newFakeSessions(t)
+	ctx := context.Background()
+
+	wallets := []string{"alice", "bob", "carol"}
+	const perWallet = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(wallets)*perWallet)
+	for _, wallet := range wallets {
+		for i := 0; i < perWallet; i++ {
+			wg.Add(1)
+			go func(wallet string) {
+				defer wg.Done()
+				addr, _, err := sessions.CreateAddress(ctx, wallet, "")
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !strings.HasPrefix(addr, wallet+"/") {
+					errs <- fmt.Errorf("wallet %s got address %s", wallet, addr)
+				}
+			}(wallet)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestWalletSessionsSkipsRedundantOpen(t *testing.T) {
+	sessions, fake := newFakeSessions(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, _, err := sessions.CreateAddress(ctx, "alice", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fake.opens != 1 {
+		t.Fatalf("expected 1 open_wallet call, got %d", fake.opens)
+	}
+
+	if _, _, err := sessions.CreateAddress(ctx, "bob", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := sessions.CreateAddress(ctx, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if fake.opens != 3 {
+		t.Fatalf("expected 3 open_wallet calls, got %d", fake.opens)
+	}
+}
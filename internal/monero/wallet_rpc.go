@@ -4,17 +4,21 @@ import (
 	"context"
 	"encoding/base64"
 	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"gitlab.com/moneropay/go-monero/walletrpc"
+
+	"github.com/kaigoh/monalias/internal/metrics"
 )
 
 type WalletRPC struct {
 	client *walletrpc.Client
+	log    *slog.Logger
 }
 
-func NewWalletRPC(url, user, password string) *WalletRPC {
+func NewWalletRPC(url, user, password string, logger *slog.Logger) *WalletRPC {
 	headers := map[string]string{}
 	if user != "" || password != "" {
 		token := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
@@ -27,7 +31,7 @@ func NewWalletRPC(url, user, password string) *WalletRPC {
 		Client:        &http.Client{Timeout: 10 * time.Second},
 	})
 
-	return &WalletRPC{client: client}
+	return &WalletRPC{client: client, log: logger}
 }
 
 func (w *WalletRPC) Enabled() bool {
@@ -38,17 +42,22 @@ func (w *WalletRPC) OpenWallet(ctx context.Context, name string) error {
 	if w.client == nil {
 		return errors.New("wallet rpc not configured")
 	}
-	return w.client.OpenWallet(ctx, &walletrpc.OpenWalletRequest{Filename: name})
+	start := time.Now()
+	err := w.client.OpenWallet(ctx, &walletrpc.OpenWalletRequest{Filename: name})
+	w.observe(ctx, "open_wallet", start, err)
+	return err
 }
 
 func (w *WalletRPC) CreateAddress(ctx context.Context, label string) (string, int64, error) {
 	if w.client == nil {
 		return "", 0, errors.New("wallet rpc not configured")
 	}
+	start := time.Now()
 	resp, err := w.client.CreateAddress(ctx, &walletrpc.CreateAddressRequest{
 		AccountIndex: 0,
 		Label:        label,
 	})
+	w.observe(ctx, "create_address", start, err)
 	if err != nil {
 		return "", 0, err
 	}
@@ -59,10 +68,12 @@ func (w *WalletRPC) GetAddress(ctx context.Context, index int64) (string, error)
 	if w.client == nil {
 		return "", errors.New("wallet rpc not configured")
 	}
+	start := time.Now()
 	resp, err := w.client.GetAddress(ctx, &walletrpc.GetAddressRequest{
 		AccountIndex: 0,
 		AddressIndex: []uint64{uint64(index)},
 	})
+	w.observe(ctx, "get_address", start, err)
 	if err != nil {
 		return "", err
 	}
@@ -71,3 +82,30 @@ func (w *WalletRPC) GetAddress(ctx context.Context, index int64) (string, error)
 	}
 	return resp.Addresses[0].Address, nil
 }
+
+// GetVersion returns the wallet-rpc version as major<<16 | minor.
+func (w *WalletRPC) GetVersion(ctx context.Context) (uint64, error) {
+	if w.client == nil {
+		return 0, errors.New("wallet rpc not configured")
+	}
+	start := time.Now()
+	resp, err := w.client.GetVersion(ctx)
+	w.observe(ctx, "get_version", start, err)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Version, nil
+}
+
+// observe records a wallet-rpc call in metrics and logs it; failures are
+// logged at warn level so they are visible even though callers usually
+// surface only a generic error.
+func (w *WalletRPC) observe(ctx context.Context, method string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	metrics.ObserveWalletRPC(method, elapsed, err)
+	if err != nil {
+		w.log.WarnContext(ctx, "wallet rpc call failed", "method", method, "duration", elapsed, "err", err)
+		return
+	}
+	w.log.DebugContext(ctx, "wallet rpc call", "method", method, "duration", elapsed)
+}
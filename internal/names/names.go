@@ -0,0 +1,148 @@
+// Package names normalizes the parts of a Monalias ID, so that every
+// spelling of an acct maps to the one form stored in the database. Local
+// parts and labels are case-folded and NFC-normalized by the PRECIS
+// UsernameCaseMapped profile (RFC 8265); domains are mapped to their ASCII
+// (punycode) form by UTS #46.
+package names
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/secure/precis"
+)
+
+// Errors a part fails with, wrapped in an *Error.
+var (
+	ErrEmpty        = errors.New("is empty")
+	ErrDisallowed   = errors.New("contains a disallowed character")
+	ErrMixedScripts = errors.New("mixes letters of confusable scripts")
+)
+
+// Error names the part of an acct that failed to normalize: "local",
+// "label" or "domain".
+type Error struct {
+	Part string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %v", e.Part, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// domainProfile maps a domain the way a resolver looks it up, then checks
+// that the result is a valid DNS name.
+var domainProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.VerifyDNSLength(true),
+	idna.Transitional(false),
+)
+
+// Domain returns domain in lowercase ASCII, with internationalized labels
+// in punycode.
+func Domain(domain string) (string, error) {
+	domain = strings.TrimSpace(domain)
+	if domain == "" {
+		return "", &Error{Part: "domain", Err: ErrEmpty}
+	}
+	ascii, err := domainProfile.ToASCII(domain)
+	if err != nil {
+		return "", &Error{Part: "domain", Err: ErrDisallowed}
+	}
+	return ascii, nil
+}
+
+// Local returns a local part or label case-folded and in NFC. It rejects
+// '$' and '+', which delimit the parts of an acct, characters PRECIS
+// disallows in identifiers, such as spaces, controls and compatibility
+// forms, and letters from more than one of the scripts that are easily
+// confused with each other.
+func Local(s string) (string, error) {
+	return local("local", s)
+}
+
+// Label normalizes the +label of an acct like Local.
+func Label(s string) (string, error) {
+	return local("label", s)
+}
+
+func local(part, s string) (string, error) {
+	if s == "" {
+		return "", &Error{Part: part, Err: ErrEmpty}
+	}
+	if strings.ContainsAny(s, "$+") {
+		return "", &Error{Part: part, Err: ErrDisallowed}
+	}
+	out, err := precis.UsernameCaseMapped.String(s)
+	if err != nil {
+		return "", &Error{Part: part, Err: ErrDisallowed}
+	}
+	if err := checkScripts(out); err != nil {
+		return "", &Error{Part: part, Err: err}
+	}
+	return out, nil
+}
+
+// Acct normalizes local$domain or local+label$domain part by part.
+func Acct(acct string) (string, error) {
+	localPart, domain, ok := strings.Cut(acct, "$")
+	if !ok {
+		return "", &Error{Part: "domain", Err: ErrEmpty}
+	}
+	domain, err := Domain(domain)
+	if err != nil {
+		return "", err
+	}
+	base, label, hasLabel := strings.Cut(localPart, "+")
+	base, err = local("local", base)
+	if err != nil {
+		return "", err
+	}
+	if !hasLabel {
+		return base + "$" + domain, nil
+	}
+	label, err = Label(label)
+	if err != nil {
+		return "", err
+	}
+	return base + "+" + label + "$" + domain, nil
+}
+
+// confusableScripts are scripts whose letters include look-alikes of each
+// other's, like Latin "a" and Cyrillic "а". A part may use letters from
+// any one of them.
+var confusableScripts = map[string]*unicode.RangeTable{
+	"Latin":    unicode.Latin,
+	"Greek":    unicode.Greek,
+	"Cyrillic": unicode.Cyrillic,
+	"Armenian": unicode.Armenian,
+	"Cherokee": unicode.Cherokee,
+}
+
+func checkScripts(s string) error {
+	var first string
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for name, table := range confusableScripts {
+			if !unicode.Is(table, r) {
+				continue
+			}
+			if first == "" {
+				first = name
+			} else if name != first {
+				return fmt.Errorf("%w: %s and %s", ErrMixedScripts, first, name)
+			}
+		}
+	}
+	return nil
+}
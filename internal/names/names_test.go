@@ -0,0 +1,103 @@
+package names
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAcct(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     string
+		wantPart string
+	}{
+		{in: "bob$example.com", want: "bob$example.com"},
+		{in: "Bob+Rent$Example.COM", want: "bob+rent$example.com"},
+		{in: "bob$bücher.example", want: "bob$xn--bcher-kva.example"},
+		{in: "bob$xn--bcher-kva.example", want: "bob$xn--bcher-kva.example"},
+		{in: "bob$BÜCHER.example", want: "bob$xn--bcher-kva.example"},
+		// NFD input composes to the same local part as NFC.
+		{in: "josé$example.com", want: "josé$example.com"},
+		{in: "José$example.com", want: "josé$example.com"},
+		{in: "ａｌｉｃｅ$example.com", want: "alice$example.com"},
+		{in: "иван$example.com", want: "иван$example.com"},
+
+		{in: "bob", wantPart: "domain"},
+		{in: "bob$", wantPart: "domain"},
+		{in: "bob$exa mple.com", wantPart: "domain"},
+		{in: "bob$a$b", wantPart: "domain"},
+		{in: "$example.com", wantPart: "local"},
+		{in: "b ob$example.com", wantPart: "local"},
+		{in: "bo\u200bb$example.com", wantPart: "local"},
+		// Cyrillic "а" in an otherwise Latin name.
+		{in: "pаypal$example.com", wantPart: "local"},
+		{in: "bob+$example.com", wantPart: "label"},
+		{in: "bob+a+b$example.com", wantPart: "label"},
+		{in: "bob+rеnt$example.com", wantPart: "label"},
+	}
+	for _, tt := range tests {
+		got, err := Acct(tt.in)
+		if tt.wantPart != "" {
+			var nerr *Error
+			if !errors.As(err, &nerr) || nerr.Part != tt.wantPart {
+				t.Errorf("Acct(%q) = %q, %v; want %s error", tt.in, got, err, tt.wantPart)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Acct(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeIsIdempotent(t *testing.T) {
+	for _, in := range []string{"Bob+Rent$Example.COM", "josé$bücher.example", "ａｌｉｃｅ$example.com"} {
+		once, err := Acct(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		twice, err := Acct(once)
+		if err != nil || twice != once {
+			t.Errorf("Acct(%q) = %q, %v; want %q", once, twice, err, once)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := NewPolicy(DefaultReserved)
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{in: "bob"},
+		{in: "bob.smith-2_x"},
+		{in: "josé"},
+		{in: "नमस्ते"},
+		{in: strings.Repeat("a", MaxLen)},
+		{in: "", want: ErrEmpty},
+		{in: strings.Repeat("a", MaxLen+1), want: ErrTooLong},
+		{in: "bob!", want: ErrDisallowed},
+		{in: "b@b", want: ErrDisallowed},
+		{in: "-bob", want: ErrEdge},
+		{in: "bob.", want: ErrEdge},
+		{in: "admin", want: ErrReserved},
+		{in: "postmaster", want: ErrReserved},
+	}
+	for _, tt := range tests {
+		err := p.Label(tt.in)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("Label(%q) = %v; want nil", tt.in, err)
+			}
+			continue
+		}
+		var nerr *Error
+		if !errors.Is(err, tt.want) || !errors.As(err, &nerr) || nerr.Part != "label" {
+			t.Errorf("Label(%q) = %v; want label %v", tt.in, err, tt.want)
+		}
+	}
+	if err := NewPolicy(nil).Local("admin"); err != nil {
+		t.Errorf("Local(admin) with no reserved names = %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package names
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLen is the most characters a new local part or label may have.
+const MaxLen = 64
+
+// Errors a new name fails Policy with, wrapped in an *Error.
+var (
+	ErrTooLong  = fmt.Errorf("is longer than %d characters", MaxLen)
+	ErrEdge     = errors.New("must start and end with a letter or digit")
+	ErrReserved = errors.New("is reserved")
+)
+
+// DefaultReserved are the local parts and labels no account or alias may be
+// created with unless the operator configures another list: names that
+// suggest they speak for the operator, and the role mailboxes of RFC 2142.
+var DefaultReserved = []string{
+	"abuse", "admin", "administrator", "help", "hostmaster", "info",
+	"monalias", "no-reply", "noreply", "postmaster", "root", "security",
+	"support", "system", "webmaster",
+}
+
+// Policy holds the rules new local parts and labels meet on top of
+// normalizing: at most MaxLen characters, only letters, digits, '.', '-'
+// and '_', a letter or digit at each end, and not a reserved name. Names
+// already stored are not rechecked, so tightening the policy never breaks
+// a resolve.
+type Policy struct {
+	reserved map[string]bool
+}
+
+// NewPolicy returns a Policy reserving the given normalized names.
+func NewPolicy(reserved []string) *Policy {
+	p := &Policy{reserved: make(map[string]bool, len(reserved))}
+	for _, name := range reserved {
+		p.reserved[name] = true
+	}
+	return p
+}
+
+// Local checks a normalized local part.
+func (p *Policy) Local(s string) error {
+	return p.check("local", s)
+}
+
+// Label checks a normalized label.
+func (p *Policy) Label(s string) error {
+	return p.check("label", s)
+}
+
+func (p *Policy) check(part, s string) error {
+	if s == "" {
+		return &Error{Part: part, Err: ErrEmpty}
+	}
+	if utf8.RuneCountInString(s) > MaxLen {
+		return &Error{Part: part, Err: ErrTooLong}
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) && !unicode.IsDigit(r) && r != '.' && r != '-' && r != '_' {
+			return &Error{Part: part, Err: ErrDisallowed}
+		}
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	last, _ := utf8.DecodeLastRuneInString(s)
+	// A combining mark ends a letter, as in Devanagari.
+	if !alnum(first) || !(alnum(last) || unicode.IsMark(last)) {
+		return &Error{Part: part, Err: ErrEdge}
+	}
+	if p.reserved[s] {
+		return &Error{Part: part, Err: ErrReserved}
+	}
+	return nil
+}
+
+func alnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
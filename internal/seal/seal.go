@@ -0,0 +1,129 @@
+// Package seal encrypts signing key seeds before they are stored, with a key
+// kept outside the database, so that the database file or a backup of it
+// does not give the signing keys away. Sealing is optional: without a seal
+// key, seeds are stored as plaintext base64 as they were before.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the length of a seal key: AES-256.
+const KeySize = 32
+
+// prefix marks a sealed value and the format it is sealed in.
+const prefix = "sealed:v1:"
+
+// ErrOpen is returned for a sealed value that does not open with the key,
+// because it was sealed with another key, for another kid, or was altered.
+var ErrOpen = errors.New("sealed seed does not open with this seal key")
+
+// ErrNoKey is returned for a sealed seed when no seal key is configured.
+var ErrNoKey = errors.New("seed is sealed but no seal key is configured")
+
+// Box seals and opens seeds with AES-256-GCM. The kid is bound in as
+// additional data, so a sealed seed copied to another key's row does not
+// open. A nil *Box stores and reads seeds as plaintext base64.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New returns a Box for a KeySize-byte key.
+func New(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("seal key is %d bytes; expected %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Load reads a base64 seal key from path. Like the signing key file, it has
+// to be unreadable by group and others.
+func Load(path string) (*Box, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return nil, fmt.Errorf("seal key file %s is readable by group or others (mode %04o); chmod 600 it", path, perm)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: seal key must be base64", path)
+	}
+	box, err := New(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return box, nil
+}
+
+// GenerateKey returns a fresh base64 seal key.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Seal encrypts the seed of key kid for storage.
+func (b *Box) Seal(kid string, seed []byte) string {
+	if b == nil {
+		return base64.StdEncoding.EncodeToString(seed)
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err) // crypto/rand does not fail
+	}
+	out := b.aead.Seal(nonce, nonce, seed, []byte(kid))
+	return prefix + base64.StdEncoding.EncodeToString(out)
+}
+
+// Open decrypts a seed Seal stored for kid.
+func (b *Box) Open(kid, sealed string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(sealed, prefix)
+	if b == nil {
+		if ok {
+			return nil, ErrNoKey
+		}
+		return base64.StdEncoding.DecodeString(sealed)
+	}
+	if !ok {
+		return nil, errors.New("seed is not sealed")
+	}
+	raw, err := base64.StdEncoding.DecodeString(rest)
+	if err != nil || len(raw) < b.aead.NonceSize() {
+		return nil, ErrOpen
+	}
+	nonce, ciphertext := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	seed, err := b.aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, ErrOpen
+	}
+	return seed, nil
+}
+
+// IsSealed reports whether a stored seed was written by Seal, as opposed to
+// a plaintext seed stored before seeds were sealed.
+func IsSealed(stored string) bool {
+	return strings.HasPrefix(stored, prefix)
+}
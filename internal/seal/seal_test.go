@@ -0,0 +1,120 @@
+package seal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestBox(t *testing.T, fill byte) *Box {
+	t.Helper()
+	box, err := New(bytes.Repeat([]byte{fill}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestSealOpen(t *testing.T) {
+	box := newTestBox(t, 1)
+	seed := bytes.Repeat([]byte{7}, 32)
+
+	sealed := box.Seal("k1", seed)
+	if !IsSealed(sealed) {
+		t.Fatalf("IsSealed(%q) = false", sealed)
+	}
+	if strings.Contains(sealed, base64.StdEncoding.EncodeToString(seed)) {
+		t.Fatal("sealed value contains the plaintext seed")
+	}
+	if again := box.Seal("k1", seed); again == sealed {
+		t.Error("sealing twice gave the same value; nonce reused")
+	}
+	got, err := box.Open("k1", sealed)
+	if err != nil || !bytes.Equal(got, seed) {
+		t.Fatalf("Open = %x, %v; want %x", got, err, seed)
+	}
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)-3] ^= 1
+	tests := map[string]struct {
+		box         *Box
+		kid, sealed string
+	}{
+		"other kid":  {box, "k2", sealed},
+		"other key":  {newTestBox(t, 2), "k1", sealed},
+		"tampered":   {box, "k1", string(tampered)},
+		"truncated":  {box, "k1", prefix + "AAAA"},
+		"not base64": {box, "k1", prefix + "!!"},
+	}
+	for name, tt := range tests {
+		if _, err := tt.box.Open(tt.kid, tt.sealed); !errors.Is(err, ErrOpen) {
+			t.Errorf("%s: err = %v; want ErrOpen", name, err)
+		}
+	}
+	plain := base64.StdEncoding.EncodeToString(seed)
+	if IsSealed(plain) {
+		t.Error("plaintext seed reported as sealed")
+	}
+	if _, err := box.Open("k1", plain); err == nil {
+		t.Error("Open accepted a plaintext seed")
+	}
+}
+
+func TestNilBoxStoresPlaintext(t *testing.T) {
+	var box *Box
+	seed := []byte("0123456789abcdef0123456789abcdef")
+
+	stored := box.Seal("k1", seed)
+	if IsSealed(stored) || stored != base64.StdEncoding.EncodeToString(seed) {
+		t.Fatalf("Seal without a key = %q; want plaintext base64", stored)
+	}
+	if got, err := box.Open("k1", stored); err != nil || string(got) != string(seed) {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+	sealed := newTestBox(t, 1).Seal("k1", seed)
+	if _, err := box.Open("k1", sealed); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Open of a sealed seed without a key: err = %v; want ErrNoKey", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, data string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	box, err := Load(write("good", key+"\n", 0o600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := box.Open("k1", box.Seal("k1", []byte("seed"))); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := map[string]string{
+		"readable":   write("readable", key, 0o644),
+		"short":      write("short", base64.StdEncoding.EncodeToString(make([]byte, 16)), 0o600),
+		"not base64": write("raw", "not a key", 0o600),
+		"missing":    filepath.Join(dir, "missing"),
+	}
+	for name, path := range bad {
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: Load succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxBatchBodySize bounds a resolve-batch response.
+const maxBatchBodySize = 1 << 20
+
+// BatchItem is one acct/network pair for ResolveBatch.
+type BatchItem struct {
+	Acct    string
+	Network string
+	Payment Payment
+}
+
+// BatchResult is the answer to one BatchItem: a verified Result, or the
+// error Resolve would have returned for that pair.
+type BatchResult struct {
+	Result Result
+	Err    error
+}
+
+type batchRequest struct {
+	Items []resolveRequest `json:"items"`
+}
+
+type batchResponse struct {
+	Results []struct {
+		Acct      string          `json:"acct"`
+		Network   string          `json:"network"`
+		Status    int             `json:"status"`
+		Response  json.RawMessage `json:"response"`
+		KeyID     string          `json:"key_id"`
+		Signature string          `json:"signature"`
+	} `json:"results"`
+}
+
+// ResolveBatch resolves several pairs on one domain in a single request.
+// Each item is verified on its own, exactly as Resolve verifies a single
+// response, and results are returned in the order of items. The error is
+// only set when the batch as a whole failed, e.g. with ErrRateLimited or
+// because items span more than one domain.
+func (c *Client) ResolveBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	var domain string
+	reqs := make([]resolveRequest, len(items))
+	for i, item := range items {
+		id, err := ParseID(item.Acct)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			domain = id.Domain
+		} else if !strings.EqualFold(id.Domain, domain) {
+			return nil, fmt.Errorf("monalias: batch mixes domains %s and %s", domain, id.Domain)
+		}
+		payment, err := item.Payment.Normalize()
+		if err != nil {
+			return nil, err
+		}
+		reqs[i] = resolveRequest{Acct: id.String(), Network: item.Network, Payment: payment}
+	}
+
+	wk, err := c.WellKnown(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	resp, raw, err := c.post(ctx, wk, "/_monalias/resolve-batch", batchRequest{Items: reqs}, maxBatchBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.responseError(wk, resp.StatusCode, resp.Header.Get("Retry-After"), raw, "", "", "", "")
+	}
+
+	var br batchResponse
+	if err := json.Unmarshal(raw, &br); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if len(br.Results) != len(reqs) {
+		return nil, fmt.Errorf("%w: asked for %d results, got %d", ErrInvalidResponse, len(reqs), len(br.Results))
+	}
+	kids := make([]string, len(br.Results))
+	for i, item := range br.Results {
+		kids[i] = item.KeyID
+	}
+	wk = c.refreshForKeys(ctx, wk, domain, kids...)
+
+	out := make([]BatchResult, len(reqs))
+	for i, item := range br.Results {
+		req := reqs[i]
+		switch {
+		case item.Acct != req.Acct || item.Network != req.Network:
+			out[i].Err = fmt.Errorf("%w: result %d is for %s on %s", ErrInvalidResponse, i, item.Acct, item.Network)
+		case item.Status != http.StatusOK:
+			out[i].Err = c.responseError(wk, item.Status, "", item.Response, req.Acct, req.Network, item.KeyID, item.Signature)
+		default:
+			out[i].Result, out[i].Err = c.verifyResult(wk, item.Response, req.Acct, req.Network, req.Payment, item.KeyID, item.Signature)
+		}
+	}
+	return out, nil
+}
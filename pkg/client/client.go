@@ -0,0 +1,320 @@
+// Package client resolves Monalias IDs to Monero addresses following the
+// lookup flow in SPEC.md: well-known discovery with the SRV fallback, the
+// resolve call, and Ed25519 verification of the signed response.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/monero/address"
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+const (
+	Mainnet  = "mainnet"
+	Stagenet = "stagenet"
+)
+
+const (
+	DefaultWellKnownTTL = 5 * time.Minute
+	DefaultClockSkew    = time.Minute
+
+	maxBodySize = 64 << 10
+)
+
+// SRVResolver is the subset of net.Resolver used for the SRV fallback.
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+type Client struct {
+	// HTTPClient makes every request. http.DefaultClient is used when nil.
+	HTTPClient *http.Client
+	// SRV resolves _monalias._tcp.<domain> when the well-known document is
+	// unavailable. net.DefaultResolver is used when nil.
+	SRV        SRVResolver
+	DisableSRV bool
+	// WellKnownTTL is how long well-known documents are cached.
+	WellKnownTTL time.Duration
+	// ClockSkew is how far past expires_at a response may arrive before it
+	// is rejected with ErrExpired.
+	ClockSkew time.Duration
+	// Now returns the current time; time.Now when nil.
+	Now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedWellKnown
+}
+
+func New(httpClient *http.Client) *Client {
+	return &Client{
+		HTTPClient:   httpClient,
+		WellKnownTTL: DefaultWellKnownTTL,
+		ClockSkew:    DefaultClockSkew,
+	}
+}
+
+// Result is a verified resolve response.
+type Result struct {
+	Acct         string
+	Address      string
+	Network      string
+	DisplayName  string
+	Alias        string
+	ResolvedKind string
+	// ExpiresAt is when the result stops being valid; zero when the server
+	// did not set one. Callers caching results must drop them by then.
+	ExpiresAt time.Time
+	// URI is the signed monero: payment URI, set when a Payment was
+	// requested.
+	URI        string
+	KeyID      string
+	Homeserver string
+}
+
+// Payment is an optional payment request for ResolvePayment: an amount in
+// XMR, a description and a recipient name, all echoed back in Result.URI.
+type Payment = protocol.Payment
+
+// Expired reports whether the result is past its expires_at at now.
+func (r Result) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+type resolveRequest struct {
+	Acct    string `json:"acct"`
+	Network string `json:"network"`
+	protocol.Payment
+}
+
+type resolveResponse struct {
+	Address string `json:"address"`
+	Network string `json:"network"`
+	Meta    struct {
+		DisplayName *string `json:"display_name"`
+		Alias       *string `json:"alias"`
+		// ResolvedKind is NORMAL, PROVISIONED, DEFAULT_ALIAS,
+		// ACCOUNT_CATCH_ALL or CATCH_ALL.
+		ResolvedKind string `json:"resolved_kind"`
+	} `json:"meta"`
+	// ExpiresAt is kept as sent because the signature covers the exact
+	// string.
+	ExpiresAt *string `json:"expires_at"`
+	URI       string  `json:"uri"`
+}
+
+type errorResponse struct {
+	Error             string `json:"error"`
+	Reason            string `json:"reason"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+}
+
+// Resolve looks up acct on network and returns the address only after its
+// signature has been verified against the domain's published keys.
+func (c *Client) Resolve(ctx context.Context, acct, network string) (Result, error) {
+	return c.ResolvePayment(ctx, acct, network, Payment{})
+}
+
+// ResolvePayment is Resolve with a payment request. The result's URI is
+// checked to be exactly the monero: URI for the returned address and
+// payment, and is covered by the signature.
+func (c *Client) ResolvePayment(ctx context.Context, acct, network string, payment Payment) (Result, error) {
+	id, err := ParseID(acct)
+	if err != nil {
+		return Result{}, err
+	}
+	if payment, err = payment.Normalize(); err != nil {
+		return Result{}, err
+	}
+	wk, err := c.WellKnown(ctx, id.Domain)
+	if err != nil {
+		return Result{}, err
+	}
+
+	acct = id.String()
+	resp, raw, err := c.post(ctx, wk, "/_monalias/resolve", resolveRequest{Acct: acct, Network: network, Payment: payment}, maxBodySize)
+	if err != nil {
+		return Result{}, err
+	}
+
+	kid := resp.Header.Get(protocol.HeaderKeyID)
+	sig := resp.Header.Get(protocol.HeaderSignature)
+	wk = c.refreshForKeys(ctx, wk, id.Domain, kid)
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, c.responseError(wk, resp.StatusCode, resp.Header.Get("Retry-After"), raw, acct, network, kid, sig)
+	}
+	return c.verifyResult(wk, raw, acct, network, payment, kid, sig)
+}
+
+// post sends payload as JSON to path on the domain's homeserver and reads up
+// to limit bytes of the response.
+func (c *Client) post(ctx context.Context, wk *WellKnown, path string, payload interface{}, limit int64) (*http.Response, []byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	endpoint := strings.TrimRight(wk.Homeserver, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, raw, nil
+}
+
+// refreshForKeys refetches the well-known document once if any of kids is
+// not in it. A kid we have not seen is expected right after a rotation.
+func (c *Client) refreshForKeys(ctx context.Context, wk *WellKnown, domain string, kids ...string) *WellKnown {
+	for _, kid := range kids {
+		if _, ok := wk.Key(kid); !ok && kid != "" {
+			if fresh, err := c.wellKnown(ctx, domain, true); err == nil {
+				return fresh
+			}
+			return wk
+		}
+	}
+	return wk
+}
+
+// verifyResult checks a 200 resolve body against its signature and the
+// request it answers. payment must already be normalized.
+func (c *Client) verifyResult(wk *WellKnown, raw []byte, acct, network string, payment Payment, kid, sig string) (Result, error) {
+	var rr resolveResponse
+	if err := json.Unmarshal(raw, &rr); err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	expires := ""
+	if rr.ExpiresAt != nil {
+		expires = *rr.ExpiresAt
+	}
+	canonical := protocol.SuccessCanonical(acct, rr.Address, network, expires, kid, rr.URI)
+	if !verify(wk, kid, sig, canonical) {
+		return Result{}, ErrBadSignature
+	}
+	if payment.IsZero() && rr.URI != "" || !payment.IsZero() && rr.URI != protocol.PaymentURI(rr.Address, payment) {
+		return Result{}, fmt.Errorf("%w: uri does not match the requested payment", ErrInvalidResponse)
+	}
+
+	result := Result{
+		Acct:         acct,
+		Address:      rr.Address,
+		Network:      rr.Network,
+		ResolvedKind: rr.Meta.ResolvedKind,
+		URI:          rr.URI,
+		KeyID:        kid,
+		Homeserver:   wk.Homeserver,
+	}
+	if rr.Meta.DisplayName != nil {
+		result.DisplayName = *rr.Meta.DisplayName
+	}
+	if rr.Meta.Alias != nil {
+		result.Alias = *rr.Meta.Alias
+	}
+	if expires != "" {
+		var err error
+		result.ExpiresAt, err = time.Parse(time.RFC3339, expires)
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: expires_at: %v", ErrInvalidResponse, err)
+		}
+		if c.now().After(result.ExpiresAt.Add(c.clockSkew())) {
+			return Result{}, ErrExpired
+		}
+	}
+
+	// The signature covers the requested network, not the body's echo of
+	// it, so check both the echo and the address itself.
+	if rr.Network != network {
+		return Result{}, fmt.Errorf("%w: asked for %s, got %s", ErrInvalidResponse, network, rr.Network)
+	}
+	if _, err := address.Validate(rr.Address, network); err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return result, nil
+}
+
+// responseError turns a non-200 answer into an *Error, verifying it when it
+// is signed. retryAfter is the Retry-After header, if there was one.
+func (c *Client) responseError(wk *WellKnown, status int, retryAfter string, raw []byte, acct, network, kid, sig string) error {
+	var er errorResponse
+	if err := json.Unmarshal(raw, &er); err != nil || er.Error == "" {
+		return fmt.Errorf("monalias: unexpected HTTP %d from resolver", status)
+	}
+	out := &Error{Code: er.Error, StatusCode: status, Reason: er.Reason}
+
+	if sig != "" {
+		canonical := protocol.ErrorCanonical(acct, network, er.Error, kid)
+		if !verify(wk, kid, sig, canonical) {
+			return ErrBadSignature
+		}
+		out.Signed = true
+	} else if er.Error == ErrNetworkNotSupported.Code || er.Error == ErrAliasRateLimited.Code {
+		// The server always signs these; an unsigned copy did not come
+		// from it.
+		return ErrBadSignature
+	}
+
+	if er.Error == ErrRateLimited.Code || er.Error == ErrAliasRateLimited.Code {
+		out.RetryAfter = time.Duration(er.RetryAfterSeconds) * time.Second
+		if secs, err := strconv.Atoi(retryAfter); err == nil {
+			out.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+	return out
+}
+
+func verify(wk *WellKnown, kid, sig, canonical string) bool {
+	if kid == "" || sig == "" {
+		return false
+	}
+	pub, ok := wk.Key(kid)
+	return ok && protocol.Verify(pub, canonical, sig)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *Client) wellKnownTTL() time.Duration {
+	if c.WellKnownTTL > 0 {
+		return c.WellKnownTTL
+	}
+	return DefaultWellKnownTTL
+}
+
+func (c *Client) clockSkew() time.Duration {
+	if c.ClockSkew > 0 {
+		return c.ClockSkew
+	}
+	return DefaultClockSkew
+}
@@ -0,0 +1,459 @@
+package client_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kaigoh/monalias/internal/config"
+	"github.com/kaigoh/monalias/internal/db"
+	httpx "github.com/kaigoh/monalias/internal/http"
+	"github.com/kaigoh/monalias/internal/monero"
+	"github.com/kaigoh/monalias/internal/seal"
+	"github.com/kaigoh/monalias/pkg/client"
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+const (
+	testDomain     = "example.com"
+	testHomeserver = "https://monalias.example.com"
+	testAddress    = "888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H"
+)
+
+// routeTransport sends requests for the listed hosts to the test server over
+// plain HTTP and fails everything else, standing in for DNS and TLS.
+type routeTransport struct {
+	target    *url.URL
+	hosts     map[string]bool
+	wellKnown atomic.Int32
+	tamper    func(*http.Response)
+}
+
+func (t *routeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.hosts[req.URL.Host] {
+		return nil, fmt.Errorf("no route to %s", req.URL.Host)
+	}
+	if req.URL.Path == "/.well-known/monalias" {
+		t.wellKnown.Add(1)
+	}
+	out := req.Clone(req.Context())
+	out.URL.Scheme = t.target.Scheme
+	out.URL.Host = t.target.Host
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err == nil && t.tamper != nil {
+		t.tamper(resp)
+	}
+	return resp, err
+}
+
+// testSeals seals the signing key seeds the tests store.
+var testSeals = func() *seal.Box {
+	box, err := seal.New(make([]byte, seal.KeySize))
+	if err != nil {
+		panic(err)
+	}
+	return box
+}()
+
+type testEnv struct {
+	db        *db.DB
+	client    *client.Client
+	transport *routeTransport
+}
+
+func newTestEnv(t *testing.T, limiter *httpx.IPRateLimiter) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "monalias.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.CreateDomain(ctx, testDomain, testHomeserver); err != nil {
+		t.Fatal(err)
+	}
+	addSigningKey(t, database, "k1")
+	if _, err := database.ActivateSigningKey(ctx, "k1"); err != nil {
+		t.Fatal(err)
+	}
+	account, err := database.CreateAccount(ctx, "bob$"+testDomain, sql.NullString{}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateAlias(ctx, account.ID, "bob+tips$"+testDomain, "tips", "STATIC_ADDRESS", sql.NullString{String: testAddress, Valid: true}, sql.NullInt64{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{Domain: testDomain, ResolveTTL: 5 * time.Minute, BatchMax: 3}
+	svc := httpx.NewPublicService(cfg, database, testSeals, monero.NewWalletSessions(nil), slog.New(slog.DiscardHandler))
+	srv := httptest.NewServer(svc.Handler(limiter, nil))
+	t.Cleanup(srv.Close)
+
+	target, _ := url.Parse(srv.URL)
+	transport := &routeTransport{
+		target: target,
+		hosts:  map[string]bool{testDomain: true, "monalias.example.com": true},
+	}
+	c := client.New(&http.Client{Transport: transport})
+	c.DisableSRV = true
+	return &testEnv{db: database, client: c, transport: transport}
+}
+
+func addSigningKey(t *testing.T, database *db.DB, kid string) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))
+	seed := sql.NullString{String: testSeals.Seal(kid, priv.Seed()), Valid: true}
+	if _, err := database.CreateSigningKey(context.Background(), testDomain, kid, pub, seed, db.SigningKeyNext); err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func TestResolve(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	res, err := env.client.Resolve(context.Background(), "bob+tips$example.com", client.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Address != testAddress || res.Network != client.Mainnet {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if res.Alias != "tips" || res.DisplayName != "bob" || res.ResolvedKind != "NORMAL" {
+		t.Fatalf("unexpected meta %+v", res)
+	}
+	if res.KeyID != "k1" || res.Homeserver != testHomeserver {
+		t.Fatalf("unexpected key or homeserver %+v", res)
+	}
+	if res.ExpiresAt.IsZero() || res.Expired(time.Now()) {
+		t.Fatalf("expected a future expires_at, got %v", res.ExpiresAt)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+
+	_, err := env.client.Resolve(ctx, "alice$example.com", client.Mainnet)
+	if !errors.Is(err, client.ErrAliasNotFound) {
+		t.Fatalf("expected alias_not_found, got %v", err)
+	}
+
+	_, err = env.client.Resolve(ctx, "bob+tips$example.com", client.Stagenet)
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrNetworkNotSupported) || !errors.As(err, &apiErr) || !apiErr.Signed {
+		t.Fatalf("expected signed network_not_supported, got %v", err)
+	}
+
+	reason := sql.NullString{String: "identity_mismatch", Valid: true}
+	if _, err := env.db.UpdateDomainStatus(ctx, testDomain, "LOCKED", reason, sql.NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet)
+	if !errors.Is(err, client.ErrInstanceLocked) || !errors.As(err, &apiErr) || apiErr.Reason != "identity_mismatch" {
+		t.Fatalf("expected instance_locked with reason, got %v", err)
+	}
+}
+
+func TestResolveRateLimited(t *testing.T) {
+	env := newTestEnv(t, httpx.NewIPRateLimiter(0.001, 1, httpx.NewClientIPResolver(nil, "X-Forwarded-For", 64)))
+	ctx := context.Background()
+
+	if _, err := env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet); err != nil {
+		t.Fatal(err)
+	}
+	_, err := env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet)
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 30*time.Second {
+		t.Fatalf("expected rate_limited with retry-after, got %v", err)
+	}
+}
+
+func TestResolveAliasRateLimited(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+
+	alias, err := env.db.GetAliasByFullAcct(ctx, "bob+tips$example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.UpdateAliasRateLimit(ctx, alias.ID, sql.NullInt64{Int64: 2, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet); err != nil {
+			t.Fatalf("resolve %d: %v", i, err)
+		}
+	}
+	_, err = env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet)
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrAliasRateLimited) || !errors.As(err, &apiErr) {
+		t.Fatalf("expected alias_rate_limited, got %v", err)
+	}
+	if !apiErr.Signed || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got signed=%v status=%d, want a signed 429", apiErr.Signed, apiErr.StatusCode)
+	}
+	if apiErr.RetryAfter <= 0 || apiErr.RetryAfter > 30*time.Second {
+		t.Errorf("retry after = %v, want within the 30s refill interval", apiErr.RetryAfter)
+	}
+
+	// Other aliases keep their own budget.
+	if _, err := env.client.Resolve(ctx, "bob+rent$example.com", client.Mainnet); errors.Is(err, client.ErrAliasRateLimited) {
+		t.Fatalf("unrelated acct was limited: %v", err)
+	}
+}
+
+func TestResolvePayment(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+
+	res, err := env.client.ResolvePayment(ctx, "bob+tips$example.com", client.Mainnet, client.Payment{
+		Amount:        "1.50",
+		TxDescription: "Rent for May",
+		RecipientName: "Bob",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "monero:" + testAddress + "?tx_amount=1.5&tx_description=Rent%20for%20May&recipient_name=Bob"
+	if res.URI != want {
+		t.Errorf("uri = %q, want %q", res.URI, want)
+	}
+
+	if res, err := env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet); err != nil || res.URI != "" {
+		t.Errorf("plain resolve: uri = %q, err = %v", res.URI, err)
+	}
+
+	_, err = env.client.ResolvePayment(ctx, "bob+tips$example.com", client.Mainnet, client.Payment{Amount: "-1"})
+	var perr *protocol.PaymentError
+	if !errors.As(err, &perr) || perr.Field != "amount" {
+		t.Errorf("expected an amount error, got %v", err)
+	}
+}
+
+func TestResolveBatch(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+
+	results, err := env.client.ResolveBatch(ctx, []client.BatchItem{
+		{Acct: "bob+tips$example.com", Network: client.Mainnet},
+		{Acct: "alice$example.com", Network: client.Mainnet},
+		{Acct: "bob+tips$example.com", Network: client.Stagenet},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].Err != nil || results[0].Result.Address != testAddress || results[0].Result.KeyID != "k1" {
+		t.Errorf("item 0 = %+v", results[0])
+	}
+	if !errors.Is(results[1].Err, client.ErrAliasNotFound) {
+		t.Errorf("item 1: expected alias_not_found, got %v", results[1].Err)
+	}
+	var apiErr *client.Error
+	if !errors.Is(results[2].Err, client.ErrNetworkNotSupported) || !errors.As(results[2].Err, &apiErr) || !apiErr.Signed {
+		t.Errorf("item 2: expected signed network_not_supported, got %v", results[2].Err)
+	}
+
+	four := make([]client.BatchItem, 4)
+	for i := range four {
+		four[i] = client.BatchItem{Acct: "bob+tips$example.com", Network: client.Mainnet}
+	}
+	if _, err := env.client.ResolveBatch(ctx, four); !errors.As(err, &apiErr) || apiErr.Code != "batch_too_large" {
+		t.Fatalf("expected batch_too_large, got %v", err)
+	}
+	if _, err := env.client.ResolveBatch(ctx, []client.BatchItem{
+		{Acct: "bob$example.com", Network: client.Mainnet},
+		{Acct: "bob$example.org", Network: client.Mainnet},
+	}); err == nil {
+		t.Fatal("expected an error for a batch spanning two domains")
+	}
+
+	reason := sql.NullString{String: "identity_mismatch", Valid: true}
+	if _, err := env.db.UpdateDomainStatus(ctx, testDomain, "LOCKED", reason, sql.NullTime{}); err != nil {
+		t.Fatal(err)
+	}
+	results, err = env.client.ResolveBatch(ctx, four[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if !errors.Is(res.Err, client.ErrInstanceLocked) || !errors.As(res.Err, &apiErr) || apiErr.Reason != "identity_mismatch" {
+			t.Errorf("item %d: expected instance_locked with reason, got %v", i, res.Err)
+		}
+	}
+}
+
+func TestResolveBatchChargesPerItem(t *testing.T) {
+	env := newTestEnv(t, httpx.NewIPRateLimiter(0.001, 5, httpx.NewClientIPResolver(nil, "X-Forwarded-For", 64)))
+	ctx := context.Background()
+
+	items := make([]client.BatchItem, 3)
+	for i := range items {
+		items[i] = client.BatchItem{Acct: "bob+tips$example.com", Network: client.Mainnet}
+	}
+	if _, err := env.client.ResolveBatch(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+	// Three of the five tokens are gone, so a second batch of three is
+	// refused while two single resolves still fit.
+	if _, err := env.client.ResolveBatch(ctx, items); !errors.Is(err, client.ErrRateLimited) {
+		t.Fatalf("expected rate_limited, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet); err != nil {
+			t.Fatalf("resolve %d: %v", i, err)
+		}
+	}
+}
+
+func TestResolveRejectsBadSignature(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.transport.tamper = func(resp *http.Response) {
+		if resp.Header.Get("X-Monalias-Sig") != "" {
+			resp.Header.Set("X-Monalias-Sig", base64.StdEncoding.EncodeToString(make([]byte, ed25519.SignatureSize)))
+		}
+	}
+
+	_, err := env.client.Resolve(context.Background(), "bob+tips$example.com", client.Mainnet)
+	if !errors.Is(err, client.ErrBadSignature) {
+		t.Fatalf("expected bad signature, got %v", err)
+	}
+	_, err = env.client.Resolve(context.Background(), "bob+tips$example.com", client.Stagenet)
+	if !errors.Is(err, client.ErrBadSignature) {
+		t.Fatalf("expected bad signature on signed error, got %v", err)
+	}
+}
+
+func TestResolveRejectsExpired(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.client.Now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	_, err := env.client.Resolve(context.Background(), "bob+tips$example.com", client.Mainnet)
+	if !errors.Is(err, client.ErrExpired) {
+		t.Fatalf("expected expired, got %v", err)
+	}
+}
+
+func TestWellKnownCacheAndRotation(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := env.transport.wellKnown.Load(); got != 1 {
+		t.Fatalf("expected 1 well-known fetch, got %d", got)
+	}
+
+	// A key the cached document does not list forces one refetch.
+	addSigningKey(t, env.db, "k2")
+	if _, err := env.db.ActivateSigningKey(ctx, "k2"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := env.client.Resolve(ctx, "bob+tips$example.com", client.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.KeyID != "k2" {
+		t.Fatalf("expected k2, got %s", res.KeyID)
+	}
+	if got := env.transport.wellKnown.Load(); got != 2 {
+		t.Fatalf("expected 2 well-known fetches, got %d", got)
+	}
+}
+
+type fakeSRV map[string][]*net.SRV
+
+func (f fakeSRV) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	cname := "_" + service + "._" + proto + "." + name
+	records, ok := f[cname]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: cname, IsNotFound: true}
+	}
+	return cname, records, nil
+}
+
+func TestResolveSRVFallback(t *testing.T) {
+	env := newTestEnv(t, nil)
+	// The domain itself does not answer; only the SRV target does.
+	env.transport.hosts = map[string]bool{"resolver.example.net:8443": true}
+	env.client.DisableSRV = false
+	env.client.SRV = fakeSRV{
+		"_monalias._tcp.example.com": {{Target: "resolver.example.net.", Port: 8443, Priority: 10, Weight: 5}},
+	}
+
+	res, err := env.client.Resolve(context.Background(), "bob+tips$example.com", client.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Homeserver != "https://resolver.example.net:8443" || res.Address != testAddress {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	env.client.SRV = fakeSRV{}
+	env.client.WellKnownTTL = time.Nanosecond
+	_, err = env.client.Resolve(context.Background(), "bob+tips$example.com", client.Mainnet)
+	if !errors.Is(err, client.ErrNoHomeserver) {
+		t.Fatalf("expected no homeserver, got %v", err)
+	}
+}
+
+func TestParseID(t *testing.T) {
+	cases := []struct {
+		in   string
+		want client.ID
+		ok   bool
+	}{
+		{"bob$example.com", client.ID{Local: "bob", Domain: "example.com"}, true},
+		{"bob+rent$example.com", client.ID{Local: "bob", Label: "rent", Domain: "example.com"}, true},
+		{"xmr:bob+rent$example.com", client.ID{Local: "bob", Label: "rent", Domain: "example.com"}, true},
+		{"bob", client.ID{}, false},
+		{"$example.com", client.ID{}, false},
+		{"bob$", client.ID{}, false},
+		{"bob$a$b", client.ID{}, false},
+		{"+rent$example.com", client.ID{}, false},
+		{"bob+$example.com", client.ID{}, false},
+		{"bob$example.com/evil", client.ID{}, false},
+	}
+	for _, tc := range cases {
+		got, err := client.ParseID(tc.in)
+		if tc.ok != (err == nil) {
+			t.Errorf("ParseID(%q) error = %v, want ok=%v", tc.in, err, tc.ok)
+			continue
+		}
+		if tc.ok && got != tc.want {
+			t.Errorf("ParseID(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+		if tc.ok && !strings.HasPrefix(tc.in, "xmr:") && got.String() != tc.in {
+			t.Errorf("%q round-tripped to %q", tc.in, got.String())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Error is an error response from a resolver. Compare against the Err*
+// values with errors.Is, and use errors.As to read Reason or RetryAfter.
+type Error struct {
+	// Code is the error field of the response, e.g. "alias_not_found".
+	Code       string
+	StatusCode int
+	// Reason is set for instance_locked.
+	Reason string
+	// RetryAfter is set for rate_limited and alias_rate_limited.
+	RetryAfter time.Duration
+	// Signed reports whether the error carried a signature that verified
+	// against the domain's published keys.
+	Signed bool
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("monalias: %s (HTTP %d)", e.Code, e.StatusCode)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Is matches on Code, so errors.Is(err, ErrRateLimited) holds for any
+// rate_limited response.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrAliasNotFound       = &Error{Code: "alias_not_found"}
+	ErrNetworkNotSupported = &Error{Code: "network_not_supported"}
+	ErrInstanceLocked      = &Error{Code: "instance_locked"}
+	ErrRateLimited         = &Error{Code: "rate_limited"}
+	// ErrAliasRateLimited means the alias itself has been resolved too
+	// often, regardless of who is asking.
+	ErrAliasRateLimited = &Error{Code: "alias_rate_limited"}
+)
+
+var (
+	// ErrBadSignature means a response was not signed by any key the domain
+	// publishes. The response must not be used.
+	ErrBadSignature = errors.New("monalias: response signature did not verify")
+	// ErrExpired means a signed response had already passed its expires_at
+	// when it arrived, which is what a replayed response looks like.
+	ErrExpired = errors.New("monalias: response already expired")
+	// ErrInvalidResponse covers responses that are well signed but do not
+	// match the request, or carry an address that is not valid on the
+	// requested network.
+	ErrInvalidResponse = errors.New("monalias: invalid resolve response")
+	// ErrNoHomeserver means neither the well-known document nor the SRV
+	// record for the domain could be used.
+	ErrNoHomeserver = errors.New("monalias: no homeserver found for domain")
+)
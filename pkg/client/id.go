@@ -0,0 +1,49 @@
+package client
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidID is returned for strings that are not of the form
+// local$domain or local+label$domain.
+var ErrInvalidID = errors.New("monalias: invalid monalias id")
+
+// ID is a parsed Monalias ID.
+type ID struct {
+	Local  string
+	Label  string
+	Domain string
+}
+
+// ParseID parses local$domain or local+label$domain. The xmr: URI prefix used
+// in QR codes and deep links is accepted and dropped.
+func ParseID(s string) (ID, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "xmr:")
+
+	local, domain, ok := strings.Cut(s, "$")
+	if !ok || local == "" || domain == "" || strings.Contains(domain, "$") {
+		return ID{}, ErrInvalidID
+	}
+	if strings.ContainsAny(domain, "/?#@ ") {
+		return ID{}, ErrInvalidID
+	}
+
+	id := ID{Local: local, Domain: domain}
+	if base, label, ok := strings.Cut(local, "+"); ok {
+		if base == "" || label == "" || strings.Contains(label, "+") {
+			return ID{}, ErrInvalidID
+		}
+		id.Local, id.Label = base, label
+	}
+	return id, nil
+}
+
+// String returns the ID in the form sent as acct to the resolver.
+func (id ID) String() string {
+	if id.Label == "" {
+		return id.Local + "$" + id.Domain
+	}
+	return id.Local + "+" + id.Label + "$" + id.Domain
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaigoh/monalias/pkg/protocol"
+)
+
+// WellKnown is the metadata document a domain serves at
+// /.well-known/monalias.
+type WellKnown struct {
+	Homeserver string `json:"homeserver"`
+	Version    string `json:"version"`
+	Keys       []Key  `json:"keys"`
+}
+
+type Key struct {
+	Kid       string `json:"kid"`
+	Alg       string `json:"alg"`
+	PublicKey string `json:"public_key"`
+	Use       string `json:"use"`
+	Status    string `json:"status,omitempty"`
+}
+
+// Key returns the Ed25519 signing key published under kid.
+func (wk *WellKnown) Key(kid string) (ed25519.PublicKey, bool) {
+	for _, k := range wk.Keys {
+		if k.Kid != kid || k.Alg != "Ed25519" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		if pub, ok := protocol.ParsePublicKey(k.PublicKey); ok {
+			return pub, true
+		}
+	}
+	return nil, false
+}
+
+type cachedWellKnown struct {
+	doc     *WellKnown
+	fetched time.Time
+}
+
+// WellKnown returns the metadata document for domain, from cache when it is
+// younger than WellKnownTTL. If the document cannot be fetched from the
+// domain itself and SRV lookups are enabled, the homeserver named by
+// _monalias._tcp.<domain> is used instead and the keys are read from its
+// own well-known document.
+func (c *Client) WellKnown(ctx context.Context, domain string) (*WellKnown, error) {
+	return c.wellKnown(ctx, domain, false)
+}
+
+func (c *Client) wellKnown(ctx context.Context, domain string, refresh bool) (*WellKnown, error) {
+	domain = strings.ToLower(domain)
+	now := c.now()
+
+	c.mu.Lock()
+	cached, ok := c.cache[domain]
+	c.mu.Unlock()
+	if ok && !refresh && now.Sub(cached.fetched) < c.wellKnownTTL() {
+		return cached.doc, nil
+	}
+
+	doc, err := c.FetchWellKnown(ctx, "https://"+domain)
+	if err != nil && !c.DisableSRV {
+		var srvErr error
+		doc, srvErr = c.wellKnownFromSRV(ctx, domain)
+		if srvErr != nil {
+			return nil, fmt.Errorf("%w: %s: %v; srv: %v", ErrNoHomeserver, domain, err, srvErr)
+		}
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrNoHomeserver, domain, err)
+	}
+
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]cachedWellKnown)
+	}
+	c.cache[domain] = cachedWellKnown{doc: doc, fetched: now}
+	c.mu.Unlock()
+	return doc, nil
+}
+
+// FetchWellKnown fetches the metadata document served under base, which is
+// a domain or homeserver URL such as https://example.com. It bypasses the
+// cache and the SRV fallback.
+func (c *Client) FetchWellKnown(ctx context.Context, base string) (*WellKnown, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/.well-known/monalias", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("well-known returned HTTP %d", resp.StatusCode)
+	}
+
+	var doc WellKnown
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode well-known: %w", err)
+	}
+	if doc.Homeserver == "" {
+		return nil, fmt.Errorf("well-known has no homeserver")
+	}
+	return &doc, nil
+}
+
+// wellKnownFromSRV implements the SPEC.md fallback: the first SRV target
+// (in priority and weight order) is the homeserver.
+func (c *Client) wellKnownFromSRV(ctx context.Context, domain string) (*WellKnown, error) {
+	resolver := c.SRV
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	_, records, err := resolver.LookupSRV(ctx, "monalias", "tcp", domain)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error = fmt.Errorf("no SRV records")
+	for _, srv := range records {
+		homeserver := "https://" + net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+		doc, err := c.FetchWellKnown(ctx, homeserver)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		// The SRV record names the resolver; the document is only trusted
+		// for its keys.
+		doc.Homeserver = homeserver
+		return doc, nil
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,164 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxTxDescription and MaxRecipientName bound the free-text payment
+	// fields, in characters.
+	MaxTxDescription = 200
+	MaxRecipientName = 100
+
+	// piconeroDigits is the number of decimal places in one XMR.
+	piconeroDigits = 12
+)
+
+// Payment is the optional payment request carried by a resolve request and
+// echoed back in its monero: URI.
+type Payment struct {
+	Amount        string `json:"amount,omitempty"`
+	TxDescription string `json:"tx_description,omitempty"`
+	RecipientName string `json:"recipient_name,omitempty"`
+}
+
+// IsZero reports whether no payment field is set.
+func (p Payment) IsZero() bool {
+	return p == Payment{}
+}
+
+// PaymentError names the payment field that failed validation.
+type PaymentError struct {
+	Field string
+	Err   error
+}
+
+func (e *PaymentError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *PaymentError) Unwrap() error {
+	return e.Err
+}
+
+// Normalize validates p and returns it with the amount in its shortest
+// decimal form, so "1.50" and "1.5" produce the same URI.
+func (p Payment) Normalize() (Payment, error) {
+	if p.Amount != "" {
+		amount, err := normalizeAmount(p.Amount)
+		if err != nil {
+			return Payment{}, &PaymentError{Field: "amount", Err: err}
+		}
+		p.Amount = amount
+	}
+	if err := checkText(p.TxDescription, MaxTxDescription); err != nil {
+		return Payment{}, &PaymentError{Field: "tx_description", Err: err}
+	}
+	if err := checkText(p.RecipientName, MaxRecipientName); err != nil {
+		return Payment{}, &PaymentError{Field: "recipient_name", Err: err}
+	}
+	return p, nil
+}
+
+// normalizeAmount accepts a positive XMR amount with at most twelve decimal
+// places.
+func normalizeAmount(s string) (string, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || !allDigits(whole) || !allDigits(frac) || (strings.Contains(s, ".") && frac == "") {
+		return "", errors.New("must be a decimal number of XMR")
+	}
+	if len(frac) > piconeroDigits {
+		return "", errors.New("has more than 12 decimal places")
+	}
+	whole = strings.TrimLeft(whole, "0")
+	frac = strings.TrimRight(frac, "0")
+	if whole == "" && frac == "" {
+		return "", errors.New("must be greater than zero")
+	}
+	// Anything that fits in a uint64 of piconero is a real amount.
+	if _, err := strconv.ParseUint(whole+frac+strings.Repeat("0", piconeroDigits-len(frac)), 10, 64); err != nil {
+		return "", errors.New("is too large")
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if frac == "" {
+		return whole, nil
+	}
+	return whole + "." + frac, nil
+}
+
+func allDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func checkText(s string, max int) error {
+	if !utf8.ValidString(s) {
+		return errors.New("is not valid UTF-8")
+	}
+	if utf8.RuneCountInString(s) > max {
+		return fmt.Errorf("is longer than %d characters", max)
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			return errors.New("contains control characters")
+		}
+	}
+	return nil
+}
+
+// PaymentURI builds the monero: URI for address and an already normalized
+// payment, with parameters in a fixed order and spaces encoded as %20:
+//
+//	monero:<address>?tx_amount=<amount>&tx_description=<text>&recipient_name=<text>
+//
+// Empty fields are left out.
+func PaymentURI(address string, p Payment) string {
+	var params []string
+	add := func(name, value string) {
+		if value != "" {
+			params = append(params, name+"="+strings.ReplaceAll(url.QueryEscape(value), "+", "%20"))
+		}
+	}
+	add("tx_amount", p.Amount)
+	add("tx_description", p.TxDescription)
+	add("recipient_name", p.RecipientName)
+
+	uri := "monero:" + address
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri
+}
+
+// ResolveURICanonical is the string signed for a successful resolve that
+// carries a payment request:
+//
+//	MONALIAS_RESOLVE_URI\n<acct>\n<address>\n<network>\n<expires_at_or_empty>\n<key_id>\n<uri>
+//
+// uri must be exactly the uri string carried in the body.
+func ResolveURICanonical(acct, address, network, expiresAt, kid, uri string) string {
+	return strings.Join([]string{"MONALIAS_RESOLVE_URI", acct, address, network, expiresAt, kid, uri}, "\n")
+}
+
+// SuccessCanonical is the string signed for a successful resolve whose body
+// carries uri: ResolveURICanonical when uri is set, ResolveCanonical when it
+// is empty. PaymentURI never returns "", so a body answering a payment
+// request always selects the URI form.
+func SuccessCanonical(acct, address, network, expiresAt, kid, uri string) string {
+	if uri != "" {
+		return ResolveURICanonical(acct, address, network, expiresAt, kid, uri)
+	}
+	return ResolveCanonical(acct, address, network, expiresAt, kid)
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPaymentNormalize(t *testing.T) {
+	tests := []struct {
+		in        Payment
+		wantAmt   string
+		wantField string
+	}{
+		{in: Payment{Amount: "1.50"}, wantAmt: "1.5"},
+		{in: Payment{Amount: "001"}, wantAmt: "1"},
+		{in: Payment{Amount: "0.000000000001"}, wantAmt: "0.000000000001"},
+		{in: Payment{Amount: "18446744.073709551615"}, wantAmt: "18446744.073709551615"},
+		{in: Payment{TxDescription: "Rent for May"}},
+		{in: Payment{Amount: "0"}, wantField: "amount"},
+		{in: Payment{Amount: "0.0"}, wantField: "amount"},
+		{in: Payment{Amount: "-1"}, wantField: "amount"},
+		{in: Payment{Amount: "1."}, wantField: "amount"},
+		{in: Payment{Amount: ".5"}, wantField: "amount"},
+		{in: Payment{Amount: "1e3"}, wantField: "amount"},
+		{in: Payment{Amount: "0.0000000000001"}, wantField: "amount"},
+		{in: Payment{Amount: "18446744.073709551616"}, wantField: "amount"},
+		{in: Payment{TxDescription: "line\nbreak"}, wantField: "tx_description"},
+		{in: Payment{TxDescription: strings.Repeat("é", MaxTxDescription+1)}, wantField: "tx_description"},
+		{in: Payment{RecipientName: "\xff"}, wantField: "recipient_name"},
+	}
+	for _, tt := range tests {
+		got, err := tt.in.Normalize()
+		if tt.wantField != "" {
+			var perr *PaymentError
+			if !errors.As(err, &perr) || perr.Field != tt.wantField {
+				t.Errorf("Normalize(%+v) error = %v, want a %s error", tt.in, err, tt.wantField)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Normalize(%+v): %v", tt.in, err)
+			continue
+		}
+		if got.Amount != tt.wantAmt {
+			t.Errorf("Normalize(%+v) amount = %q, want %q", tt.in, got.Amount, tt.wantAmt)
+		}
+	}
+}
+
+func TestPaymentURI(t *testing.T) {
+	const addr = "888tNkZrPN6JsEgekjMnABU4TBzc2Dt29EPAvkRxbANsAnjyPbb3iQ1YBRk1UXcdRsiKc9dhwMVgN5S9cQUiyoogDavup3H"
+	if got := PaymentURI(addr, Payment{}); got != "monero:"+addr {
+		t.Errorf("bare URI = %q", got)
+	}
+	got := PaymentURI(addr, Payment{Amount: "1.5", TxDescription: "Rent & bills 100%", RecipientName: "Bob Smith"})
+	want := "monero:" + addr + "?tx_amount=1.5&tx_description=Rent%20%26%20bills%20100%25&recipient_name=Bob%20Smith"
+	if got != want {
+		t.Errorf("URI = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+// Package protocol holds the parts of the Monalias lookup protocol that the
+// server, the client library and the CLI must agree on byte for byte: the
+// canonical strings that get signed and the headers that carry signatures.
+package protocol
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderKeyID     = "X-Monalias-Key-Id"
+	HeaderSignature = "X-Monalias-Sig"
+)
+
+// ResolveCanonical is the string signed for a successful resolve:
+//
+//	MONALIAS_RESOLVE\n<acct>\n<address>\n<network>\n<expires_at_or_empty>\n<key_id>
+//
+// expiresAt must be exactly the expires_at string carried in the body.
+func ResolveCanonical(acct, address, network, expiresAt, kid string) string {
+	return strings.Join([]string{"MONALIAS_RESOLVE", acct, address, network, expiresAt, kid}, "\n")
+}
+
+// ErrorCanonical is the string signed for an error that is specific to the
+// requested acct and network:
+//
+//	MONALIAS_RESOLVE_ERROR\n<acct>\n<network>\n<error>\n<key_id>
+func ErrorCanonical(acct, network, code, kid string) string {
+	return strings.Join([]string{"MONALIAS_RESOLVE_ERROR", acct, network, code, kid}, "\n")
+}
+
+// FormatExpiresAt renders expires_at the way it appears in both the body and
+// the canonical string.
+func FormatExpiresAt(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Sign returns the base64 signature sent in HeaderSignature.
+func Sign(priv ed25519.PrivateKey, canonical string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(canonical)))
+}
+
+// Verify checks a base64 signature from HeaderSignature.
+func Verify(pub ed25519.PublicKey, canonical, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(pub, []byte(canonical), sig)
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key as published in the
+// well-known document.
+func ParsePublicKey(s string) (ed25519.PublicKey, bool) {
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, false
+	}
+	return ed25519.PublicKey(pub), true
+}